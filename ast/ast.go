@@ -6,6 +6,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/prologic/monkey-lang/token"
@@ -188,6 +189,7 @@ func (b *Boolean) String() string { return b.Token.Literal }
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // The value of a literal out of the range of an int64
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -212,6 +214,33 @@ func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 // String returns a stringified version of the AST for debugging
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// TemplateLiteral represents an interpolated string literal and holds its
+// parts, string literals for the text and the interpolated expressions
+type TemplateLiteral struct {
+	Token token.Token // the token.TEMPLATE token
+	Parts []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	for _, part := range tl.Parts {
+		if sl, ok := part.(*StringLiteral); ok {
+			out.WriteString(sl.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+
+	return out.String()
+}
+
 // PrefixExpression represents a prefix expression and holds the operator
 // as well as the right-hand side expression
 type PrefixExpression struct {
@@ -265,11 +294,14 @@ func (ie *InfixExpression) String() string {
 }
 
 // IfExpression represents an `if` expression and holds the condition,
-// consequence and alternative expressions
+// consequence and alternative expressions. An `else if` chain is held as the
+// IfExpression of each `else if` in ElseIf of the previous one, with the
+// final `else` the Alternative of the last.
 type IfExpression struct {
 	Token       token.Token // The 'if' token
 	Condition   Expression
 	Consequence *BlockStatement
+	ElseIf      *IfExpression
 	Alternative *BlockStatement
 }
 
@@ -287,7 +319,10 @@ func (ie *IfExpression) String() string {
 	out.WriteString(" ")
 	out.WriteString(ie.Consequence.String())
 
-	if ie.Alternative != nil {
+	if ie.ElseIf != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.ElseIf.String())
+	} else if ie.Alternative != nil {
 		out.WriteString("else ")
 		out.WriteString(ie.Alternative.String())
 	}
@@ -295,6 +330,86 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// MatchExpression represents a `match` expression and holds the subject
+// and the arms whose patterns are tried against the subject in turn
+type MatchExpression struct {
+	Token   token.Token // The 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// MatchArm represents a single arm of a match expression, e.g:
+// [x, y] if x > y => x, the body of the first arm whose pattern matches
+// and whose guard (if any) is true is the value of the match expression
+type MatchArm struct {
+	Token   token.Token // The '=>' token
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// AlternativePattern represents a pattern in a match expression that
+// matches if any of its alternatives match, e.g: "a" | "b"
+type AlternativePattern struct {
+	Token        token.Token // the first alternative's token
+	Alternatives []Expression
+}
+
+func (ap *AlternativePattern) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (ap *AlternativePattern) TokenLiteral() string { return ap.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (ap *AlternativePattern) String() string {
+	alternatives := []string{}
+	for _, alt := range ap.Alternatives {
+		alternatives = append(alternatives, alt.String())
+	}
+	return strings.Join(alternatives, " | ")
+}
+
 // WhileExpression represents an `while` expression and holds the condition,
 // and consequence expression
 type WhileExpression struct {
@@ -321,11 +436,17 @@ func (we *WhileExpression) String() string {
 }
 
 // FunctionLiteral represents a literal functions and holds the function's
-// formal parameters and boy of the function as a block statement
+// formal parameters and boy of the function as a block statement. Defaults
+// holds the default values of the last len(Defaults) parameters and Rest is
+// the optional parameter collecting any extra arguments. Doc holds the doc
+// comment of a method.
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Name       string
+	Doc        string
 	Parameters []*Identifier
+	Defaults   []Expression
+	Rest       *Identifier
 	Body       *BlockStatement
 }
 
@@ -339,8 +460,16 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	optional := len(fl.Parameters) - len(fl.Defaults)
+	for i, p := range fl.Parameters {
+		if i >= optional {
+			params = append(params, p.String()+" = "+fl.Defaults[i-optional].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
 	out.WriteString(fmt.Sprintf("%s %s", fl.TokenLiteral(), fl.Name))
@@ -352,6 +481,79 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral represents a literal macro and holds the macro's formal
+// parameters and body of the macro as a block statement
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// StructLiteral represents a struct declaration which binds Name to a new
+// struct type with the given fields and methods, e.g:
+// struct Point { x, y, fn norm() { self.x * self.x + self.y * self.y } }
+// Each method is an anonymous function literal whose first parameter is
+// self and whose name is the corresponding entry of MethodNames
+type StructLiteral struct {
+	Token       token.Token // The 'struct' token
+	Name        *Identifier
+	Doc         string // The doc comment preceding the declaration, if any
+	Fields      []*Identifier
+	MethodNames []*Identifier
+	Methods     []*FunctionLiteral
+}
+
+func (sl *StructLiteral) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	members := []string{}
+	for _, field := range sl.Fields {
+		members = append(members, field.String())
+	}
+	for i, method := range sl.Methods {
+		members = append(members, method.TokenLiteral()+" "+sl.MethodNames[i].String()+
+			strings.TrimPrefix(method.String(), method.TokenLiteral()+" "))
+	}
+
+	out.WriteString(sl.TokenLiteral())
+	out.WriteString(" ")
+	out.WriteString(sl.Name.String())
+	out.WriteString(" {")
+	out.WriteString(strings.Join(members, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 // CallExpression represents a call expression and holds the function to be
 // called as well as the arguments to be passed to that function
 type CallExpression struct {
@@ -409,12 +611,104 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// SpreadExpression represents a spread expression, e.g: ...xs
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (se *SpreadExpression) String() string {
+	return se.TokenLiteral() + se.Value.String()
+}
+
+// ArrayPattern represents an array destructuring pattern on the left of a
+// binding or assignment or as a function parameter, e.g: [a, b, ...rest]
+// Each element is an *Identifier or a nested *ArrayPattern or *HashPattern
+// and Rest is nil unless the remaining elements are collected
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPattern represents a hash destructuring pattern on the left of a
+// binding or assignment or as a function parameter, e.g: {name, age}
+// Each key names both the (string) key in the hash and the variable.
+// In a match expression Patterns holds the pattern the value of each key
+// must match, e.g: {kind: "circle", r}, a nil pattern binds the key's name
+type HashPattern struct {
+	Token    token.Token // the '{' token
+	Keys     []*Identifier
+	Patterns []Expression
+}
+
+func (hp *HashPattern) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	keys := []string{}
+	for i, key := range hp.Keys {
+		if i < len(hp.Patterns) && hp.Patterns[i] != nil {
+			keys = append(keys, key.String()+": "+hp.Patterns[i].String())
+		} else {
+			keys = append(keys, key.String())
+		}
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(keys, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 // BindExpression represents a binding expression of the form:
-// x := 1
+// x := 1 or [a, b] := xs or a constant binding of the form const x = 1
 type BindExpression struct {
-	Token token.Token // The := token
+	Token token.Token // The := or const token
 	Left  Expression
 	Value Expression
+	Const bool
+	Doc   string // The doc comment preceding the binding, if any
+
+	// Parameter is set for the binding of a pattern parameter, whose
+	// variables are always new and shadow any outer ones of the same name
+	Parameter bool
 }
 
 func (be *BindExpression) expressionNode() {}
@@ -426,6 +720,11 @@ func (be *BindExpression) TokenLiteral() string { return be.Token.Literal }
 func (be *BindExpression) String() string {
 	var out bytes.Buffer
 
+	if be.Const {
+		out.WriteString(be.TokenLiteral() + " " + be.Left.String() + " = " + be.Value.String())
+		return out.String()
+	}
+
 	out.WriteString(be.Left.String())
 	out.WriteString(be.TokenLiteral())
 	out.WriteString(be.Value.String())
@@ -434,11 +733,13 @@ func (be *BindExpression) String() string {
 }
 
 // AssignmentExpression represents an assignment expression of the form:
-// x = 1 or xs[1] = 2
+// x = 1, xs[1] = 2 or [a, b] = [b, a] or a compound assignment of the form
+// x += 1 which holds the binary operator applied in Operator
 type AssignmentExpression struct {
-	Token token.Token // The = token
-	Left  Expression
-	Value Expression
+	Token    token.Token // The = or compound assignment token, e.g: +=
+	Operator string      // The binary operator, e.g: +, or empty for =
+	Left     Expression
+	Value    Expression
 }
 
 func (ae *AssignmentExpression) expressionNode() {}
@@ -483,11 +784,46 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression represents a slice operator expression, e.g: xs[1:3]
+// and holds the left expression and the start and end expressions which
+// are nil if omitted
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+// TokenLiteral prints the literal value of the token associated with this node
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String returns a stringified version of the AST for debugging
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashLiteral represents a hash map or dictionary literal, a set of
 // key/value pairs.
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -500,8 +836,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -32,3 +32,114 @@ func TestString(t *testing.T) {
 
 	assert.Equal("myVar:=anotherVar", program.String())
 }
+
+func TestModify(t *testing.T) {
+	assert := assert.New(t)
+
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	block := func(e Expression) *BlockStatement {
+		return &BlockStatement{
+			Statements: []Statement{&ExpressionStatement{Expression: e}},
+		}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		{
+			&WhileExpression{Condition: one(), Consequence: block(one())},
+			&WhileExpression{Condition: two(), Consequence: block(two())},
+		},
+		{
+			&TemplateLiteral{Parts: []Expression{&StringLiteral{Value: "x"}, one()}},
+			&TemplateLiteral{Parts: []Expression{&StringLiteral{Value: "x"}, two()}},
+		},
+		{
+			&SliceExpression{Left: one(), Start: one(), End: one()},
+			&SliceExpression{Left: two(), Start: two(), End: two()},
+		},
+		{
+			&SliceExpression{Left: one()},
+			&SliceExpression{Left: two()},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&MatchExpression{Subject: one(), Arms: []*MatchArm{
+				{Pattern: one(), Guard: one(), Body: block(one())},
+			}},
+			&MatchExpression{Subject: two(), Arms: []*MatchArm{
+				{Pattern: one(), Guard: two(), Body: block(two())},
+			}},
+		},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(one())},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(two())},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&BindExpression{Left: &Identifier{Value: "x"}, Value: one()},
+			&BindExpression{Left: &Identifier{Value: "x"}, Value: two()},
+		},
+		{
+			&AssignmentExpression{Left: &IndexExpression{Left: one(), Index: one()}, Value: one()},
+			&AssignmentExpression{Left: &IndexExpression{Left: two(), Index: two()}, Value: two()},
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(tt.expected, Modify(tt.input, turnOneIntoTwo))
+	}
+
+	key := one()
+	hash := &HashLiteral{Pairs: map[Expression]Expression{key: one()}, Keys: []Expression{key}}
+	Modify(hash, turnOneIntoTwo)
+
+	assert.Equal([]Expression{two()}, hash.Keys)
+	for key, value := range hash.Pairs {
+		assert.Equal(two(), key)
+		assert.Equal(two(), value)
+	}
+}
@@ -0,0 +1,160 @@
+package ast
+
+// Inspect traverses the AST in depth-first order starting with node and
+// calls f for each node. If f returns true Inspect is called recursively
+// for each of the non-nil children of node.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			Inspect(node.Expression, f)
+		}
+
+	case *ReturnStatement:
+		if node.ReturnValue != nil {
+			Inspect(node.ReturnValue, f)
+		}
+
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *TemplateLiteral:
+		for _, part := range node.Parts {
+			Inspect(part, f)
+		}
+
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		if node.ElseIf != nil {
+			Inspect(node.ElseIf, f)
+		}
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+
+	case *WhileExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+
+	case *MatchExpression:
+		Inspect(node.Subject, f)
+		for _, arm := range node.Arms {
+			Inspect(arm, f)
+		}
+
+	case *MatchArm:
+		Inspect(node.Pattern, f)
+		if node.Guard != nil {
+			Inspect(node.Guard, f)
+		}
+		Inspect(node.Body, f)
+
+	case *AlternativePattern:
+		for _, alt := range node.Alternatives {
+			Inspect(alt, f)
+		}
+
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		for _, d := range node.Defaults {
+			Inspect(d, f)
+		}
+		if node.Rest != nil {
+			Inspect(node.Rest, f)
+		}
+		Inspect(node.Body, f)
+
+	case *StructLiteral:
+		Inspect(node.Name, f)
+		for _, field := range node.Fields {
+			Inspect(field, f)
+		}
+		for _, method := range node.Methods {
+			Inspect(method, f)
+		}
+
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, a := range node.Arguments {
+			Inspect(a, f)
+		}
+
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+
+	case *SpreadExpression:
+		Inspect(node.Value, f)
+
+	case *ArrayPattern:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+		if node.Rest != nil {
+			Inspect(node.Rest, f)
+		}
+
+	case *HashPattern:
+		for i, key := range node.Keys {
+			Inspect(key, f)
+			if i < len(node.Patterns) && node.Patterns[i] != nil {
+				Inspect(node.Patterns[i], f)
+			}
+		}
+
+	case *BindExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Value, f)
+
+	case *AssignmentExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Value, f)
+
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+
+	case *SliceExpression:
+		Inspect(node.Left, f)
+		if node.Start != nil {
+			Inspect(node.Start, f)
+		}
+		if node.End != nil {
+			Inspect(node.End, f)
+		}
+
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			Inspect(key, f)
+			Inspect(node.Pairs[key], f)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ast
+
+// ModifierFunc is called by Modify for each node and returns the node to
+// replace it with (or the node itself to leave it unchanged)
+type ModifierFunc func(Node) Node
+
+// Modify traverses the AST in depth-first order starting with node, replacing
+// each of the children of node with the result of modifying them before
+// calling modifier on node itself and returning its result. Nodes are
+// modified in place.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, s := range node.Statements {
+			node.Statements[i], _ = Modify(s, modifier).(Statement)
+		}
+
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+		}
+
+	case *ReturnStatement:
+		if node.ReturnValue != nil {
+			node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+		}
+
+	case *BlockStatement:
+		for i, s := range node.Statements {
+			node.Statements[i], _ = Modify(s, modifier).(Statement)
+		}
+
+	case *TemplateLiteral:
+		for i, part := range node.Parts {
+			node.Parts[i], _ = Modify(part, modifier).(Expression)
+		}
+
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.ElseIf != nil {
+			node.ElseIf, _ = Modify(node.ElseIf, modifier).(*IfExpression)
+		}
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+
+	case *WhileExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+
+	case *MatchExpression:
+		node.Subject, _ = Modify(node.Subject, modifier).(Expression)
+		for _, arm := range node.Arms {
+			if arm.Guard != nil {
+				arm.Guard, _ = Modify(arm.Guard, modifier).(Expression)
+			}
+			arm.Body, _ = Modify(arm.Body, modifier).(*BlockStatement)
+		}
+
+	case *FunctionLiteral:
+		for i, p := range node.Parameters {
+			node.Parameters[i], _ = Modify(p, modifier).(*Identifier)
+		}
+		for i, d := range node.Defaults {
+			node.Defaults[i], _ = Modify(d, modifier).(Expression)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *StructLiteral:
+		for i, method := range node.Methods {
+			node.Methods[i], _ = Modify(method, modifier).(*FunctionLiteral)
+		}
+
+	case *MacroLiteral:
+		for i, p := range node.Parameters {
+			node.Parameters[i], _ = Modify(p, modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, a := range node.Arguments {
+			node.Arguments[i], _ = Modify(a, modifier).(Expression)
+		}
+
+	case *ArrayLiteral:
+		for i, el := range node.Elements {
+			node.Elements[i], _ = Modify(el, modifier).(Expression)
+		}
+
+	case *SpreadExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *BindExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *AssignmentExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+
+	case *SliceExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		if node.Start != nil {
+			node.Start, _ = Modify(node.Start, modifier).(Expression)
+		}
+		if node.End != nil {
+			node.End, _ = Modify(node.End, modifier).(Expression)
+		}
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		keys := make([]Expression, len(node.Keys))
+		for i, key := range node.Keys {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newValue, _ := Modify(node.Pairs[key], modifier).(Expression)
+			pairs[newKey] = newValue
+			keys[i] = newKey
+		}
+		node.Pairs = pairs
+		node.Keys = keys
+	}
+
+	return modifier(node)
+}
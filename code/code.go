@@ -23,10 +23,17 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
 
+		if width := def.Width(); i+1+width > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s truncated: want %d operand bytes, got %d\n",
+				i, def.Name, width, len(ins)-i-1)
+			break
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
@@ -37,6 +44,42 @@ func (ins Instructions) String() string {
 	return out.String()
 }
 
+// Verify checks that ins consists of defined opcodes each followed by all of
+// its operands and that jumps target the start of an instruction
+func (ins Instructions) Verify() error {
+	starts := make(map[int]bool)
+	var jumps []int
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("%s at %04d", err, i)
+		}
+
+		if width := def.Width(); i+1+width > len(ins) {
+			return fmt.Errorf("%s truncated at %04d: want %d operand bytes, got %d",
+				def.Name, i, width, len(ins)-i-1)
+		}
+
+		starts[i] = true
+		if op := Opcode(ins[i]); op == Jump || op == JumpIfFalse {
+			jumps = append(jumps, i)
+		}
+
+		i += 1 + def.Width()
+	}
+
+	for _, i := range jumps {
+		// A jump to the end of the instructions finishes the function
+		if pos := int(ReadUint16(ins[i+1:])); !starts[pos] && pos != len(ins) {
+			return fmt.Errorf("invalid jump target %04d at %04d", pos, i)
+		}
+	}
+
+	return nil
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -57,6 +100,21 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
 
+// SourceMap maps the offsets of instructions that start a statement to the
+// source line of that statement
+type SourceMap map[int]int
+
+// Line returns the source line of the statement the instruction at offset
+// belongs to or 0 if unknown
+func (sm SourceMap) Line(offset int) int {
+	for i := offset; i >= 0; i-- {
+		if line, ok := sm[i]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
 type Opcode byte
 
 func (o Opcode) String() string {
@@ -114,6 +172,21 @@ const (
 	Call
 	Return
 	ReturnValue
+	BuildString
+	GetSlice
+	UnpackArray
+	UnpackHash
+	ExtendArray
+	CallSpread
+	MatchValue
+	MatchArray
+	MatchHash
+	MakeStruct
+	DefineMethods
+	DupTwo
+	LeftShift
+	RightShift
+	Pow
 )
 
 var definitions = map[Opcode]*Definition{
@@ -158,6 +231,30 @@ var definitions = map[Opcode]*Definition{
 	Jump:             {"Jump", []int{2}},
 	Call:             {"Call", []int{1}},
 	Return:           {"Return", []int{}},
+	BuildString:      {"BuildString", []int{2}},
+	GetSlice:         {"GetSlice", []int{}},
+	UnpackArray:      {"UnpackArray", []int{2, 1}},
+	UnpackHash:       {"UnpackHash", []int{2}},
+	ExtendArray:      {"ExtendArray", []int{}},
+	CallSpread:       {"CallSpread", []int{}},
+	MatchValue:       {"MatchValue", []int{}},
+	MatchArray:       {"MatchArray", []int{2, 1}},
+	MatchHash:        {"MatchHash", []int{2}},
+	MakeStruct:       {"MakeStruct", []int{2}},
+	DefineMethods:    {"DefineMethods", []int{2}},
+	DupTwo:           {"DupTwo", []int{}},
+	LeftShift:        {"LeftShift", []int{}},
+	RightShift:       {"RightShift", []int{}},
+	Pow:              {"Pow", []int{}},
+}
+
+// Width returns the total width in bytes of the operands of the instruction
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
 }
 
 func Lookup(op byte) (*Definition, error) {
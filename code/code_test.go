@@ -59,6 +59,73 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestMalformedInstructionsString(t *testing.T) {
+	tests := []struct {
+		instructions Instructions
+		expected     string
+	}{
+		{
+			Instructions{255, byte(Add)},
+			"0000 ERROR: opcode 255 undefined\n0001 Add\n",
+		},
+		{
+			Instructions{byte(LoadConstant), 1},
+			"0000 ERROR: LoadConstant truncated: want 2 operand bytes, got 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.instructions.String(); actual != tt.expected {
+			t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+				tt.expected, actual)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	concat := func(instructions ...[]byte) Instructions {
+		var out Instructions
+		for _, ins := range instructions {
+			out = append(out, ins...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		instructions Instructions
+		expected     string
+	}{
+		{concat(Make(LoadTrue), Make(JumpIfFalse, 6), Make(LoadNull), Make(Pop)), ""},
+		{concat(Make(Jump, 3)), ""},
+		{Instructions{255}, "opcode 255 undefined at 0000"},
+		{Instructions{byte(Add), byte(LoadConstant), 1}, "LoadConstant truncated at 0001: want 2 operand bytes, got 1"},
+		{concat(Make(LoadConstant, 0), Make(Jump, 1)), "invalid jump target 0001 at 0003"},
+		{concat(Make(Jump, 4)), "invalid jump target 0004 at 0000"},
+	}
+
+	for _, tt := range tests {
+		err := tt.instructions.Verify()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.instructions, err)
+			}
+		} else if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.instructions, tt.expected, err)
+		}
+	}
+}
+
+func FuzzInstructionsString(f *testing.F) {
+	f.Add([]byte(Make(LoadConstant, 65535)))
+	f.Add(append(Make(MakeClosure, 1, 2), Make(Call, 1)...))
+	f.Add([]byte{255, 0, 1})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_ = Instructions(b).String()
+		_ = Instructions(b).Verify()
+	})
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
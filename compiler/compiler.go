@@ -6,7 +6,6 @@ package compiler
 import (
 	"fmt"
 	"log"
-	"sort"
 	"strings"
 
 	"github.com/prologic/monkey-lang/ast"
@@ -21,6 +20,7 @@ type EmittedInstruction struct {
 
 type Scope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 }
@@ -35,11 +35,15 @@ type Compiler struct {
 	scopeIndex int
 
 	symbolTable *SymbolTable
+
+	// matches is the nesting depth of the match expression being compiled
+	matches int
 }
 
 func New() *Compiler {
 	mainScope := Scope{
 		instructions:        code.Instructions{},
+		sourceMap:           code.SourceMap{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
@@ -80,9 +84,669 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	}
 }
 
+// bindSymbol returns the symbol a binding to ident binds, defining a new
+// symbol unless ident is already bound in the current scope. Returns an error
+// if ident is bound to a constant declared in the current scope.
+func (c *Compiler) bindSymbol(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return c.symbolTable.Define(ident.Value), nil
+	}
+
+	if symbol.Const && c.inCurrentScope(symbol) {
+		return symbol, fmt.Errorf("cannot assign to constant %s", ident.Value)
+	}
+
+	// Local shadowing of previously defined "free" variable in a
+	// function now begin rehound to a locally scopped variable.
+	// Likewise builtins and the constants of enclosing scopes are
+	// shadowed by a new binding.
+	if symbol.Scope == FreeScope || symbol.Const {
+		return c.symbolTable.Define(ident.Value), nil
+	}
+
+	return symbol, nil
+}
+
+// inCurrentScope reports whether symbol was defined in the current scope
+// rather than in an enclosing scope or as a builtin
+func (c *Compiler) inCurrentScope(symbol Symbol) bool {
+	switch symbol.Scope {
+	case LocalScope:
+		return true
+	case GlobalScope:
+		return c.scopeIndex == 0
+	default:
+		return false
+	}
+}
+
+// matchSymbol returns the symbol a match arm binds ident to. As in the
+// evaluator an arm in a function binds a global variable to a new local
+// variable rather than assigning to the global.
+func (c *Compiler) matchSymbol(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if ok && symbol.Scope == GlobalScope && c.scopeIndex > 0 {
+		return c.symbolTable.Define(ident.Value), nil
+	}
+
+	return c.bindSymbol(ident)
+}
+
+// bindConstSymbol defines a new constant symbol for a constant binding to
+// ident. Returns an error if ident is already bound to a constant in the
+// current scope.
+func (c *Compiler) bindConstSymbol(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if ok && symbol.Const && c.inCurrentScope(symbol) {
+		return symbol, fmt.Errorf("cannot assign to constant %s", ident.Value)
+	}
+
+	return c.symbolTable.DefineConst(ident.Value), nil
+}
+
+// assignSymbol returns the symbol an assignment to ident assigns. Returns an
+// error if ident is undefined or bound to a constant (or a builtin).
+func (c *Compiler) assignSymbol(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return symbol, fmt.Errorf("undefined variable %s", ident.Value)
+	}
+
+	if symbol.Const {
+		return symbol, fmt.Errorf("cannot assign to constant %s", ident.Value)
+	}
+
+	return symbol, nil
+}
+
+func (c *Compiler) emitBind(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.BindGlobal, s.Index)
+	} else {
+		c.emit(code.BindLocal, s.Index)
+	}
+}
+
+func (c *Compiler) emitAssign(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.AssignGlobal, s.Index)
+	} else {
+		c.emit(code.AssignLocal, s.Index)
+	}
+}
+
+func isPattern(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.ArrayPattern, *ast.HashPattern:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasSpread(args []ast.Expression) bool {
+	for _, a := range args {
+		if _, ok := a.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadArguments compiles the arguments of a call with spread
+// arguments, e.g: f(1, ...xs), into an array of the arguments by extending
+// an array of the leading arguments with each spread array and array of
+// following arguments in turn and emits a call with the array's elements
+func (c *Compiler) compileSpreadArguments(args []ast.Expression) error {
+	pending, first := 0, true
+	flush := func() {
+		c.emit(code.MakeArray, pending)
+		if !first {
+			c.emit(code.ExtendArray)
+		}
+		pending, first = 0, false
+	}
+
+	for _, a := range args {
+		spread, ok := a.(*ast.SpreadExpression)
+		if !ok {
+			c.l++
+			err := c.Compile(a)
+			c.l--
+			if err != nil {
+				return err
+			}
+			pending++
+			continue
+		}
+
+		if first || pending > 0 {
+			flush()
+		}
+
+		c.l++
+		err := c.Compile(spread.Value)
+		c.l--
+		if err != nil {
+			return err
+		}
+		c.emit(code.ExtendArray)
+	}
+
+	if pending > 0 {
+		flush()
+	}
+
+	c.emit(code.CallSpread)
+	return nil
+}
+
+// destructureMode is how the identifiers of a destructuring pattern are
+// stored to
+type destructureMode int
+
+const (
+	// destructureAssign assigns existing variables as = does
+	destructureAssign destructureMode = iota
+	// destructureBind binds variables as := does
+	destructureBind
+	// destructureDefine defines new variables, as for pattern parameters
+	destructureDefine
+)
+
+// compileDestructuring destructures the value on top of the stack into the
+// identifiers of pattern, storing them according to mode, and leaves a single
+// null on the stack as the value of the expression
+func (c *Compiler) compileDestructuring(pattern ast.Expression, mode destructureMode) error {
+	var targets []ast.Expression
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		switch mode {
+		case destructureBind:
+			symbol, err := c.bindSymbol(pattern)
+			if err != nil {
+				return err
+			}
+			c.emitBind(symbol)
+		case destructureDefine:
+			c.emitBind(c.symbolTable.Define(pattern.Value))
+		default:
+			symbol, err := c.assignSymbol(pattern)
+			if err != nil {
+				return err
+			}
+			c.emitAssign(symbol)
+		}
+		return nil
+
+	case *ast.ArrayPattern:
+		targets = append(targets, pattern.Elements...)
+		rest := 0
+		if pattern.Rest != nil {
+			targets = append(targets, pattern.Rest)
+			rest = 1
+		}
+		c.emit(code.UnpackArray, len(pattern.Elements), rest)
+
+	case *ast.HashPattern:
+		for _, key := range pattern.Keys {
+			str := &object.String{Value: key.Value}
+			c.emit(code.LoadConstant, c.addConstant(str))
+			targets = append(targets, key)
+		}
+		c.emit(code.UnpackHash, len(pattern.Keys))
+
+	default:
+		return fmt.Errorf("invalid destructuring target %s", pattern)
+	}
+
+	if len(targets) == 0 {
+		c.emit(code.LoadNull)
+		return nil
+	}
+
+	for i, target := range targets {
+		if i > 0 {
+			c.emit(code.Pop)
+		}
+		if err := c.compileDestructuring(target, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchBinding is a variable bound by a match pattern to the part of the
+// match subject at path (followed by the elements from rest on if rest is
+// not negative)
+type matchBinding struct {
+	ident *ast.Identifier
+	path  []object.Object
+	rest  int
+}
+
+// compileIfExpression compiles an if expression and its `else if` branches
+// into a chain of conditions each jumping to the next when false, with the
+// end of each consequence jumping to the end of the chain
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	var jumpPositions []int
+
+	for {
+		c.l++
+		err := c.Compile(node.Condition)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		// Emit an `JumpIfFalse` with a bogus value
+		jumpIfFalsePos := c.emit(code.JumpIfFalse, 0xFFFF)
+
+		c.l++
+		err = c.Compile(node.Consequence)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.Pop) {
+			c.removeLastPop()
+		}
+
+		// Emit an `Jump` with a bogus value
+		jumpPositions = append(jumpPositions, c.emit(code.Jump, 0xFFFF))
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpIfFalsePos, afterConsequencePos)
+
+		if node.ElseIf == nil {
+			break
+		}
+		node = node.ElseIf
+	}
+
+	if node.Alternative == nil {
+		c.emit(code.LoadNull)
+	} else {
+		c.l++
+		err := c.Compile(node.Alternative)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.Pop) {
+			c.removeLastPop()
+		}
+	}
+
+	afterAlternativePos := len(c.currentInstructions())
+	for _, pos := range jumpPositions {
+		c.changeOperand(pos, afterAlternativePos)
+	}
+
+	return nil
+}
+
+// compileMatch compiles a match expression into a chain of tests of the
+// subject, held in a hidden variable, against the pattern of each arm
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	c.l++
+	err := c.Compile(node.Subject)
+	c.l--
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("match#%d", c.matches)
+	subject, ok := c.symbolTable.store[name]
+	if !ok {
+		subject = c.symbolTable.Define(name)
+	}
+	c.emitBind(subject)
+	c.emit(code.Pop)
+
+	c.matches++
+	defer func() { c.matches-- }()
+
+	var ends []int
+	for _, arm := range node.Arms {
+		var (
+			fails []int
+			binds []matchBinding
+		)
+
+		err := c.compileMatchPattern(arm.Pattern, subject, nil, &fails, &binds)
+		if err != nil {
+			return err
+		}
+
+		for _, b := range binds {
+			c.loadMatchPath(subject, b.path)
+			if b.rest >= 0 {
+				c.emit(code.LoadConstant, c.addConstant(&object.Integer{Value: int64(b.rest)}))
+				c.emit(code.LoadNull)
+				c.emit(code.GetSlice)
+			}
+			symbol, err := c.matchSymbol(b.ident)
+			if err != nil {
+				return err
+			}
+			c.emitBind(symbol)
+			c.emit(code.Pop)
+		}
+
+		if arm.Guard != nil {
+			c.l++
+			err := c.Compile(arm.Guard)
+			c.l--
+			if err != nil {
+				return err
+			}
+			fails = append(fails, c.emit(code.JumpIfFalse, 0xFFFF))
+		}
+
+		// An empty body must not remove the Pop of the last binding
+		if len(arm.Body.Statements) == 0 {
+			c.emit(code.LoadNull)
+		} else {
+			c.l++
+			err = c.Compile(arm.Body)
+			c.l--
+			if err != nil {
+				return err
+			}
+		}
+
+		ends = append(ends, c.emit(code.Jump, 0xFFFF))
+
+		afterArmPos := len(c.currentInstructions())
+		for _, pos := range fails {
+			c.changeOperand(pos, afterArmPos)
+		}
+	}
+
+	c.emit(code.LoadNull)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range ends {
+		c.changeOperand(pos, afterMatchPos)
+	}
+
+	return nil
+}
+
+// loadMatchPath emits code loading the part of the match subject at path
+func (c *Compiler) loadMatchPath(subject Symbol, path []object.Object) {
+	c.loadSymbol(subject)
+	for _, key := range path {
+		c.emit(code.LoadConstant, c.addConstant(key))
+		c.emit(code.GetItem)
+	}
+}
+
+// compileMatchPattern emits code testing whether the part of the match
+// subject at path matches pattern, adding the positions of the jumps taken
+// when it does not to fails and the variables the pattern binds to binds
+func (c *Compiler) compileMatchPattern(
+	pattern ast.Expression,
+	subject Symbol,
+	path []object.Object,
+	fails *[]int,
+	binds *[]matchBinding,
+) error {
+	// Copy path so the paths of sibling patterns do not share elements
+	path = path[:len(path):len(path)]
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			*binds = append(*binds, matchBinding{pattern, path, -1})
+		}
+
+	case *ast.AlternativePattern:
+		var oks []int
+		for i, alt := range pattern.Alternatives {
+			if i == len(pattern.Alternatives)-1 {
+				err := c.compileMatchPattern(alt, subject, path, fails, binds)
+				if err != nil {
+					return err
+				}
+				break
+			}
+
+			var next []int
+			err := c.compileMatchPattern(alt, subject, path, &next, binds)
+			if err != nil {
+				return err
+			}
+			oks = append(oks, c.emit(code.Jump, 0xFFFF))
+
+			nextPos := len(c.currentInstructions())
+			for _, pos := range next {
+				c.changeOperand(pos, nextPos)
+			}
+		}
+
+		afterAlternativesPos := len(c.currentInstructions())
+		for _, pos := range oks {
+			c.changeOperand(pos, afterAlternativesPos)
+		}
+
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.loadMatchPath(subject, path)
+		c.emit(code.MatchArray, len(pattern.Elements), rest)
+		*fails = append(*fails, c.emit(code.JumpIfFalse, 0xFFFF))
+
+		for i, el := range pattern.Elements {
+			index := &object.Integer{Value: int64(i)}
+			err := c.compileMatchPattern(el, subject, append(path, index), fails, binds)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			*binds = append(*binds, matchBinding{pattern.Rest, path, len(pattern.Elements)})
+		}
+
+	case *ast.HashPattern:
+		c.loadMatchPath(subject, path)
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+			c.emit(code.LoadConstant, c.addConstant(keys[i]))
+		}
+		c.emit(code.MatchHash, len(pattern.Keys))
+		*fails = append(*fails, c.emit(code.JumpIfFalse, 0xFFFF))
+
+		for i, key := range pattern.Keys {
+			sub := pattern.Patterns[i]
+			if sub == nil {
+				sub = key
+			}
+			err := c.compileMatchPattern(sub, subject, append(path, keys[i]), fails, binds)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.Null:
+		c.loadMatchPath(subject, path)
+		c.l++
+		err := c.Compile(pattern)
+		c.l--
+		if err != nil {
+			return err
+		}
+		c.emit(code.MatchValue)
+		*fails = append(*fails, c.emit(code.JumpIfFalse, 0xFFFF))
+
+	default:
+		return fmt.Errorf("invalid pattern %s", pattern)
+	}
+
+	return nil
+}
+
+// compileStruct compiles a struct declaration which binds the struct's name
+// to a new struct, copied from a template constant, before compiling its
+// methods so that they can refer to the struct
+func (c *Compiler) compileStruct(node *ast.StructLiteral) error {
+	fields := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		fields[i] = field.Value
+	}
+
+	template, err := object.NewStruct(node.Name.Value, fields)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := c.bindSymbol(node.Name)
+	if err != nil {
+		return err
+	}
+	c.emit(code.MakeStruct, c.addConstant(template))
+	c.emitBind(symbol)
+	c.emit(code.Pop)
+
+	c.loadSymbol(symbol)
+	for i, method := range node.Methods {
+		name := &object.String{Value: node.MethodNames[i].Value}
+		c.emit(code.LoadConstant, c.addConstant(name))
+
+		c.l++
+		err := c.Compile(method)
+		c.l--
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.DefineMethods, len(node.Methods)*2)
+
+	return nil
+}
+
+// emitBinaryOperator emits the instruction of the binary operator applied to
+// the two values on top of the stack
+func (c *Compiler) emitBinaryOperator(operator string) error {
+	switch operator {
+	case "+":
+		c.emit(code.Add)
+	case "-":
+		c.emit(code.Sub)
+	case "*":
+		c.emit(code.Mul)
+	case "/":
+		c.emit(code.Div)
+	case "%":
+		c.emit(code.Mod)
+	case "|":
+		c.emit(code.BitwiseOR)
+	case "^":
+		c.emit(code.BitwiseXOR)
+	case "&":
+		c.emit(code.BitwiseAND)
+	case "<<":
+		c.emit(code.LeftShift)
+	case ">>":
+		c.emit(code.RightShift)
+	case "**":
+		c.emit(code.Pow)
+	case "||":
+		c.emit(code.Or)
+	case "&&":
+		c.emit(code.And)
+	case ">":
+		c.emit(code.GreaterThan)
+	case ">=":
+		c.emit(code.GreaterThanEqual)
+	case "==":
+		c.emit(code.Equal)
+	case "!=":
+		c.emit(code.NotEqual)
+	default:
+		return fmt.Errorf("unknown operator %s", operator)
+	}
+
+	return nil
+}
+
+// compileCompoundAssignment compiles an assignment such as x += 1 or
+// xs[i] += 1. The object and index of an index expression are evaluated once
+// and duplicated to get the current value before setting the new value.
+func (c *Compiler) compileCompoundAssignment(node *ast.AssignmentExpression) error {
+	switch left := node.Left.(type) {
+	case *ast.Identifier:
+		symbol, err := c.assignSymbol(left)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+
+		c.l++
+		err = c.Compile(node.Value)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		err = c.emitBinaryOperator(node.Operator)
+		if err != nil {
+			return err
+		}
+		c.emitAssign(symbol)
+
+	case *ast.IndexExpression:
+		c.l++
+		err := c.Compile(left.Left)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		c.l++
+		err = c.Compile(left.Index)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.DupTwo)
+		c.emit(code.GetItem)
+
+		c.l++
+		err = c.Compile(node.Value)
+		c.l--
+		if err != nil {
+			return err
+		}
+
+		err = c.emitBinaryOperator(node.Operator)
+		if err != nil {
+			return err
+		}
+		c.emit(code.SetItem)
+
+	default:
+		return fmt.Errorf("expected identifier or index expression got=%s", node.Left)
+	}
+
+	return nil
+}
+
 func (c *Compiler) enterScope() {
 	scope := Scope{
 		instructions:        code.Instructions{},
+		sourceMap:           code.SourceMap{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
@@ -92,15 +756,16 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() code.Instructions {
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
 	instructions := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
 
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
 
 	c.symbolTable = c.symbolTable.Outer
 
-	return instructions
+	return instructions, sourceMap
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -117,6 +782,12 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
+// mark records that the next instruction emitted starts a statement on the
+// given source line
+func (c *Compiler) mark(line int) {
+	c.scopes[c.scopeIndex].sourceMap[len(c.currentInstructions())] = line
+}
+
 func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
@@ -199,20 +870,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.BindExpression:
-		var symbol Symbol
-
-		if ident, ok := node.Left.(*ast.Identifier); ok {
-			symbol, ok = c.symbolTable.Resolve(ident.Value)
-			if !ok {
-				symbol = c.symbolTable.Define(ident.Value)
+		switch left := node.Left.(type) {
+		case *ast.Identifier:
+			var (
+				symbol Symbol
+				err    error
+			)
+			if node.Const {
+				symbol, err = c.bindConstSymbol(left)
 			} else {
-				// Local shadowing of previously defined "free" variable in a
-				// function now begin rehound to a locally scopped variable.
-				if symbol.Scope == FreeScope {
-					symbol = c.symbolTable.Define(ident.Value)
-				}
+				symbol, err = c.bindSymbol(left)
+			}
+			if err != nil {
+				return err
 			}
 
+			c.l++
+			err = c.Compile(node.Value)
+			c.l--
+			if err != nil {
+				return err
+			}
+
+			c.emitBind(symbol)
+		case *ast.ArrayPattern, *ast.HashPattern:
 			c.l++
 			err := c.Compile(node.Value)
 			c.l--
@@ -220,34 +901,37 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			if symbol.Scope == GlobalScope {
-				c.emit(code.BindGlobal, symbol.Index)
-			} else {
-				c.emit(code.BindLocal, symbol.Index)
+			mode := destructureBind
+			if node.Parameter {
+				mode = destructureDefine
 			}
-		} else {
+			err = c.compileDestructuring(left, mode)
+			if err != nil {
+				return err
+			}
+		default:
 			return fmt.Errorf("expected identifier got=%s", node.Left)
 		}
 
 	case *ast.AssignmentExpression:
+		if node.Operator != "" {
+			return c.compileCompoundAssignment(node)
+		}
+
 		if ident, ok := node.Left.(*ast.Identifier); ok {
-			symbol, ok := c.symbolTable.Resolve(ident.Value)
-			if !ok {
-				return fmt.Errorf("undefined variable %s", ident.Value)
+			symbol, err := c.assignSymbol(ident)
+			if err != nil {
+				return err
 			}
 
 			c.l++
-			err := c.Compile(node.Value)
+			err = c.Compile(node.Value)
 			c.l--
 			if err != nil {
 				return err
 			}
 
-			if symbol.Scope == GlobalScope {
-				c.emit(code.AssignGlobal, symbol.Index)
-			} else {
-				c.emit(code.AssignLocal, symbol.Index)
-			}
+			c.emitAssign(symbol)
 		} else if ie, ok := node.Left.(*ast.IndexExpression); ok {
 			c.l++
 			err := c.Compile(ie.Left)
@@ -271,10 +955,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 
 			c.emit(code.SetItem)
+		} else if isPattern(node.Left) {
+			c.l++
+			err := c.Compile(node.Value)
+			c.l--
+			if err != nil {
+				return err
+			}
+
+			err = c.compileDestructuring(node.Left, destructureAssign)
+			if err != nil {
+				return err
+			}
 		} else {
 			return fmt.Errorf("expected identifier or index expression got=%s", node.Left)
 		}
 
+	case *ast.ArrayPattern, *ast.HashPattern:
+		return fmt.Errorf("unexpected destructuring pattern %s", node)
+
+	case *ast.SpreadExpression:
+		return fmt.Errorf("unexpected spread expression %s", node)
+
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
@@ -284,6 +986,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.loadSymbol(symbol)
 
 	case *ast.ExpressionStatement:
+		c.mark(node.Token.Line)
+
 		c.l++
 		err := c.Compile(node.Expression)
 		c.l--
@@ -312,51 +1016,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.IfExpression:
-		c.l++
-		err := c.Compile(node.Condition)
-		c.l--
+		err := c.compileIfExpression(node)
 		if err != nil {
 			return err
 		}
 
-		// Emit an `JumpIfFalse` with a bogus value
-		jumpIfFalsePos := c.emit(code.JumpIfFalse, 0xFFFF)
-
-		c.l++
-		err = c.Compile(node.Consequence)
-		c.l--
+	case *ast.MatchExpression:
+		err := c.compileMatch(node)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.Pop) {
-			c.removeLastPop()
-		}
-
-		// Emit an `Jump` with a bogus value
-		jumpPos := c.emit(code.Jump, 0xFFFF)
-
-		afterConsequencePos := len(c.currentInstructions())
-		c.changeOperand(jumpIfFalsePos, afterConsequencePos)
-
-		if node.Alternative == nil {
-			c.emit(code.LoadNull)
-		} else {
-			c.l++
-			err := c.Compile(node.Alternative)
-			c.l--
-			if err != nil {
-				return err
-			}
-
-			if c.lastInstructionIs(code.Pop) {
-				c.removeLastPop()
-			}
-		}
-
-		afterAlternativePos := len(c.currentInstructions())
-		c.changeOperand(jumpPos, afterAlternativePos)
-
 	case *ast.WhileExpression:
 		jumpConditionPos := len(c.currentInstructions())
 
@@ -441,37 +1111,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		switch node.Operator {
-		case "+":
-			c.emit(code.Add)
-		case "-":
-			c.emit(code.Sub)
-		case "*":
-			c.emit(code.Mul)
-		case "/":
-			c.emit(code.Div)
-		case "%":
-			c.emit(code.Mod)
-		case "|":
-			c.emit(code.BitwiseOR)
-		case "^":
-			c.emit(code.BitwiseXOR)
-		case "&":
-			c.emit(code.BitwiseAND)
-		case "||":
-			c.emit(code.Or)
-		case "&&":
-			c.emit(code.And)
-		case ">":
-			c.emit(code.GreaterThan)
-		case ">=":
-			c.emit(code.GreaterThanEqual)
-		case "==":
-			c.emit(code.Equal)
-		case "!=":
-			c.emit(code.NotEqual)
-		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+		err = c.emitBinaryOperator(node.Operator)
+		if err != nil {
+			return err
 		}
 
 	case *ast.IndexExpression:
@@ -491,16 +1133,33 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.GetItem)
 
-	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
+	case *ast.SliceExpression:
+		c.l++
+		err := c.Compile(node.Left)
+		c.l--
+		if err != nil {
+			return err
 		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
 
-		for _, k := range keys {
+		// Omitted bounds are passed as null
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.LoadNull)
+				continue
+			}
+
+			c.l++
+			err = c.Compile(bound)
+			c.l--
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.GetSlice)
+
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
 			c.l++
 			err := c.Compile(k)
 			c.l--
@@ -529,12 +1188,27 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.MakeArray, len(node.Elements))
 
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			c.l++
+			err := c.Compile(part)
+			c.l--
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.BuildString, len(node.Parts))
+
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.LoadConstant, c.addConstant(str))
 
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
 		c.emit(code.LoadConstant, c.addConstant(integer))
 
 	case *ast.FunctionLiteral:
@@ -556,6 +1230,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		for _, p := range node.Parameters {
 			c.symbolTable.Define(p.Value)
 		}
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
 
 		c.l++
 		err := c.Compile(node.Body)
@@ -568,19 +1245,38 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.replaceLastPopWithReturn()
 		}
 
-		// If the function doesn't end with a return statement add one with a
-		// `return null;` and also handle the edge-case of empty functions.
+		// If the function doesn't end with a return statement implicitly
+		// return the value of the body's last expression (the block statement
+		// leaves a `null` on the stack for empty bodies)
 		if !c.lastInstructionIs(code.Return) {
-			// empty function body (LoadNull from BlockStatement)
-			if !c.lastInstructionIs(code.LoadNull) {
-				c.emit(code.LoadNull)
-			}
 			c.emit(code.Return)
 		}
 
+		// Calls with missing arguments enter the function at the entry
+		// evaluating the first missing default, placed after the body, and
+		// fall through the remaining defaults before jumping to the body
+		var entries []int
+		optional := len(node.Parameters) - len(node.Defaults)
+		for i, d := range node.Defaults {
+			entries = append(entries, len(c.currentInstructions()))
+
+			c.l++
+			err := c.Compile(d)
+			c.l--
+			if err != nil {
+				return err
+			}
+
+			c.emit(code.BindLocal, optional+i)
+			c.emit(code.Pop)
+		}
+		if len(entries) > 0 {
+			c.emit(code.Jump, 0)
+		}
+
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
+		instructions, sourceMap := c.leaveScope()
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
@@ -588,13 +1284,26 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
+			SourceMap:     sourceMap,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			NumDefaults:   len(node.Defaults),
+			Entries:       entries,
+			Variadic:      node.Rest != nil,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.MakeClosure, fnIndex, len(freeSymbols))
 
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals must be bound to a name at the top level")
+
+	case *ast.StructLiteral:
+		err := c.compileStruct(node)
+		if err != nil {
+			return err
+		}
+
 	case *ast.CallExpression:
 		c.l++
 		err := c.Compile(node.Function)
@@ -603,6 +1312,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadArguments(node.Arguments)
+		}
+
 		for _, a := range node.Arguments {
 			c.l++
 			err := c.Compile(a)
@@ -615,6 +1328,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.Call, len(node.Arguments))
 
 	case *ast.ReturnStatement:
+		c.mark(node.Token.Line)
+
 		c.l++
 		err := c.Compile(node.ReturnValue)
 		c.l--
@@ -641,11 +1356,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 		Constants:    c.constants,
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
+	SourceMap    code.SourceMap
 	Constants    []object.Object
 }
@@ -103,6 +103,8 @@ func testConstants2(t *testing.T, expected []interface{}, actual []object.Object
 			assert.Equal(constant, actual[i].(*object.String).Value)
 		case int:
 			assert.Equal(int64(constant), actual[i].(*object.Integer).Value)
+		case *object.Struct:
+			assert.Equal(constant.Inspect(), actual[i].Inspect())
 		}
 	}
 }
@@ -302,6 +304,39 @@ func TestIntegerArithmetic(t *testing.T) {
 			},
 		},
 
+		{
+			input:             "1 << 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.LeftShift),
+				code.Make(code.Pop),
+			},
+		},
+
+		{
+			input:             "4 >> 1",
+			expectedConstants: []interface{}{4, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.RightShift),
+				code.Make(code.Pop),
+			},
+		},
+
+		{
+			input:             "2 ** 3",
+			expectedConstants: []interface{}{2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.Pow),
+				code.Make(code.Pop),
+			},
+		},
+
 		{
 			input:             "-1",
 			expectedConstants: []interface{}{1},
@@ -479,6 +514,84 @@ func TestConditionals(t *testing.T) {
 			constants:    []interface{}{0, 1, 2},
 			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n0007 LoadTrue\n0008 JumpIfFalse 20\n0011 LoadConstant 1\n0014 AssignGlobal 0\n0017 Jump 21\n0020 LoadNull\n0021 Pop\n0022 LoadFalse\n0023 JumpIfFalse 35\n0026 LoadConstant 2\n0029 AssignGlobal 0\n0032 Jump 36\n0035 LoadNull\n0036 Pop\n",
 		},
+		{
+			input: `
+            if (true) { 10 } else if (false) { 20 } else { 30 }; 3333;
+            `,
+			constants: []interface{}{10, 20, 30, 3333},
+			instructions: "0000 LoadTrue\n0001 JumpIfFalse 10\n0004 LoadConstant 0\n0007 Jump 23\n" +
+				"0010 LoadFalse\n0011 JumpIfFalse 20\n0014 LoadConstant 1\n0017 Jump 23\n" +
+				"0020 LoadConstant 2\n0023 Pop\n0024 LoadConstant 3\n0027 Pop\n",
+		},
+		{
+			input: `
+            if (true) { 10 } else if (false) { 20 }
+            `,
+			constants: []interface{}{10, 20},
+			instructions: "0000 LoadTrue\n0001 JumpIfFalse 10\n0004 LoadConstant 0\n0007 Jump 21\n" +
+				"0010 LoadFalse\n0011 JumpIfFalse 20\n0014 LoadConstant 1\n0017 Jump 21\n" +
+				"0020 LoadNull\n0021 Pop\n",
+		},
+	}
+
+	runCompilerTests2(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase2{
+		{
+			input:     `match (1) { 1 => 2, [x, ...r] if x => r, _ => 3 }`,
+			constants: []interface{}{1, 1, 2, 0, 1, 3},
+			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n" +
+				"0007 LoadGlobal 0\n0010 LoadConstant 1\n0013 MatchValue\n0014 JumpIfFalse 23\n" +
+				"0017 LoadConstant 2\n0020 Jump 75\n" +
+				"0023 LoadGlobal 0\n0026 MatchArray 1 1\n0030 JumpIfFalse 68\n" +
+				"0033 LoadGlobal 0\n0036 LoadConstant 3\n0039 GetItem\n0040 BindGlobal 1\n0043 Pop\n" +
+				"0044 LoadGlobal 0\n0047 LoadConstant 4\n0050 LoadNull\n0051 GetSlice\n0052 BindGlobal 2\n0055 Pop\n" +
+				"0056 LoadGlobal 1\n0059 JumpIfFalse 68\n" +
+				"0062 LoadGlobal 2\n0065 Jump 75\n" +
+				"0068 LoadConstant 5\n0071 Jump 75\n" +
+				"0074 LoadNull\n0075 Pop\n",
+		},
+		{
+			input:     `match ("a") { "a" | "b" => 1, {k} => k }`,
+			constants: []interface{}{"a", "a", "b", 1, "k", "k"},
+			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n" +
+				"0007 LoadGlobal 0\n0010 LoadConstant 1\n0013 MatchValue\n0014 JumpIfFalse 20\n0017 Jump 30\n" +
+				"0020 LoadGlobal 0\n0023 LoadConstant 2\n0026 MatchValue\n0027 JumpIfFalse 36\n" +
+				"0030 LoadConstant 3\n0033 Jump 66\n" +
+				"0036 LoadGlobal 0\n0039 LoadConstant 4\n0042 MatchHash 1\n0045 JumpIfFalse 65\n" +
+				"0048 LoadGlobal 0\n0051 LoadConstant 5\n0054 GetItem\n0055 BindGlobal 1\n0058 Pop\n" +
+				"0059 LoadGlobal 1\n0062 Jump 66\n" +
+				"0065 LoadNull\n0066 Pop\n",
+		},
+	}
+
+	runCompilerTests2(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	point, _ := object.NewStruct("Point", []string{"x", "y"})
+
+	tests := []compilerTestCase2{
+		{
+			input:     `struct Point { x, y }`,
+			constants: []interface{}{point},
+			instructions: "0000 MakeStruct 0\n0003 BindGlobal 0\n0006 Pop\n" +
+				"0007 LoadGlobal 0\n0010 DefineMethods 0\n0013 Pop\n",
+		},
+		{
+			input: `struct Point { x, y, fn getX() { self.x } }`,
+			constants: []interface{}{
+				point,
+				"getX",
+				"x",
+				Instructions("0000 LoadLocal 0\n0002 LoadConstant 2\n0005 GetItem\n0006 Return\n"),
+			},
+			instructions: "0000 MakeStruct 0\n0003 BindGlobal 0\n0006 Pop\n" +
+				"0007 LoadGlobal 0\n0010 LoadConstant 1\n0013 MakeClosure 3 0\n" +
+				"0017 DefineMethods 2\n0020 Pop\n",
+		},
 	}
 
 	runCompilerTests2(t, tests)
@@ -565,6 +678,19 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.Pop),
 			},
 		},
+		{
+			input:             `"x=${1 + 2}!"`,
+			expectedConstants: []interface{}{"x=", 1, 2, "!"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.LoadConstant, 2),
+				code.Make(code.Add),
+				code.Make(code.LoadConstant, 3),
+				code.Make(code.BuildString, 3),
+				code.Make(code.Pop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -653,6 +779,18 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.Pop),
 			},
 		},
+		{
+			input:             `{"b": 1, "a": 2}`,
+			expectedConstants: []interface{}{"b", 1, "a", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.LoadConstant, 2),
+				code.Make(code.LoadConstant, 3),
+				code.Make(code.MakeHash, 4),
+				code.Make(code.Pop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -677,6 +815,63 @@ func TestSelectorExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[a, ...b] := [1, 2]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.MakeArray, 2),
+				code.Make(code.UnpackArray, 1, 1),
+				code.Make(code.BindGlobal, 0),
+				code.Make(code.Pop),
+				code.Make(code.BindGlobal, 1),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			input:             `h := {"a": 1}; {a} := h`,
+			expectedConstants: []interface{}{"a", 1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.MakeHash, 2),
+				code.Make(code.BindGlobal, 0),
+				code.Make(code.Pop),
+				code.Make(code.LoadGlobal, 0),
+				code.Make(code.LoadConstant, 2),
+				code.Make(code.UnpackHash, 1),
+				code.Make(code.BindGlobal, 1),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			input:             "a := 1; b := 2; [a, b] = [b, a]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.BindGlobal, 0),
+				code.Make(code.Pop),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.BindGlobal, 1),
+				code.Make(code.Pop),
+				code.Make(code.LoadGlobal, 1),
+				code.Make(code.LoadGlobal, 0),
+				code.Make(code.MakeArray, 2),
+				code.Make(code.UnpackArray, 2, 0),
+				code.Make(code.AssignGlobal, 0),
+				code.Make(code.Pop),
+				code.Make(code.AssignGlobal, 1),
+				code.Make(code.Pop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -708,6 +903,32 @@ func TestIndexExpressions(t *testing.T) {
 				code.Make(code.Pop),
 			},
 		},
+		{
+			input:             "[1, 2, 3][1:]",
+			expectedConstants: []interface{}{1, 2, 3, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.LoadConstant, 2),
+				code.Make(code.MakeArray, 3),
+				code.Make(code.LoadConstant, 3),
+				code.Make(code.LoadNull),
+				code.Make(code.GetSlice),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			input:             `"monkey"[:-1]`,
+			expectedConstants: []interface{}{"monkey", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.LoadConstant, 0),
+				code.Make(code.LoadNull),
+				code.Make(code.LoadConstant, 1),
+				code.Make(code.Minus),
+				code.Make(code.GetSlice),
+				code.Make(code.Pop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -774,6 +995,46 @@ func TestFunctionsWithoutReturn(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1; x = 2", "cannot assign to constant x"},
+		{"const x = 1; x += 2", "cannot assign to constant x"},
+		{"const x = 1; x := 2", "cannot assign to constant x"},
+		{"const x = 1; const x = 2", "cannot assign to constant x"},
+		{"const x = 1; [x, y] = [1, 2]", "cannot assign to constant x"},
+		{"const x = 1; [x, y] := [1, 2]", "cannot assign to constant x"},
+		{"const x = 1; f := fn() { x = 2 }", "cannot assign to constant x"},
+		{"const P = 1; struct P { x }", "cannot assign to constant P"},
+		{"const x = 1; match (5) { x => x }", "cannot assign to constant x"},
+		{"f := fn() { const x = 1; fn() { x += 1 } }", "cannot assign to constant x"},
+		{"len = 1", "cannot assign to constant len"},
+		{"len *= 1", "cannot assign to constant len"},
+		{"len := 1; len = 2", ""},
+		{"x := 1; const x = 2", ""},
+		{"const x = 1; f := fn(x) { x = 2 }", ""},
+		{"const x = 1; f := fn() { x := 2 }", ""},
+		{"const x = 1; f := fn() { const x = 2 }", ""},
+		{"const x = 1; f := fn() { [x, y] := [2, 3] }", ""},
+		{"f := fn() { const n = 1; fn() { n := 2 } }", ""},
+		{"f := fn() { const x = 1; x := 2 }", "cannot assign to constant x"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			}
+		} else if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestCompilerScopes(t *testing.T) {
 	compiler := New()
 	if compiler.scopeIndex != 0 {
@@ -888,6 +1149,43 @@ func TestFunctionCalls(t *testing.T) {
 	runCompilerTests2(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []compilerTestCase2{
+		{
+			input: `fn(a, b = 10) { a + b }`,
+			constants: []interface{}{
+				10,
+				Instructions("0000 LoadLocal 0\n0002 LoadLocal 1\n0004 Add\n0005 Return\n0006 LoadConstant 0\n0009 BindLocal 1\n0011 Pop\n0012 Jump 0\n"),
+			},
+			instructions: "0000 MakeClosure 1 0\n0004 Pop\n",
+		},
+		{
+			input: `fn(a, ...rest) { rest }`,
+			constants: []interface{}{
+				Instructions("0000 LoadLocal 1\n0002 Return\n"),
+			},
+			instructions: "0000 MakeClosure 0 0\n0004 Pop\n",
+		},
+	}
+
+	runCompilerTests2(t, tests)
+}
+
+func TestSpreadArguments(t *testing.T) {
+	tests := []compilerTestCase2{
+		{
+			input: `f := len; xs := []; f(1, ...xs, 2)`,
+			constants: []interface{}{
+				1,
+				2,
+			},
+			instructions: "0000 LoadBuiltin 19\n0002 BindGlobal 0\n0005 Pop\n0006 MakeArray 0\n0009 BindGlobal 1\n0012 Pop\n0013 LoadGlobal 0\n0016 LoadConstant 0\n0019 MakeArray 1\n0022 LoadGlobal 1\n0025 ExtendArray\n0026 LoadConstant 1\n0029 MakeArray 1\n0032 ExtendArray\n0033 CallSpread\n0034 Pop\n",
+		},
+	}
+
+	runCompilerTests2(t, tests)
+}
+
 func TestAssignmentExpressions(t *testing.T) {
 	tests := []compilerTestCase2{
 		{
@@ -898,6 +1196,22 @@ func TestAssignmentExpressions(t *testing.T) {
 			constants:    []interface{}{1, 2},
 			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n0007 LoadConstant 1\n0010 AssignGlobal 0\n0013 Pop\n",
 		},
+		{
+			input: `
+			x := 1
+			x += 2
+			`,
+			constants:    []interface{}{1, 2},
+			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n0007 LoadGlobal 0\n0010 LoadConstant 1\n0013 Add\n0014 AssignGlobal 0\n0017 Pop\n",
+		},
+		{
+			input: `
+			xs := [1]
+			xs[0] *= 2
+			`,
+			constants:    []interface{}{1, 0, 2},
+			instructions: "0000 LoadConstant 0\n0003 MakeArray 1\n0006 BindGlobal 0\n0009 Pop\n0010 LoadGlobal 0\n0013 LoadConstant 1\n0016 DupTwo\n0017 GetItem\n0018 LoadConstant 2\n0021 Mul\n0022 SetItem\n0023 Pop\n",
+		},
 	}
 
 	runCompilerTests2(t, tests)
@@ -913,7 +1227,7 @@ func TestAssignmentStatementScopes(t *testing.T) {
 			constants: []interface{}{
 				0,
 				55,
-				Instructions("0000 LoadConstant 1\n0003 AssignGlobal 0\n0006 LoadNull\n0007 Return\n"),
+				Instructions("0000 LoadConstant 1\n0003 AssignGlobal 0\n0006 Return\n"),
 			},
 			instructions: "0000 LoadConstant 0\n0003 BindGlobal 0\n0006 Pop\n0007 MakeClosure 2 0\n0011 Pop\n",
 		},
@@ -924,7 +1238,7 @@ func TestAssignmentStatementScopes(t *testing.T) {
 			constants: []interface{}{
 				0,
 				55,
-				Instructions("0000 LoadConstant 0\n0003 BindLocal 0\n0005 Pop\n0006 LoadConstant 1\n0009 AssignLocal 0\n0011 LoadNull\n0012 Return\n"),
+				Instructions("0000 LoadConstant 0\n0003 BindLocal 0\n0005 Pop\n0006 LoadConstant 1\n0009 AssignLocal 0\n0011 Return\n"),
 			},
 			instructions: "0000 MakeClosure 2 0\n0004 Pop\n",
 		},
@@ -999,11 +1313,11 @@ func TestBuiltins(t *testing.T) {
             `,
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.LoadBuiltin, 10),
+				code.Make(code.LoadBuiltin, 19),
 				code.Make(code.MakeArray, 0),
 				code.Make(code.Call, 1),
 				code.Make(code.Pop),
-				code.Make(code.LoadBuiltin, 14),
+				code.Make(code.LoadBuiltin, 24),
 				code.Make(code.MakeArray, 0),
 				code.Make(code.LoadConstant, 0),
 				code.Make(code.Call, 2),
@@ -1014,7 +1328,7 @@ func TestBuiltins(t *testing.T) {
 			input: `fn() { return len([]) }`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.LoadBuiltin, 10),
+					code.Make(code.LoadBuiltin, 19),
 					code.Make(code.MakeArray, 0),
 					code.Make(code.Call, 1),
 					code.Make(code.Return),
@@ -1096,3 +1410,24 @@ func TestClosures(t *testing.T) {
 
 	runCompilerTests2(t, tests)
 }
+
+func FuzzCompile(f *testing.F) {
+	f.Add(`x := 5; f := fn(a, b) { a + b }; f(x, 2)`)
+	f.Add(`if (x) { 1 } else if (y) { 2 } else { 3 }`)
+	f.Add(`f := fn() { g := fn() { x = 1 }; x := 2; g }`)
+	f.Add(`{"a": [1, 2]}.a[0] = len`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		c := New()
+		if err := c.Compile(program); err != nil {
+			return
+		}
+		_ = c.Bytecode().Instructions.String()
+	})
+}
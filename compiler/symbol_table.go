@@ -13,6 +13,7 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	Const bool // true for constants and builtins which cannot be assigned
 }
 
 type SymbolTable struct {
@@ -45,6 +46,7 @@ func (s *SymbolTable) DefineFree(original Symbol) Symbol {
 
 	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
 	symbol.Scope = FreeScope
+	symbol.Const = original.Const
 
 	s.store[original.Name] = symbol
 	return symbol
@@ -63,8 +65,16 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// DefineConst defines name as a constant
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
-	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope, Const: true}
 	s.store[name] = symbol
 	return symbol
 }
@@ -160,10 +160,10 @@ func TestDefineResolveBuiltins(t *testing.T) {
 	secondLocal := NewEnclosedSymbolTable(firstLocal)
 
 	expected := []Symbol{
-		Symbol{Name: "a", Scope: BuiltinScope, Index: 0},
-		Symbol{Name: "c", Scope: BuiltinScope, Index: 1},
-		Symbol{Name: "e", Scope: BuiltinScope, Index: 2},
-		Symbol{Name: "f", Scope: BuiltinScope, Index: 3},
+		Symbol{Name: "a", Scope: BuiltinScope, Index: 0, Const: true},
+		Symbol{Name: "c", Scope: BuiltinScope, Index: 1, Const: true},
+		Symbol{Name: "e", Scope: BuiltinScope, Index: 2, Const: true},
+		Symbol{Name: "f", Scope: BuiltinScope, Index: 3, Const: true},
 	}
 
 	for i, v := range expected {
@@ -299,3 +299,26 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	nested := NewEnclosedSymbolTable(local)
+
+	a := global.DefineConst("a")
+	b := local.DefineConst("b")
+
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0, Const: true}) {
+		t.Errorf("unexpected symbol for a. got=%+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0, Const: true}) {
+		t.Errorf("unexpected symbol for b. got=%+v", b)
+	}
+
+	// Constants stay constant when resolved as free variables
+	result, _ := nested.Resolve("b")
+	expected := Symbol{Name: "b", Scope: FreeScope, Index: 0, Const: true}
+	if result != expected {
+		t.Errorf("expected b to resolve to %+v, got=%+v", expected, result)
+	}
+}
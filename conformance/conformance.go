@@ -0,0 +1,292 @@
+// Package conformance implements a differential test harness that runs Monkey
+// programs through the tree-walking evaluator (eval), the stack based
+// compiler and virtual machine (vm) and the register based compiler and
+// virtual machine (rvm) and reports where the virtual machines diverge from
+// the evaluator in the value produced, the text printed or the kind of error
+// raised.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/eval"
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+	"github.com/prologic/monkey-lang/rvm"
+	"github.com/prologic/monkey-lang/vm"
+)
+
+// Error kinds used to classify errors of any engine
+const (
+	KindNone      = ""
+	KindParse     = "parse"
+	KindUndefined = "undefined"
+	KindArguments = "arguments"
+	KindType      = "type"
+	KindIndex     = "index"
+	KindDivision  = "division"
+	KindExit      = "exit"
+	KindPanic     = "panic"
+	KindOther     = "other"
+)
+
+var kinds = []struct {
+	kind     string
+	prefixes []string
+}{
+	{KindUndefined, []string{"undefined variable", "identifier not found"}},
+	{KindArguments, []string{"wrong number of arguments"}},
+	{KindDivision, []string{"division by zero"}},
+	{KindIndex, []string{"index out of bounds", "index operator not supported"}},
+	{KindType, []string{
+		"unsupported types", "type mismatch", "unknown operator",
+		"unknown string operator",
+		"unusable as hash key", "not a function", "calling non-closure",
+		"expected int", "argument to", "argument #",
+	}},
+}
+
+// ErrorKind classifies an error message of any engine into a kind
+func ErrorKind(message string) string {
+	for _, k := range kinds {
+		for _, prefix := range k.prefixes {
+			if strings.HasPrefix(message, prefix) {
+				return k.kind
+			}
+		}
+	}
+	return KindOther
+}
+
+// Result is the outcome of running a program with one engine
+type Result struct {
+	Value   string
+	Output  string
+	Kind    string
+	Message string
+}
+
+func (r Result) String() string {
+	if r.Kind != KindNone {
+		return fmt.Sprintf("error(%s: %s) output=%q", r.Kind, r.Message, r.Output)
+	}
+	return fmt.Sprintf("value=%s output=%q", r.Value, r.Output)
+}
+
+// Divergences returns a description of each way the results differ
+func (r Result) Divergences(other Result) []string {
+	var diffs []string
+
+	if r.Kind != other.Kind {
+		diffs = append(diffs, fmt.Sprintf("error kind: %q != %q (%q vs %q)",
+			r.Kind, other.Kind, r.Message, other.Message))
+	} else if r.Kind == KindNone && r.Value != other.Value {
+		diffs = append(diffs, fmt.Sprintf("value: %s != %s", r.Value, other.Value))
+	}
+
+	if r.Output != other.Output {
+		diffs = append(diffs, fmt.Sprintf("output: %q != %q", r.Output, other.Output))
+	}
+
+	return diffs
+}
+
+// exit is used to unwind an engine when the program calls exit()
+type exit struct {
+	status int
+}
+
+// capture runs f with the standard input empty, the standard output captured
+// and exit() unwinding the engine and fills in the result's output and exit
+// status. A panic of the engine is recorded as an error of kind KindPanic.
+func capture(result *Result, f func()) {
+	stdin, stdout, exitFunction := object.StandardInput, object.StandardOutput, object.ExitFunction
+
+	var output bytes.Buffer
+	object.StandardInput = strings.NewReader("")
+	object.StandardOutput = &output
+	object.ExitFunction = func(status int) { panic(exit{status}) }
+
+	defer func() {
+		object.StandardInput, object.StandardOutput, object.ExitFunction = stdin, stdout, exitFunction
+		result.Output = output.String()
+
+		if err := recover(); err != nil {
+			if e, ok := err.(exit); ok {
+				result.Kind = KindExit
+				result.Message = fmt.Sprintf("exit status %d", e.status)
+			} else {
+				result.Kind = KindPanic
+				result.Message = fmt.Sprint(err)
+			}
+		}
+	}()
+
+	f()
+}
+
+func (r *Result) setValue(obj object.Object) {
+	if err, ok := obj.(*object.Error); ok {
+		r.setError(err.Message)
+		return
+	}
+	r.Value = Inspect(obj)
+}
+
+func (r *Result) setError(message string) {
+	r.Kind = ErrorKind(message)
+	r.Message = message
+}
+
+// expandMacros defines the macros of program and expands all macro calls
+// within it
+func expandMacros(program *ast.Program) error {
+	macros := object.NewEnvironment()
+	eval.DefineMacros(program, macros)
+	_, err := eval.ExpandMacros(program, macros)
+	return err
+}
+
+// Eval runs the program given by input with the evaluator
+func Eval(input string) (result Result) {
+	program := parse(input, &result)
+	if program == nil {
+		return
+	}
+
+	capture(&result, func() {
+		obj := eval.Eval(program, object.NewEnvironment())
+		if obj == nil {
+			obj = eval.NULL
+		}
+		result.setValue(obj)
+	})
+
+	return
+}
+
+// parse parses the program given by input and expands its macros, recording
+// any error in result
+func parse(input string, result *Result) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		*result = Result{Kind: KindParse, Message: strings.Join(p.Errors(), "; ")}
+		return nil
+	}
+
+	if err := expandMacros(program); err != nil {
+		result.setError(err.Error())
+		return nil
+	}
+
+	return program
+}
+
+// VM runs the program given by input with the compiler and virtual machine
+func VM(input string) (result Result) {
+	program := parse(input, &result)
+	if program == nil {
+		return
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		result.setError(err.Error())
+		return
+	}
+
+	capture(&result, func() {
+		machine := vm.New(c.Bytecode())
+		if err := machine.Run(); err != nil {
+			result.setError(err.Error())
+			return
+		}
+		result.setValue(machine.LastPopped())
+	})
+
+	return
+}
+
+// RVM runs the program given by input with the register based compiler and
+// virtual machine
+func RVM(input string) (result Result) {
+	program := parse(input, &result)
+	if program == nil {
+		return
+	}
+
+	c := rvm.NewCompiler()
+	if err := c.Compile(program); err != nil {
+		result.setError(err.Error())
+		return
+	}
+
+	capture(&result, func() {
+		machine := rvm.New(c.Bytecode())
+		if err := machine.Run(); err != nil {
+			result.setError(err.Error())
+			return
+		}
+		result.setValue(machine.Result())
+	})
+
+	return
+}
+
+// Engines are the virtual machines whose results are compared with those of
+// the evaluator
+var Engines = []struct {
+	Name string
+	Run  func(input string) Result
+}{
+	{"vm", VM},
+	{"rvm", RVM},
+}
+
+// Inspect returns a representation of obj that is the same for equal values
+// produced by any engine. Functions are represented as `<fn>` and hash
+// pairs are in insertion order, which all engines must preserve.
+func Inspect(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Function, *object.Closure, *rvm.Closure:
+		return "<fn>"
+
+	case *object.Array:
+		elements := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = Inspect(el)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Items() {
+			pairs = append(pairs, Inspect(pair.Key)+": "+Inspect(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	default:
+		return obj.Inspect()
+	}
+}
+
+// Compare runs the program given by input with every engine and returns
+// the divergences from the evaluator found, if any, each prefixed with the
+// name of the engine
+func Compare(input string) []string {
+	expected := Eval(input)
+
+	var diffs []string
+	for _, engine := range Engines {
+		for _, diff := range expected.Divergences(engine.Run(input)) {
+			diffs = append(diffs, engine.Name+": "+diff)
+		}
+	}
+	return diffs
+}
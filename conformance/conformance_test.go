@@ -0,0 +1,357 @@
+package conformance
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// snippets is a corpus of small programs covering the language
+var snippets = []string{
+	// literals and expressions
+	`1`,
+	`-5`,
+	`1 + 2 * 3 - 4 / 2`,
+	`(5 + 10 * 2 + 15 / 3) * 2 + -10`,
+	`7 % 3`,
+	`true`,
+	`!true`,
+	`!!5`,
+	`1 < 2 == true`,
+	`1 >= 1 && 2 <= 1`,
+	`false || true`,
+	`if (true && false) { 1 } else { 2 }`,
+	`"a" == "a"`,
+	`"foo" + "bar"`,
+	`"abc" * 3`,
+	`[1, 2] + [3]`,
+	`[1, 2] == [1, 2]`,
+	`{"a": 1} == {"a": 1}`,
+	`{"a": 1} == {"a": 2}`,
+	`null`,
+	`if (false) { 1 }`,
+	`if (1 > 2) { 10 } else { 20 }`,
+	`if (false) { 1 } else if (true) { 2 } else { 3 }`,
+	`sign := fn(n) { if (n < 0) { "-" } else if (n == 0) { "0" } else if (n < 10) { "small" } }; [sign(-1), sign(0), sign(5), sign(50)]`,
+	`x := 0; if (false) { x = 1 } else if (x / 0) { x = 2 }`,
+
+	// bindings and assignment
+	`x := 5; x`,
+	`x := 5; x = x + 1; x`,
+	`a := [1, 2]; b := a; b[0] = 9; a`,
+	`h := {"a": 1}; h["b"] = 2; h`,
+	`h := {"a": {"b": 1}}; h.a.b`,
+	`x := 1; f := fn() { x = 2 }; f(); x`,
+
+	// functions and closures
+	`f := fn(x) { x * 2 }; f(4)`,
+	`f := fn(x) { return x * 2; 0 }; f(4)`,
+	`fn() {}()`,
+	`f := fn() { }; f`,
+	`add := fn(a) { fn(b) { a + b } }; add(1)(2)`,
+	`fact := fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)`,
+	`fib := fn(n) { if (n < 2) { return n } return fib(n-1) + fib(n-2) }; fib(15)`,
+	`counter := fn() { n := 0; fn() { n = n + 1; n } }; c := counter(); c(); c()`,
+
+	// loops
+	`i := 0; while (i < 10) { i = i + 1 }; i`,
+	`xs := []; i := 0; while (i < 3) { xs = push(xs, i); i = i + 1 }; xs`,
+
+	// builtins
+	`len("hello")`,
+	`len([1, 2, 3])`,
+	`first([1, 2])`,
+	`last([1, 2])`,
+	`rest([1, 2, 3])`,
+	`push([1], 2)`,
+	`pop([1, 2])`,
+	`str(10)`,
+	`int("42")`,
+	`bool(0)`,
+	`typeof(1)`,
+	`typeof("")`,
+	`typeof([])`,
+	`typeof({})`,
+	`typeof(fn() {})`,
+	`typeof(len)`,
+	`upper("abc")`,
+	`lower("ABC")`,
+	`split("a,b", ",")`,
+	`join(["a", "b"], "-")`,
+	`find("hello", "l")`,
+	`abs(-3)`,
+	`min(3, 1)`,
+	`max(3, 1)`,
+	`divmod(7, 2)`,
+	`print("hello", 1)`,
+	`print("a"); print("b"); 1`,
+	`input()`,
+	`exit(3)`,
+
+	// errors
+	`y`,
+	`1 + true`,
+	`-true`,
+	`"a" - "b"`,
+	`[1][5]`,
+	`{"a": 1}["b"]`,
+	`{[1]: 2}`,
+	`5()`,
+	`fn(x) { x }()`,
+	`len(1)`,
+	`len(1); print("after")`,
+	`len("a", "b")`,
+	`first(1)`,
+	`1 / 0`,
+	`1 % 0`,
+	`"a" * -1`,
+
+	// Array repetition
+	`[[1, 2] * 0, [1, 2] * -1, [1, 2] * 1, [1, 2] * 3, 2 * [1], [] * 5]`,
+	`xs := [1, 2]; ys := xs * 1; ys[0] = 9; [xs, ys]`,
+	`len([0] * 100000000)`,
+
+	// Unicode
+	`s := "héllo, 世界"; [len(s), s[1], s[8], s[9]]`,
+	`[ord("世"), chr(19990), bytes("é"), find("世界", "界")]`,
+	`größe := 1; größe + 1`,
+	`"\u{48}\u{1F600}"`,
+	`ord("ab")`,
+	`chr(-1)`,
+
+	// String interpolation
+	`x := 1; y := 2; "x=${x}, sum=${x + y}"`,
+	`"${"a"}${true}${null}${[1, "b"]}${{"k": 1}}"`,
+	`"\${x}\t${"}"}"`,
+	`"${x}"`,
+	`f := fn(n) { "n=${n * 2}" }; f(21)`,
+
+	// Macros
+	`unless := macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, "a", "b")`,
+	`reverse := macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)`,
+	`twice := macro(x) { quote(unquote(x) + unquote(x)) }; f := fn(y) { twice(y * 2) }; f(3)`,
+	`n := macro() { quote(unquote(2 * 21)) }; [n(), n()]`,
+	`m := macro(x) { quote(x) }; m()`,
+	`quote(1 + 2)`,
+	`f := fn() { quote(1) }; f()`,
+	`quote := fn(x) { x }; quote(1)`,
+	`f := fn(quote) { quote(2) }; f(fn(x) { x * 3 })`,
+	`struct quote { x }; quote(1).x`,
+
+	// Slices
+	`xs := [1, 2, 3, 4]; [xs[1:3], xs[:2], xs[2:], xs[:], xs[-2:], xs[:-1], xs[3:1]]`,
+	`s := "héllo, 世界"; [s[1:5], s[:-2], s[-2:], s[20:]]`,
+	`xs := [1, 2, 3]; ys := xs[:]; ys[0] = 4; [xs, ys]`,
+	`[1, 2, 3]["a":]`,
+	`{"a": 1}[1:2]`,
+
+	// Destructuring
+	`[a, b, ...rest] := [1, 2, 3, 4]; [a, b, rest]`,
+	`{name, age} := {"name": "Bob", "age": 42}; [name, age]`,
+	`[[a, b], {c}] := [[1, 2], {"c": 3}]; a + b + c`,
+	`a := 1; b := 2; [a, b] = [b, a]; [a, b]`,
+	`f := fn([a, ...b], {c}) { [a, b, c] }; f([1, 2, 3], {"c": 4})`,
+	`c := 9; f := fn(a, b = c, c = 3) { b }; f(1)`,
+	`f := fn(a, b = a * 2) { b }; f(1)`,
+	`x := 1; y := 2; f := fn([x], {y}) { [x, y] }; [f([5], {"y": 6}), x, y]`,
+	`const x = 1; f := fn([x]) { x }; [f([5]), x]`,
+	`[a, b] := [1]`,
+	`[a, ...b] := []`,
+	`{a} := {"b": 1}`,
+	`[a] := 1`,
+
+	// Default and rest parameters
+	`f := fn(a, b = a + 1, ...rest) { [a, b, rest] }; [f(1), f(1, 5), f(1, 2, 3, 4)]`,
+	`f := fn(a, b, c) { [a, b, c] }; xs := [2, 3]; [f(...[1, 2, 3]), f(1, ...xs)]`,
+	`f := fn(n, acc = 0) { if (n == 0) { return acc } return f(n - 1, acc + n) }; f(1000)`,
+	`fn(a, b = 1) { a }()`,
+	`fn(a, b = 1) { a }(1, 2, 3)`,
+	`len(...1)`,
+
+	// Match expressions
+	`f := fn(v) { match (v) { 1 => "one", "a" | "b" => "ab", [] => "empty", [x, ...xs] if x > 1 => xs, [x, y] => x + y, {kind: "k", v} => v, _ => "other" } }; [f(1), f("b"), f([]), f([2, 3, 4]), f([1, 2]), f({"kind": "k", "v": 5}), f(null)]`,
+	`match (2) { 1 => "one" }`,
+	`x := [1, 2]; y := match (x) { [a, x] => a + x }; [x, y]`,
+	`match (1) { x if x / 0 => x }`,
+	`x := 10; f := fn() { match (5) { x => x }; x }; [f(), x]`,
+	`x := 10; f := fn() { y := match ([5, 6]) { [x, z] if x < z => x + z }; [x, y] }; [f(), x]`,
+	`x := 10; f := fn() { g := fn() { match (5) { x => x } }; g() + x }; [f(), x]`,
+
+	// Structs
+	`struct P { x, y, fn norm() { self.x * self.x + self.y * self.y }, fn add(o) { P(self.x + o.x, self.y + o.y) } }; p := P(1, 2); q := p.add(P(3, 4)); q.x = 10; [p, q, q.norm(), typeof(p), str(P), str(p.norm)]`,
+	`struct P { x }; P(1).y`,
+	`struct P { x }; p := P(1); p.y = 2`,
+	`struct P { x, y }; P(1)`,
+
+	// Metatables
+	`V := {}; vec := fn(x, y) { setmeta({"x": x, "y": y}, V) }; V["__add"] = fn(a, b) { vec(a.x + b.x, a.y + b.y) }; V["__eq"] = fn(a, b) { a.x == b.x && a.y == b.y }; V["__lt"] = fn(a, b) { a.x < b.x }; V["__str"] = fn(v) { "(${v.x}, ${v.y})" }; V["__len"] = fn(v) { 2 }; a := vec(1, 2); b := a + vec(2, 2); print(a, b); [str(b), len(b), a == vec(1, 2), a != b, a < b, a > b, a <= b, a >= b]`,
+	`h := setmeta({"n": 2}, {"__index": {"m": 3}, "__call": fn(self, x) { self.n * x }}); [h.n, h.m, h.z, h(5)]`,
+	`setmeta({}, {"__add": fn(a, b) { a / 0 }}) + 1`,
+	`str(setmeta({}, {"__str": fn(h) { 1 }}))`,
+	`setmeta(1, {})`,
+	`h := setmeta({}, {"__index": fn(h, k) { k / 0 }}); h.x = 1; h.x`,
+
+	// Big integers
+	`fact := fn(n) { if (n == 0) { return 1 }; n * fact(n - 1) }; x := fact(30); [x, x / fact(29), -x, ~x, x % 97, x & 65535, x | 1, x ^ x, typeof(x)]`,
+	`x := 9223372036854775807; y := x + 1; [y, y - 1, -x - 2, x * x, (x * 2) / 2, y > x, x < y, y == x + 1, y != y, {y: 1}[x + 1]]`,
+	`[int("123456789012345678901234567890"), int("-9223372036854775809") + 1, [1][int("99999999999999999999")]]`,
+	`(9223372036854775807 * 2) / 0`,
+	`1 % (9223372036854775807 * 2 - 9223372036854775807 * 2)`,
+	`exit(1 << 70)`,
+	`chr(1 << 70)`,
+	`[bool(1 << 70), bool(-(1 << 70))]`,
+
+	// Integer literals
+	`[0xFF & 0b1111_0000, 0o777, 1_000_000, 0x7FFF_FFFF_FFFF_FFFF + 1, match (-16) { -0b1111 => 1, -0x10 => 2 }]`,
+
+	// Shift and exponent operators
+	`[1 << 4, -256 >> 4, -1 >> 100, 1 + 1 << 2, 5 & 3 << 1, 1 << 64, (1 << 100) >> 98, 2 ** 10, 2 ** 3 ** 2, -2 ** 2, 3 ** 50, 0 ** 0]`,
+	`1 << -1`,
+	`2 ** -1`,
+	`1 << (1 << 64)`,
+	`[9223372036854775808, 0x1_0000_0000_0000_0000, -9223372036854775808]`,
+	`[1, 2][1 << 64]`,
+	`"ab"[(1 << 64):]`,
+
+	// Compound assignment
+	`x := 12; x += 3; x -= 1; x *= 2; x /= 4; x %= 5; x |= 8; x &= 14; x ^= 5; x`,
+	`s := "a"; s += "b"; s`,
+	`h := {"count": 0}; xs := [1, [2]]; h.count += 1; xs[1][0] *= 3; [h, xs]`,
+	`struct P { x }; p := P(1); p.x += 2; p`,
+	`n := [0]; xs := [0, 0]; i := fn() { n[0] += 1; 1 }; xs[i()] += 5; [n, xs]`,
+	`x := 1; x += "a"`,
+	`y += 1`,
+	`V := {"__add": fn(a, b) { a.n + b }}; h := {"v": setmeta({"n": 1}, V)}; h.v += 2; h`,
+
+	// Raw and multi-line strings
+	"x := 1; [`a\\n${x}`, `two\nlines`, len(`\\d+`)]",
+	"x := 1; s := \"\"\"\n    x=${x}\n      \"quoted\"\\t\n    \"\"\"; [s, len(s)]",
+
+	// Constants
+	`const x = 2; const f = fn(n) { n * x }; xs := [f(3)]; const ys = xs; ys[0] += 1; [x, xs, ys]`,
+	`const x = 1; x = 2`,
+	`const x = 1; x += 1`,
+	`const x = 1; x := 2`,
+	`const x = 1; const x = 2`,
+	`const x = 1; [x, y] = [1, 2]`,
+	`const x = 1; f := fn() { x = 2 }; f()`,
+	`const x = 1; f := fn() { x := 2; x }; [f(), x]`,
+	`const x = 1; f := fn() { const x = 2; match (3) { x => x } }; [f(), x]`,
+	`f := fn() { const n = 1; g := fn() { n := 2; n }; [g(), n] }; f()`,
+	`f := fn() { const x = 1; x := 2 }; f()`,
+	`len = 1`,
+	`len := 1; len = 2; len`,
+	`x := 1; const x = 2; x`,
+	`const P = 1; struct P { x }`,
+	`const x = 1; match ([5]) { [x] => x }`,
+	`const r = 1; match ({"r": 5}) { {r} => r }`,
+	`i := 0; while (i < 3) { const y = i * 2; print(y); i += 1 }; i`,
+	`i := 0; while (i < 3) { const y = i; const y = 2; i += 1 }`,
+	`i := 0; while (i < 3) { print(i); i += 1; 1 / (i - 2) }; print("done")`,
+	`f := fn() { i := 0; while (true) { if (i == 2) { return i }; i += 1 } }; f()`,
+
+	// Frozen collections
+	`config := freeze({"debug": false, "paths": ["a"]}); [isFrozen(config), isFrozen(config.paths), isFrozen([]), isFrozen(1)]`,
+	`xs := freeze([1, 2]); xs[0] = 3`,
+	`h := freeze({"a": {"b": 1}}); h.a.b = 2`,
+	`xs := freeze([1]); push(xs, 2)`,
+	`ys := push(freeze([1]), 2); ys`,
+	`ys := push(freeze([1]), 2); len(ys)`,
+	`struct P { x }; xs := freeze([P([1])]); [isFrozen(xs[0]), isFrozen(xs[0].x)]`,
+	`struct P { x }; xs := freeze([P(1)]); xs[0].x = 2`,
+	`xs := freeze([1]); ys := xs + [2]; ys[0] = 5; [xs, ys]`,
+
+	// Ordered hashes
+	`h := {"z": 1, "a": 2, 10: 3}; h.m = 4; h.z = 5; [h, keys(h), values(h)]`,
+	`h := {"b": 1, "a": 2} + {"c": 3, "b": 4}; delete(h, "a"); [h, items(h), has(h, "a"), has(h, "c")]`,
+	`delete([], 1)`,
+
+	// Block and doc comments
+	`[1 /* one */ + /* nested /* two */ */ 2, 3 /**/ * 4]`,
+	"/// Doubles n\ndouble := fn(n) { n * 2 }\nf := fn() {\n  double(21)\n  /// dangling\n}\nf()",
+}
+
+// knownDivergences lists snippets for which the engines are known to differ
+// along with the reason why
+var knownDivergences = map[string]string{
+	`x := 1; f := fn() { x = 2 }; f(); x`: "the evaluator assigns to a new " +
+		"binding in the function's environment, the vm to the global",
+	`counter := fn() { n := 0; fn() { n = n + 1; n } }; c := counter(); c(); c()`: "" +
+		"the evaluator rebinds free variables in the closure's environment, " +
+		"the vm assigns to a local slot the free variable is not loaded from",
+	`len(1); print("after")`: "the evaluator stops at the error returned by " +
+		"a builtin, the vm treats it as a value and carries on",
+	`ys := push(freeze([1]), 2); len(ys)`: "the evaluator stops at the error " +
+		"returned by a builtin, the vm binds it and passes it to `len`",
+}
+
+func check(t *testing.T, input string) {
+	t.Helper()
+
+	diffs := Compare(input)
+
+	reason, known := knownDivergences[input]
+	switch {
+	case len(diffs) > 0 && known:
+		t.Logf("known divergence (%s):\n\t%s", reason, strings.Join(diffs, "\n\t"))
+	case len(diffs) > 0:
+		results := []string{"eval: " + Eval(input).String()}
+		for _, engine := range Engines {
+			results = append(results, engine.Name+": "+engine.Run(input).String())
+		}
+		t.Errorf(
+			"engines diverge for %q:\n\t%s\n\t%s",
+			input, strings.Join(results, "\n\t"), strings.Join(diffs, "\n\t"),
+		)
+	case known:
+		t.Errorf("known divergence %q no longer diverges, remove it", input)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	for _, input := range snippets {
+		t.Run(input, func(t *testing.T) {
+			check(t, input)
+		})
+	}
+}
+
+func checkFiles(t *testing.T, pattern string, skip map[string]string) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range matches {
+		basename := path.Base(match)
+		name := strings.TrimSuffix(basename, filepath.Ext(basename))
+
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := skip[basename]; ok {
+				t.Skip(reason)
+			}
+
+			b, err := ioutil.ReadFile(match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, string(b))
+		})
+	}
+}
+
+func TestTestdata(t *testing.T) {
+	checkFiles(t, "../testdata/*.monkey", nil)
+}
+
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	checkFiles(t, "../examples/*.monkey", map[string]string{
+		"fib.monkey": "too slow for the evaluator",
+	})
+}
@@ -0,0 +1,257 @@
+// Package cover implements statement coverage for Monkey programs. Both the
+// virtual machine and the evaluator record how many times the statements on
+// each source line were executed into Counts which are combined with the
+// statements of the program into a Profile. Profiles are read and written
+// in the same format as Go's coverage profiles (`go test -coverprofile`).
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prologic/monkey-lang/ast"
+)
+
+// Mode is the coverage mode written to profiles
+const Mode = "count"
+
+// Counts holds the number of times the statements on each source line
+// were executed
+type Counts map[int]int
+
+// Block is a range of source code holding one or more statements and the
+// number of times they were executed
+type Block struct {
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+// Blocks returns a Block for every source line of program holding one or
+// more statements. src is the program's source code used to determine the
+// extent of each line.
+func Blocks(program *ast.Program, src string) []Block {
+	lines := strings.Split(src, "\n")
+	index := make(map[int]int)
+
+	var blocks []Block
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		var line, col int
+
+		switch node := node.(type) {
+		case *ast.ExpressionStatement:
+			line, col = node.Token.Line, node.Token.Column
+		case *ast.ReturnStatement:
+			line, col = node.Token.Line, node.Token.Column
+		default:
+			return true
+		}
+
+		if i, ok := index[line]; ok {
+			blocks[i].NumStmt++
+			if col < blocks[i].StartCol {
+				blocks[i].StartCol = col
+			}
+			return true
+		}
+
+		endCol := col + 1
+		if line > 0 && line <= len(lines) {
+			endCol = len(strings.TrimRight(lines[line-1], "\r")) + 1
+		}
+
+		index[line] = len(blocks)
+		blocks = append(blocks, Block{
+			StartLine: line,
+			StartCol:  col,
+			EndLine:   line,
+			EndCol:    endCol,
+			NumStmt:   1,
+		})
+
+		return true
+	})
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].StartLine < blocks[j].StartLine
+	})
+
+	return blocks
+}
+
+// Profile holds the coverage blocks of one or more source files
+type Profile struct {
+	Files map[string][]Block
+}
+
+// NewProfile returns a new empty Profile
+func NewProfile() *Profile {
+	return &Profile{Files: make(map[string][]Block)}
+}
+
+// Add adds the blocks of filename to the profile with their counts taken
+// from counts. Counts of blocks already in the profile are accumulated.
+func (p *Profile) Add(filename string, blocks []Block, counts Counts) {
+	for _, b := range blocks {
+		b.Count = counts[b.StartLine]
+		p.addBlock(filename, b)
+	}
+}
+
+func (p *Profile) addBlock(filename string, block Block) {
+	blocks := p.Files[filename]
+	for i, b := range blocks {
+		if b.StartLine == block.StartLine && b.StartCol == block.StartCol &&
+			b.EndLine == block.EndLine && b.EndCol == block.EndCol {
+			blocks[i].Count += block.Count
+			return
+		}
+	}
+
+	blocks = append(blocks, block)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].StartLine < blocks[j].StartLine
+	})
+	p.Files[filename] = blocks
+}
+
+// Merge accumulates the blocks and counts of other into p
+func (p *Profile) Merge(other *Profile) {
+	for filename, blocks := range other.Files {
+		for _, b := range blocks {
+			p.addBlock(filename, b)
+		}
+	}
+}
+
+func (p *Profile) filenames() []string {
+	var filenames []string
+	for filename := range p.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// Percent returns the percentage of statements in filename executed at
+// least once
+func (p *Profile) Percent(filename string) float64 {
+	var total, covered int
+	for _, b := range p.Files[filename] {
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// Write writes the profile to w in the Go coverage profile format
+func (p *Profile) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "mode: %s\n", Mode); err != nil {
+		return err
+	}
+
+	for _, filename := range p.filenames() {
+		for _, b := range p.Files[filename] {
+			_, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n",
+				filename, b.StartLine, b.StartCol, b.EndLine, b.EndCol,
+				b.NumStmt, b.Count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteSummary writes the percentage of statements covered for each file
+// in the profile to w
+func (p *Profile) WriteSummary(w io.Writer) error {
+	for _, filename := range p.filenames() {
+		_, err := fmt.Fprintf(w, "%s\tcoverage: %.1f%% of statements\n",
+			filename, p.Percent(filename))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads a profile in the Go coverage profile format from r
+func Read(r io.Reader) (*Profile, error) {
+	p := NewProfile()
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: invalid profile line %q", n, line)
+		}
+
+		var b Block
+		_, err := fmt.Sscanf(
+			line[i+1:], "%d.%d,%d.%d %d %d",
+			&b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol,
+			&b.NumStmt, &b.Count,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid profile line %q: %s", n, line, err)
+		}
+
+		p.addBlock(line[:i], b)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ReadFile reads a profile from the file given by filename. A missing file
+// results in an empty profile.
+func ReadFile(filename string) (*Profile, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return NewProfile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// WriteFile writes the profile to the file given by filename
+func (p *Profile) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,68 @@
+package cover
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/parser"
+)
+
+const src = `f := fn(x) {
+  if (x > 1) {
+    return "big"
+  }
+  return "small"
+}
+f(0); f(0)
+`
+
+func TestBlocks(t *testing.T) {
+	assert := assert.New(t)
+
+	program := parser.New(lexer.New(src)).ParseProgram()
+
+	assert.Equal([]Block{
+		{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 13, NumStmt: 1},
+		{StartLine: 2, StartCol: 3, EndLine: 2, EndCol: 15, NumStmt: 1},
+		{StartLine: 3, StartCol: 5, EndLine: 3, EndCol: 17, NumStmt: 1},
+		{StartLine: 5, StartCol: 3, EndLine: 5, EndCol: 17, NumStmt: 1},
+		{StartLine: 7, StartCol: 1, EndLine: 7, EndCol: 11, NumStmt: 2},
+	}, Blocks(program, src))
+}
+
+func TestProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	program := parser.New(lexer.New(src)).ParseProgram()
+	blocks := Blocks(program, src)
+
+	p := NewProfile()
+	p.Add("f.monkey", blocks, Counts{1: 1, 2: 2, 5: 2, 7: 2})
+	assert.InDelta(83.3, p.Percent("f.monkey"), 0.1)
+
+	var buf bytes.Buffer
+	assert.NoError(p.Write(&buf))
+	assert.Equal(`mode: count
+f.monkey:1.1,1.13 1 1
+f.monkey:2.3,2.15 1 2
+f.monkey:3.5,3.17 1 0
+f.monkey:5.3,5.17 1 2
+f.monkey:7.1,7.11 2 2
+`, buf.String())
+
+	other, err := Read(&buf)
+	assert.NoError(err)
+
+	p.Add("f.monkey", blocks, Counts{3: 1})
+	p.Merge(other)
+	assert.Equal(100.0, p.Percent("f.monkey"))
+	assert.Equal(2, p.Files["f.monkey"][0].Count)
+	assert.Equal(1, p.Files["f.monkey"][2].Count)
+
+	buf.Reset()
+	assert.NoError(p.WriteSummary(&buf))
+	assert.Equal("f.monkey\tcoverage: 100.0% of statements\n", buf.String())
+}
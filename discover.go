@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// discover returns the files found in path for which match returns true,
+// as used by the doc and test commands. If path is a file it is returned as
+// is, otherwise path is walked recursively.
+func discover(path string, match func(name string) bool) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && match(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
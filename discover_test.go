@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscover(t *testing.T) {
+	assert := assert.New(t)
+
+	files, err := discover("doc/testdata", isSourceFile)
+	assert.NoError(err)
+	assert.Equal([]string{"doc/testdata/lib.monkey"}, files)
+
+	files, err = discover("doc/testdata/lib_test.monkey", isSourceFile)
+	assert.NoError(err)
+	assert.Equal([]string{"doc/testdata/lib_test.monkey"}, files)
+
+	files, err = discover("tester/testdata", isTestFile)
+	assert.NoError(err)
+	assert.Equal([]string{"tester/testdata/math_test.monkey"}, files)
+
+	_, err = discover("testdata/missing", isTestFile)
+	assert.Error(err)
+}
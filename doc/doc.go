@@ -0,0 +1,200 @@
+// Package doc implements a documentation generator for Monkey programs.
+// Every top-level function bound with `:=` is documented with its parameters
+// and the comment immediately preceding it, either a `///` doc comment or
+// consecutive `#` or `//` line comments, along with the builtin functions.
+package doc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+)
+
+const (
+	// FileSuffix is the suffix of Monkey source files
+	FileSuffix = ".monkey"
+
+	// TestFileSuffix is the suffix of Monkey test files which are skipped
+	// when discovering files in a directory
+	TestFileSuffix = "_test.monkey"
+)
+
+// Entry documents a single function
+type Entry struct {
+	Name      string
+	Signature string // e.g: add(a, b = 1, ...rest)
+	Doc       string
+	File      string // empty for builtins
+	Line      int
+}
+
+// Page documents the functions of a single file or the builtins
+type Page struct {
+	Title   string
+	Entries []*Entry
+}
+
+// ParseFile parses the source file given by filename and returns the page
+// documenting its functions
+func ParseFile(filename string) (*Page, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	l := lexer.New(string(b))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf(
+			"%s: parser errors:\n\t%s",
+			filename, strings.Join(p.Errors(), "\n\t"),
+		)
+	}
+
+	return Extract(filename, program), nil
+}
+
+// Extract returns the page documenting the top-level function bindings of
+// program which was parsed from filename
+func Extract(filename string, program *ast.Program) *Page {
+	page := &Page{Title: filename}
+
+	var (
+		comments []*ast.Comment
+		line     int // line of the last statement other than a comment
+	)
+
+	for _, s := range program.Statements {
+		if c, ok := s.(*ast.Comment); ok {
+			// Skip comments following a statement on the same line and
+			// start a new group after a line without a comment
+			if c.Token.Line == line {
+				continue
+			}
+			if n := len(comments); n > 0 && comments[n-1].Token.Line+1 != c.Token.Line {
+				comments = nil
+			}
+			comments = append(comments, c)
+			continue
+		}
+
+		group := comments
+		comments = nil
+
+		es, ok := s.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		line = es.Token.Line
+
+		be, ok := es.Expression.(*ast.BindExpression)
+		if !ok {
+			continue
+		}
+		ident, ok := be.Left.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+		fl, ok := be.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+
+		doc := be.Doc
+		if n := len(group); doc == "" && n > 0 && group[n-1].Token.Line+1 == es.Token.Line {
+			doc = commentText(group)
+		}
+
+		page.Entries = append(page.Entries, &Entry{
+			Name:      ident.Value,
+			Signature: signature(ident.Value, fl),
+			Doc:       doc,
+			File:      filename,
+			Line:      es.Token.Line,
+		})
+	}
+
+	return page
+}
+
+// Builtins returns the page documenting the builtin functions
+func Builtins() *Page {
+	page := &Page{Title: "Builtins"}
+
+	for _, builtin := range object.BuiltinsIndex {
+		page.Entries = append(page.Entries, &Entry{
+			Name:      builtin.Name,
+			Signature: builtin.Usage,
+			Doc:       builtin.Doc,
+		})
+	}
+
+	return page
+}
+
+// Lookup returns the entries of all pages documenting a function name
+func Lookup(pages []*Page, name string) []*Entry {
+	var entries []*Entry
+
+	for _, page := range pages {
+		for _, entry := range page.Entries {
+			if entry.Name == name {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+// commentText returns the text of a group of line comments with the space
+// after each comment's # or // removed. A shebang line is ignored.
+func commentText(comments []*ast.Comment) string {
+	var lines []string
+
+	for _, c := range comments {
+		if c.Token.Line == 1 && strings.HasPrefix(c.Value, "!") {
+			continue
+		}
+		lines = append(lines, strings.TrimPrefix(c.Value, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// signature returns the signature of the function fl bound to name with its
+// parameters as written in the source, e.g: add(a, b = 1, ...rest)
+func signature(name string, fl *ast.FunctionLiteral) string {
+	params := []string{}
+
+	optional := len(fl.Parameters) - len(fl.Defaults)
+	for i, p := range fl.Parameters {
+		if i >= optional {
+			params = append(params, p.String()+" = "+source(fl.Defaults[i-optional]))
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
+
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// source returns exp as written in the source as far as possible, unlike
+// String() string literals are quoted
+func source(exp ast.Expression) string {
+	if sl, ok := exp.(*ast.StringLiteral); ok {
+		return strconv.Quote(sl.Value)
+	}
+	return exp.String()
+}
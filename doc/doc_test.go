@@ -0,0 +1,105 @@
+package doc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFile(t *testing.T) {
+	assert := assert.New(t)
+
+	page, err := ParseFile("testdata/lib.monkey")
+	assert.NoError(err)
+	assert.Equal(&Page{
+		Title: "testdata/lib.monkey",
+		Entries: []*Entry{
+			{
+				Name:      "add",
+				Signature: "add(a, b)",
+				Doc:       "Adds a and b.\n\n    add(1, 2) # 3",
+				File:      "testdata/lib.monkey",
+				Line:      5,
+			},
+			{
+				Name:      "greet",
+				Signature: `greet(name, greeting = "Hello", ...rest)`,
+				Doc:       "Greets name, with the\ngreeting <b>optional</b>.",
+				File:      "testdata/lib.monkey",
+				Line:      11,
+			},
+			{
+				Name:      "undocumented",
+				Signature: "undocumented()",
+				File:      "testdata/lib.monkey",
+				Line:      16,
+			},
+		},
+	}, page)
+}
+
+func TestBuiltins(t *testing.T) {
+	assert := assert.New(t)
+
+	page := Builtins()
+	assert.NotEmpty(page.Entries)
+	for _, entry := range page.Entries {
+		assert.NotEmpty(entry.Signature, "builtin %s has no usage", entry.Name)
+		assert.NotEmpty(entry.Doc, "builtin %s has no doc", entry.Name)
+	}
+
+	entries := Lookup([]*Page{page}, "len")
+	assert.Len(entries, 1)
+	assert.Equal("len(iterable)", entries[0].Signature)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	assert := assert.New(t)
+
+	page, err := ParseFile("testdata/lib.monkey")
+	assert.NoError(err)
+	page.Entries = page.Entries[:1]
+
+	var buf bytes.Buffer
+	assert.NoError(Write(&buf, FormatMarkdown, []*Page{page}))
+	assert.Equal("# Reference\n"+
+		"\n## testdata/lib.monkey\n"+
+		"\n### `add(a, b)`\n"+
+		"\nAdds a and b.\n\n    add(1, 2) # 3\n", buf.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	page, err := ParseFile("testdata/lib.monkey")
+	assert.NoError(err)
+
+	var buf bytes.Buffer
+	assert.NoError(Write(&buf, FormatHTML, []*Page{page}))
+	assert.Contains(buf.String(), `<h3 id="0-add"><code>add(a, b)</code></h3>`)
+	assert.Contains(buf.String(), "<p>Adds a and b.</p>\n<pre>    add(1, 2) # 3</pre>")
+	assert.Contains(buf.String(), "greeting &lt;b&gt;optional&lt;/b&gt;.")
+
+	assert.Error(Write(&buf, "pdf", nil))
+}
+
+func TestWriteText(t *testing.T) {
+	assert := assert.New(t)
+
+	page, err := ParseFile("testdata/lib.monkey")
+	assert.NoError(err)
+
+	var buf bytes.Buffer
+	assert.NoError(WriteText(&buf, Lookup([]*Page{page, Builtins()}, "add")))
+	assert.NoError(WriteText(&buf, Lookup([]*Page{page, Builtins()}, "len")))
+	assert.Equal("add(a, b)\n"+
+		"    (testdata/lib.monkey:5)\n"+
+		"    Adds a and b.\n"+
+		"\n"+
+		"        add(1, 2) # 3\n"+
+		"len(iterable)\n"+
+		"    Returns the length of the iterable (`str`, `array` or `hash`). The length\n"+
+		"    of a `str` is its number of characters (Unicode code points).\n",
+		buf.String())
+}
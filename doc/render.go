@@ -0,0 +1,155 @@
+package doc
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// Formats supported by Write
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Write writes a reference of the pages to w in the given format
+func Write(w io.Writer, format string, pages []*Page) error {
+	switch format {
+	case FormatMarkdown, "":
+		return WriteMarkdown(w, pages)
+	case FormatHTML:
+		return WriteHTML(w, pages)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteMarkdown writes a reference of the pages to w as a Markdown document
+// with a section per page
+func WriteMarkdown(w io.Writer, pages []*Page) error {
+	fmt.Fprintf(w, "# Reference\n")
+
+	for _, page := range pages {
+		fmt.Fprintf(w, "\n## %s\n", page.Title)
+
+		for _, entry := range page.Entries {
+			fmt.Fprintf(w, "\n### `%s`\n", entry.Signature)
+			if entry.Doc != "" {
+				fmt.Fprintf(w, "\n%s\n", entry.Doc)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteText writes the entries to w as plain text for reading in a
+// terminal, each signature followed by its indented documentation
+func WriteText(w io.Writer, entries []*Entry) error {
+	for i, entry := range entries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintln(w, entry.Signature)
+		if entry.File != "" {
+			fmt.Fprintf(w, "    (%s:%d)\n", entry.File, entry.Line)
+		}
+		if entry.Doc == "" {
+			continue
+		}
+		for _, line := range strings.Split(entry.Doc, "\n") {
+			if line == "" {
+				fmt.Fprintln(w)
+			} else {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// paragraph is a paragraph of a doc comment, preformatted if all of its
+// lines are indented as for examples
+type paragraph struct {
+	Text string
+	Pre  bool
+}
+
+// paragraphs splits the text of a doc comment into paragraphs at blank lines
+func paragraphs(doc string) []paragraph {
+	var (
+		result []paragraph
+		lines  []string
+	)
+
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		pre := true
+		for _, line := range lines {
+			if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				pre = false
+			}
+		}
+		result = append(result, paragraph{Text: strings.Join(lines, "\n"), Pre: pre})
+		lines = nil
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	return result
+}
+
+var htmlTemplate = template.Must(template.New("reference").Funcs(template.FuncMap{
+	"paragraphs": paragraphs,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Reference</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+h3 code { font-size: 1.1em; }
+pre { background: #f4f4f4; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>Reference</h1>
+<ul>
+{{- range $i, $page := . }}
+<li><a href="#page-{{ $i }}">{{ $page.Title }}</a></li>
+{{- end }}
+</ul>
+{{- range $i, $page := . }}
+<h2 id="page-{{ $i }}">{{ $page.Title }}</h2>
+{{- range $page.Entries }}
+<h3 id="{{ $i }}-{{ .Name }}"><code>{{ .Signature }}</code></h3>
+{{- range paragraphs .Doc }}
+{{- if .Pre }}
+<pre>{{ .Text }}</pre>
+{{- else }}
+<p>{{ .Text }}</p>
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+// WriteHTML writes a reference of the pages to w as a static HTML page with
+// a section per page
+func WriteHTML(w io.Writer, pages []*Page) error {
+	return htmlTemplate.Execute(w, pages)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/prologic/monkey-lang/doc"
+)
+
+// runDoc implements the doc command which writes a reference of the
+// functions in the given files or directories and the builtins, or prints
+// the documentation of the functions with the given names
+func runDoc(args []string) int {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s doc [options] [<dir|file>...] [<name>...]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+
+	format := fs.String("format", doc.FormatMarkdown, "output format (markdown or html)")
+	fs.Parse(args)
+
+	// Arguments that are not existing files or directories are names
+	var paths, names []string
+	for _, arg := range fs.Args() {
+		if _, err := os.Stat(arg); err == nil {
+			paths = append(paths, arg)
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var pages []*doc.Page
+	for _, p := range paths {
+		files, err := discover(p, isSourceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error discovering files: %s\n", err)
+			return 2
+		}
+
+		for _, file := range files {
+			page, err := doc.ParseFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return 2
+			}
+			pages = append(pages, page)
+		}
+	}
+	pages = append(pages, doc.Builtins())
+
+	if len(names) == 0 {
+		if err := doc.Write(os.Stdout, *format, pages); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing reference: %s\n", err)
+			return 2
+		}
+		return 0
+	}
+
+	status := 0
+	for i, name := range names {
+		entries := doc.Lookup(pages, name)
+		if len(entries) == 0 {
+			fmt.Fprintf(os.Stderr, "no documentation found for %s\n", name)
+			status = 1
+			continue
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		doc.WriteText(os.Stdout, entries)
+	}
+
+	return status
+}
+
+// isSourceFile reports whether name is a Monkey source file that is not a
+// test file
+func isSourceFile(name string) bool {
+	return strings.HasSuffix(name, doc.FileSuffix) &&
+		!strings.HasSuffix(name, doc.TestFileSuffix)
+}
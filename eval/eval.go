@@ -5,13 +5,19 @@ package eval
 // the nodes according to their semantic meaning
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/cover"
 	"github.com/prologic/monkey-lang/object"
 )
 
+// Coverage, if non-nil, records the number of times the statements on each
+// source line are evaluated
+var Coverage cover.Counts
+
 var (
 	// TRUE is a cached Boolean object holding the `true` value
 	TRUE = &object.Boolean{Value: true}
@@ -30,6 +36,15 @@ func fromNativeBoolean(input bool) *object.Boolean {
 	return FALSE
 }
 
+func recordCoverage(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		Coverage[stmt.Token.Line]++
+	case *ast.ReturnStatement:
+		Coverage[stmt.Token.Line]++
+	}
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -57,9 +72,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	// Expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	case *ast.Boolean:
 		return fromNativeBoolean(node.Value)
 	case *ast.Null:
@@ -89,22 +109,44 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIfExpression(node, env)
 	case *ast.WhileExpression:
 		return evalWhileExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+		}
+
+	case *ast.MacroLiteral:
+		return newError("macro literals must be bound to a name at the top level")
+
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
 
 	case *ast.CallExpression:
+		if isQuoteCall(node, env) {
+			if len(node.Arguments) != 1 {
+				return newError(
+					"wrong number of arguments: want=1, got=%d",
+					len(node.Arguments),
+				)
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		args := evalArguments(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
@@ -124,60 +166,83 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 
 		if ident, ok := node.Left.(*ast.Identifier); ok {
+			if env.IsLocalConst(ident.Value) && !env.IsDeclaredBy(ident.Value, node) {
+				return newError("cannot assign to constant %s", ident.Value)
+			}
+
 			if immutable, ok := value.(object.Immutable); ok {
-				env.Set(ident.Value, immutable.Clone())
+				value = immutable.Clone()
+			}
+			if node.Const {
+				env.SetConst(ident.Value, value, node)
 			} else {
 				env.Set(ident.Value, value)
 			}
 
 			return NULL
 		}
+		if isPattern(node.Left) {
+			mode := destructureBind
+			if node.Parameter {
+				mode = destructureDefine
+			}
+			if err := destructure(node.Left, value, env, mode); err != nil {
+				return err
+			}
+			return NULL
+		}
 		return newError("expected identifier on left got=%T", node.Left)
 
 	case *ast.AssignmentExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
+		if isPattern(node.Left) {
+			value := Eval(node.Value, env)
+			if isError(value) {
+				return value
+			}
+			if err := destructure(node.Left, value, env, destructureAssign); err != nil {
+				return err
+			}
+			return NULL
 		}
 
-		value := Eval(node.Value, env)
-		if isError(value) {
-			return value
+		if node.Operator != "" {
+			return evalCompoundAssignment(node, env)
 		}
 
-		if ident, ok := node.Left.(*ast.Identifier); ok {
-			env.Set(ident.Value, value)
-		} else if ie, ok := node.Left.(*ast.IndexExpression); ok {
-			obj := Eval(ie.Left, env)
+		switch left := node.Left.(type) {
+		case *ast.Identifier:
+			if obj := evalIdentifier(left, env); isError(obj) {
+				return obj
+			}
+			if isConstant(left.Value, env) {
+				return newError("cannot assign to constant %s", left.Value)
+			}
+
+			value := Eval(node.Value, env)
+			if isError(value) {
+				return value
+			}
+			env.Set(left.Value, value)
+
+		case *ast.IndexExpression:
+			obj := Eval(left.Left, env)
 			if isError(obj) {
 				return obj
 			}
+			index := Eval(left.Index, env)
+			if isError(index) {
+				return index
+			}
 
-			if array, ok := obj.(*object.Array); ok {
-				index := Eval(ie.Index, env)
-				if isError(index) {
-					return index
-				}
-				if idx, ok := index.(*object.Integer); ok {
-					array.Elements[idx.Value] = value
-				} else {
-					return newError("cannot index array with %#v", index)
-				}
-			} else if hash, ok := obj.(*object.Hash); ok {
-				key := Eval(ie.Index, env)
-				if isError(key) {
-					return key
-				}
-				if hashKey, ok := key.(object.Hashable); ok {
-					hashed := hashKey.HashKey()
-					hash.Pairs[hashed] = object.HashPair{Key: key, Value: value}
-				} else {
-					return newError("cannot index hash with %T", key)
-				}
-			} else {
-				return newError("object type %T does not support item assignment", obj)
+			value := Eval(node.Value, env)
+			if isError(value) {
+				return value
+			}
+			if err := evalSetItem(obj, index, value); err != nil {
+				return err
 			}
-		} else {
+
+		default:
 			return newError("expected identifier or index expression got=%T", left)
 		}
 
@@ -194,6 +259,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	case *ast.ArrayPattern, *ast.HashPattern:
+		return newError("unexpected destructuring pattern %s", node)
+
+	case *ast.SpreadExpression:
+		return newError("unexpected spread expression %s", node)
+
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	}
@@ -205,6 +279,14 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
+		if _, ok := statement.(*ast.Comment); ok {
+			continue
+		}
+
+		if Coverage != nil {
+			recordCoverage(statement)
+		}
+
 		result = Eval(statement, env)
 
 		switch result := result.(type) {
@@ -236,6 +318,15 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	var result object.Object
 
 	for _, statement := range block.Statements {
+		// Comments have no value so the result is the last statement's
+		if _, ok := statement.(*ast.Comment); ok {
+			continue
+		}
+
+		if Coverage != nil {
+			recordCoverage(statement)
+		}
+
 		result = Eval(statement, env)
 
 		if result != nil {
@@ -249,6 +340,24 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+func evalTemplateLiteral(tl *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var b strings.Builder
+
+	for _, part := range tl.Parts {
+		obj := Eval(part, env)
+		if isError(obj) {
+			return obj
+		}
+		str, err := object.ToString(obj, callFunction)
+		if err != nil {
+			return newError("%s", err)
+		}
+		b.WriteString(str)
+	}
+
+	return &object.String{Value: b.String()}
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -281,18 +390,17 @@ func evalBooleanPrefixOperatorExpression(operator string, right object.Object) o
 }
 
 func evalIntegerPrefixOperatorExpression(operator string, right object.Object) object.Object {
-	if right.Type() != object.INTEGER {
+	if !object.IsInteger(right) {
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 
-	value := right.(*object.Integer).Value
 	switch operator {
 	case "!":
 		return FALSE
 	case "~":
-		return &object.Integer{Value: ^value}
+		return object.InvertInteger(right)
 	case "-":
-		return &object.Integer{Value: -value}
+		return object.NegateInteger(right)
 	default:
 		return newError("unknown operator: %s", operator)
 	}
@@ -302,20 +410,15 @@ func evalInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
+	if result, ok := evalInfixMetamethod(operator, left, right); ok {
+		return result
+	}
+
 	switch {
 
 	// {"a": 1} + {"b": 2}
 	case operator == "+" && left.Type() == object.HASH && right.Type() == object.HASH:
-		leftVal := left.(*object.Hash).Pairs
-		rightVal := right.(*object.Hash).Pairs
-		pairs := make(map[object.HashKey]object.HashPair)
-		for k, v := range leftVal {
-			pairs[k] = v
-		}
-		for k, v := range rightVal {
-			pairs[k] = v
-		}
-		return &object.Hash{Pairs: pairs}
+		return left.(*object.Hash).Merge(right.(*object.Hash))
 
 	// [1] + [2]
 	case operator == "+" && left.Type() == object.ARRAY && right.Type() == object.ARRAY:
@@ -326,34 +429,34 @@ func evalInfixExpression(
 		return &object.Array{Elements: elements}
 
 	// [1] * 3
-	case operator == "*" && left.Type() == object.ARRAY && right.Type() == object.INTEGER:
-		leftVal := left.(*object.Array).Elements
-		rightVal := int(right.(*object.Integer).Value)
-		elements := leftVal
-		for i := rightVal; i > 1; i-- {
-			elements = append(elements, leftVal...)
+	case operator == "*" && left.Type() == object.ARRAY && isInt64(right):
+		result, err := left.(*object.Array).Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return newError("%s", err)
 		}
-		return &object.Array{Elements: elements}
+		return result
 	// 3 * [1]
-	case operator == "*" && left.Type() == object.INTEGER && right.Type() == object.ARRAY:
-		leftVal := int(left.(*object.Integer).Value)
-		rightVal := right.(*object.Array).Elements
-		elements := rightVal
-		for i := leftVal; i > 1; i-- {
-			elements = append(elements, rightVal...)
+	case operator == "*" && isInt64(left) && right.Type() == object.ARRAY:
+		result, err := right.(*object.Array).Repeat(left.(*object.Integer).Value)
+		if err != nil {
+			return newError("%s", err)
 		}
-		return &object.Array{Elements: elements}
+		return result
 
 	// " " * 4
-	case operator == "*" && left.Type() == object.STRING && right.Type() == object.INTEGER:
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.Integer).Value
-		return &object.String{Value: strings.Repeat(leftVal, int(rightVal))}
+	case operator == "*" && left.Type() == object.STRING && isInt64(right):
+		result, err := left.(*object.String).Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
 	// 4 * " "
-	case operator == "*" && left.Type() == object.INTEGER && right.Type() == object.STRING:
-		leftVal := left.(*object.Integer).Value
-		rightVal := right.(*object.String).Value
-		return &object.String{Value: strings.Repeat(rightVal, int(leftVal))}
+	case operator == "*" && isInt64(left) && right.Type() == object.STRING:
+		result, err := right.(*object.String).Repeat(left.(*object.Integer).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
 
 	case left.Type() == object.BOOLEAN && right.Type() == object.BOOLEAN:
 		return evalBooleanInfixExpression(operator, left, right)
@@ -374,6 +477,44 @@ func evalInfixExpression(
 	}
 }
 
+// evalInfixMetamethod evaluates the operator with the __add, __eq or __lt
+// metamethod of either operand and reports whether one was called. a > b is
+// __lt(b, a), a <= b is the negation of __lt(b, a) and a >= b the negation
+// of __lt(a, b).
+func evalInfixMetamethod(
+	operator string,
+	left, right object.Object,
+) (object.Object, bool) {
+	name, negate := "", false
+	switch operator {
+	case "+":
+		name = "__add"
+	case "==", "!=":
+		name, negate = "__eq", operator == "!="
+	case "<":
+		name = "__lt"
+	case ">":
+		name, left, right = "__lt", right, left
+	case "<=":
+		name, left, right, negate = "__lt", right, left, true
+	case ">=":
+		name, negate = "__lt", true
+	default:
+		return nil, false
+	}
+
+	hook, ok := object.BinaryMetamethod(left, right, name)
+	if !ok {
+		return nil, false
+	}
+
+	result := applyFunction(hook, []object.Object{left, right})
+	if isError(result) || name == "__add" {
+		return result, true
+	}
+	return fromNativeBoolean(isTruthy(result) != negate), true
+}
+
 func evalBooleanInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -387,9 +528,9 @@ func evalBooleanInfixExpression(
 	case "!=":
 		return fromNativeBoolean(left != right)
 	case "&&":
-		return &object.Boolean{Value: leftVal && rightVal}
+		return fromNativeBoolean(leftVal && rightVal)
 	case "||":
-		return &object.Boolean{Value: leftVal || rightVal}
+		return fromNativeBoolean(leftVal || rightVal)
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -400,38 +541,25 @@ func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
 	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "%":
-		return &object.Integer{Value: leftVal % rightVal}
-	case "|":
-		return &object.Integer{Value: leftVal | rightVal}
-	case "^":
-		return &object.Integer{Value: leftVal ^ rightVal}
-	case "&":
-		return &object.Integer{Value: leftVal & rightVal}
+	case "+", "-", "*", "/", "%", "|", "^", "&", "<<", ">>", "**":
+		result, err := object.IntegerOperation(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
 	case "<":
-		return fromNativeBoolean(leftVal < rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) < 0)
 	case "<=":
-		return fromNativeBoolean(leftVal <= rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) <= 0)
 	case ">":
-		return fromNativeBoolean(leftVal > rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) > 0)
 	case ">=":
-		return fromNativeBoolean(leftVal >= rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) >= 0)
 	case "==":
-		return fromNativeBoolean(leftVal == rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) == 0)
 	case "!=":
-		return fromNativeBoolean(leftVal != rightVal)
+		return fromNativeBoolean(object.CompareIntegers(left, right) != 0)
 	default:
 		return NULL
 	}
@@ -462,18 +590,25 @@ func evalStringInfixExpression(
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
-		return condition
+	for {
+		condition := Eval(ie.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return Eval(ie.Consequence, env)
+		}
+		if ie.ElseIf == nil {
+			break
+		}
+		ie = ie.ElseIf
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
-	} else if ie.Alternative != nil {
+	if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
-	} else {
-		return NULL
 	}
+	return NULL
 }
 
 func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
@@ -485,11 +620,17 @@ func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) objec
 			return condition
 		}
 
-		if isTruthy(condition) {
-			result = Eval(we.Consequence, env)
-		} else {
+		if !isTruthy(condition) {
 			break
 		}
+
+		result = Eval(we.Consequence, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN || rt == object.ERROR {
+				return result
+			}
+		}
 	}
 
 	if result != nil {
@@ -499,6 +640,129 @@ func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) objec
 	}
 }
 
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		if !matchPattern(arm.Pattern, subject, env) {
+			continue
+		}
+		if err := bindPattern(arm.Pattern, subject, env); err != nil {
+			return err
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		if result := Eval(arm.Body, env); result != nil {
+			return result
+		}
+		return NULL
+	}
+
+	return NULL
+}
+
+// matchPattern reports whether value matches the pattern of a match arm
+func matchPattern(pattern ast.Expression, value object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return true
+
+	case *ast.AlternativePattern:
+		for _, alt := range pattern.Alternatives {
+			if matchPattern(alt, value, env) {
+				return true
+			}
+		}
+		return false
+
+	case *ast.ArrayPattern:
+		if !object.MatchArray(value, len(pattern.Elements), pattern.Rest != nil) {
+			return false
+		}
+		elements := value.(*object.Array).Elements
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, elements[i], env) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+		}
+		values, err := object.UnpackHash(value, keys)
+		if err != nil {
+			return false
+		}
+		for i, p := range pattern.Patterns {
+			if p != nil && !matchPattern(p, values[i], env) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return object.MatchLiteral(value, Eval(pattern, env))
+	}
+}
+
+// bindPattern binds the variables of a pattern to the parts of value it
+// matched
+func bindPattern(pattern ast.Expression, value object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			return destructure(pattern, value, env, destructureBind)
+		}
+
+	case *ast.ArrayPattern:
+		elements := value.(*object.Array).Elements
+		for i, el := range pattern.Elements {
+			if err := bindPattern(el, elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := value.(*object.Array).Slice(len(pattern.Elements), len(elements))
+			return bindPattern(pattern.Rest, rest, env)
+		}
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+		}
+		values, _ := object.UnpackHash(value, keys)
+		for i, key := range pattern.Keys {
+			var err *object.Error
+			if pattern.Patterns[i] == nil {
+				err = bindPattern(key, values[i], env)
+			} else {
+				err = bindPattern(pattern.Patterns[i], values[i], env)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -531,7 +795,17 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
+}
+
+// isConstant returns true if name is bound to a constant or is a builtin
+// that is not shadowed
+func isConstant(name string, env *object.Environment) bool {
+	if _, ok := env.Get(name); ok {
+		return env.IsConst(name)
+	}
+	_, ok := builtins[name]
+	return ok
 }
 
 func evalExpressions(
@@ -551,35 +825,153 @@ func evalExpressions(
 	return result
 }
 
+// evalArguments evaluates the arguments of a call expanding the elements of
+// spread arrays, e.g: f(...xs)
+func evalArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := Eval(spread.Value, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return []object.Object{newError("cannot spread %s", evaluated.Type())}
+		}
+		result = append(result, array.Elements...)
+	}
+
+	return result
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		env := extendFunctionEnv(fn, args)
+		env, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		return unwrapReturnValue(Eval(fn.Body, env))
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		result, err := object.CallBuiltin(fn, callFunction, args...)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
 
+	case *object.Struct:
+		instance, err := fn.New(args)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return instance
+
+	case *object.BoundMethod:
+		return applyFunction(fn.Method, append([]object.Object{fn.Self}, args...))
+
 	default:
+		if hook, ok := object.Metamethod(fn, "__call"); ok {
+			return applyFunction(hook, append([]object.Object{fn}, args...))
+		}
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// callFunction applies fn to args returning an evaluation error as an error.
+// It is used to call metamethods on behalf of builtins and hash lookups.
+func callFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args)
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	return result, nil
+}
+
+// extendFunctionEnv returns a new environment enclosed by the function's
+// binding its parameters to args. Missing parameters with defaults are bound
+// to their default values, evaluated in the new environment, and any extra
+// arguments are collected into the rest parameter.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, *object.Error) {
+	err := object.CheckArity(
+		len(fn.Parameters), len(fn.Defaults), fn.Rest != nil, len(args),
+	)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+
 	env := fn.Env.Clone()
 
+	optional := len(fn.Parameters) - len(fn.Defaults)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+
+		value := Eval(fn.Defaults[paramIdx-optional], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(param.Value, value)
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
 	}
 
-	return env
+	return env, nil
+}
+
+// evalStructLiteral binds the struct's name to a new struct before defining
+// its methods, which close over the environment, so that they can refer to
+// the struct
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	fields := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		fields[i] = field.Value
+	}
+
+	if env.IsLocalConst(node.Name.Value) {
+		return newError("cannot assign to constant %s", node.Name.Value)
+	}
+
+	st, err := object.NewStruct(node.Name.Value, fields)
+	if err != nil {
+		return newError("%s", err)
+	}
+	env.Set(node.Name.Value, st)
+
+	for i, method := range node.Methods {
+		st.Methods[node.MethodNames[i].Value] = Eval(method, env)
+	}
+
+	return NULL
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -590,17 +982,104 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalIndexAssignmentExpression(left, index, value object.Object) object.Object {
-	switch {
-	case left.Type() == object.STRING && index.Type() == object.INTEGER:
-		return evalStringIndexExpression(left, index)
-	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH:
-		return evalHashIndexExpression(left, index)
+// evalSetItem sets the item of the array, hash or struct instance obj at
+// index to value
+func evalSetItem(obj, index, value object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if !object.IsInteger(index) {
+			return newError("set item operation not supported: left=%s index=%s",
+				obj.Type(), index.Type())
+		}
+		if obj.Frozen {
+			return newError("cannot modify frozen array")
+		}
+		idx, ok := index.(*object.Integer)
+		if !ok || idx.Value < 0 || idx.Value >= int64(len(obj.Elements)) {
+			return newError("%s", object.IndexOutOfBounds(index))
+		}
+		obj.Elements[idx.Value] = value
+
+	case *object.Hash:
+		if obj.Frozen {
+			return newError("cannot modify frozen hash")
+		}
+		hashKey, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		obj.Set(hashKey.HashKey(), object.HashPair{Key: index, Value: value})
+
+	case *object.Instance:
+		if err := obj.Set(index, value); err != nil {
+			return newError("%s", err)
+		}
+
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError("set item operation not supported: left=%s index=%s",
+			obj.Type(), index.Type())
+	}
+
+	return nil
+}
+
+// evalCompoundAssignment evaluates an assignment such as x += 1 or xs[i] += 1
+// evaluating the object and index of an index expression once
+func evalCompoundAssignment(node *ast.AssignmentExpression, env *object.Environment) object.Object {
+	switch left := node.Left.(type) {
+	case *ast.Identifier:
+		current := evalIdentifier(left, env)
+		if isError(current) {
+			return current
+		}
+		if isConstant(left.Value, env) {
+			return newError("cannot assign to constant %s", left.Value)
+		}
+
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		result := evalInfixExpression(node.Operator, current, value)
+		if isError(result) {
+			return result
+		}
+		env.Set(left.Value, result)
+
+	case *ast.IndexExpression:
+		obj := Eval(left.Left, env)
+		if isError(obj) {
+			return obj
+		}
+		index := Eval(left.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		current := evalIndexExpression(obj, index)
+		if isError(current) {
+			return current
+		}
+
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		result := evalInfixExpression(node.Operator, current, value)
+		if isError(result) {
+			return result
+		}
+		if err := evalSetItem(obj, index, result); err != nil {
+			return err
+		}
+
+	default:
+		return newError("expected identifier or index expression got=%T", left)
 	}
+
+	return NULL
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -611,30 +1090,174 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH:
 		return evalHashIndexExpression(left, index)
+	case isInstance(left):
+		return evalInstanceIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
+// isInt64 reports whether obj is an Integer, and not a BigInteger
+func isInt64(obj object.Object) bool {
+	_, ok := obj.(*object.Integer)
+	return ok
+}
+
+func isPattern(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.ArrayPattern, *ast.HashPattern:
+		return true
+	default:
+		return false
+	}
+}
+
+// destructureMode is how the identifiers of a destructuring pattern are
+// stored to
+type destructureMode int
+
+const (
+	// destructureAssign assigns existing variables as = does
+	destructureAssign destructureMode = iota
+	// destructureBind binds variables as := does
+	destructureBind
+	// destructureDefine defines new variables, as for pattern parameters
+	destructureDefine
+)
+
+// destructure destructures value into the identifiers of pattern, storing
+// them according to mode
+func destructure(pattern ast.Expression, value object.Object, env *object.Environment, mode destructureMode) *object.Error {
+	var (
+		targets []ast.Expression
+		values  []object.Object
+		err     error
+	)
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		switch mode {
+		case destructureAssign:
+			if _, ok := env.Get(pattern.Value); !ok {
+				return newError("identifier not found: %s", pattern.Value)
+			}
+			if isConstant(pattern.Value, env) {
+				return newError("cannot assign to constant %s", pattern.Value)
+			}
+		case destructureBind:
+			if env.IsLocalConst(pattern.Value) {
+				return newError("cannot assign to constant %s", pattern.Value)
+			}
+			fallthrough
+		case destructureDefine:
+			if immutable, ok := value.(object.Immutable); ok {
+				value = immutable.Clone()
+			}
+		}
+		env.Set(pattern.Value, value)
+		return nil
+
+	case *ast.ArrayPattern:
+		targets = append(targets, pattern.Elements...)
+		if pattern.Rest != nil {
+			targets = append(targets, pattern.Rest)
+		}
+		values, err = object.UnpackArray(value, len(pattern.Elements), pattern.Rest != nil)
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+			targets = append(targets, key)
+		}
+		values, err = object.UnpackHash(value, keys)
+
+	default:
+		return newError("invalid destructuring target %s", pattern)
+	}
+
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	for i, target := range targets {
+		if err := destructure(target, values[i], env, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{node.Start, node.End} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.String:
+		from, to, err := object.SliceBounds(left.Len(), bounds[0], bounds[1])
+		if err != nil {
+			return newError("%s", err)
+		}
+		return left.Slice(from, to)
+	case *object.Array:
+		from, to, err := object.SliceBounds(len(left.Elements), bounds[0], bounds[1])
+		if err != nil {
+			return newError("%s", err)
+		}
+		return left.Slice(from, to)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+	value, ok, err := hashObject.Index(index, callFunction)
+	if err != nil {
+		return newError("%s", err)
 	}
-
-	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
+}
+
+func isInstance(obj object.Object) bool {
+	_, ok := obj.(*object.Instance)
+	return ok
+}
+
+func evalInstanceIndexExpression(instance, index object.Object) object.Object {
+	value, err := instance.(*object.Instance).Get(index)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return value
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return newError("%s", object.IndexOutOfBounds(index))
+	}
+	idx := i.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if idx < 0 || idx > max {
@@ -646,23 +1269,22 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 
 func evalStringIndexExpression(str, index object.Object) object.Object {
 	stringObject := str.(*object.String)
-	idx := index.(*object.Integer).Value
-	max := int64(len(stringObject.Value) - 1)
-
-	if idx < 0 || idx > max {
-		return &object.String{Value: ""}
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return newError("%s", object.IndexOutOfBounds(index))
 	}
 
-	return &object.String{Value: string(stringObject.Value[idx])}
+	char, _ := stringObject.CharAt(idx.Value)
+	return &object.String{Value: char}
 }
 
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -673,14 +1295,14 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
 		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashed, object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
@@ -2,10 +2,12 @@ package eval
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
 
+	"github.com/prologic/monkey-lang/cover"
 	"github.com/prologic/monkey-lang/lexer"
 	"github.com/prologic/monkey-lang/object"
 	"github.com/prologic/monkey-lang/parser"
@@ -37,8 +39,18 @@ func TestEvalExpressions(t *testing.T) {
 		{"1 | 2", 3},
 		{"2 ^ 4", 6},
 		{"3 & 6", 2},
+		{"1 << 4", 16},
+		{"-256 >> 4", -16},
+		{"-1 >> 100", -1},
+		{"1 + 1 << 2", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"(1 << 100) >> 98", 4},
 		{`" " * 4`, "    "},
 		{`4 * " "`, "    "},
+		{`"ab" * -9223372036854775807`, ""},
 	}
 
 	for _, tt := range tests {
@@ -102,6 +114,39 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${1}"`, "1"},
+		{`x := 1; y := 2; "x=${x}, sum=${x + y}"`, "x=1, sum=3"},
+		{`"${"a"}${true}${null}${[1, "b"]}"`, "atruenull[1, \"b\"]"},
+		{`"\${x}"`, "${x}"},
+		{`"a\t${"}"}\n"`, "a\t}\n"},
+		{`"${ {"a": 1}["a"] }"`, "1"},
+		{`f := fn(n) { "n=${n}" }; f(42)`, "n=42"},
+		{`"${"${1 + 1}"}"`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+
+	evaluated := testEval(`"${x}"`)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "identifier not found: x" {
+		t.Errorf("expected identifier not found error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -184,6 +229,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 < 2) { 10 } else { 20 }", 10},
 		{"if (1 < 2) { 10 } else if (1 == 2) { 20 }", 10},
 		{"if (1 > 2) { 10 } else if (1 == 2) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (1 < 2) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (1 == 2) { 20 }", nil},
+		{"f := fn(n) { if (n < 0) { -1 } else if (n == 0) { 0 } else if (n < 10) { 1 } else { 2 } }; f(-5) + f(0) + f(5) + f(50)", 2},
+		{"x := 0; if (false) { x = 1 } else if (true) { x = 2 } else { x = 3 }; x", 2},
 	}
 
 	for _, tt := range tests {
@@ -211,6 +260,7 @@ func TestWhileExpressions(t *testing.T) {
 		{"n := 10; while (n > 0) { n = n - 1 }; n", 0},
 		{"n := 0; while (n < 10) { n = n + 1 }", nil},
 		{"n := 10; while (n > 0) { n = n - 1 }", nil},
+		{"f := fn() { n := 0; while (true) { if (n == 3) { return n }; n += 1 } }; f()", 3},
 	}
 
 	for _, tt := range tests {
@@ -274,6 +324,10 @@ func TestErrorHandling(t *testing.T) {
 			"5 + true; 5;",
 			"type mismatch: int + bool",
 		},
+		{
+			"n := 0; while (n < 10) { n += 1; if (n == 2) { x } }; n",
+			"identifier not found: x",
+		},
 		{
 			"-true",
 			"unknown operator: -bool",
@@ -314,6 +368,102 @@ if (10 > 1) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: fn",
 		},
+		{
+			`[1, 2, 3]["a":]`,
+			"slice index must be int, got str",
+		},
+		{
+			`{"a": 1}[1:2]`,
+			"slice operator not supported: hash",
+		},
+		{
+			`[a, b] := [1]`,
+			"cannot destructure array of length 1 into 2 elements",
+		},
+		{
+			`[a, ...b] := []`,
+			"cannot destructure array of length 0 into at least 1 elements",
+		},
+		{
+			`{a} := {"b": 1}`,
+			`missing key "a" in hash`,
+		},
+		{
+			`{a} := [1]`,
+			"cannot destructure array as hash",
+		},
+		{
+			`[a, b] = [1, 2]`,
+			"identifier not found: a",
+		},
+		{
+			`[...xs]`,
+			"unexpected spread expression ...xs",
+		},
+		{
+			`fn(a, b = 1) { a }()`,
+			"wrong number of arguments: want at least 1, got=0",
+		},
+		{
+			`fn(a, b = 1) { a }(1, 2, 3)`,
+			"wrong number of arguments: want at most 2, got=3",
+		},
+		{
+			`fn(a) { a }(...1)`,
+			"cannot spread int",
+		},
+		{
+			`"ab" * 9223372036854775807`,
+			"string repeat count too large: 9223372036854775807",
+		},
+		{
+			`9223372036854775807 * "ab"`,
+			"string repeat count too large: 9223372036854775807",
+		},
+		{
+			`len([0] * 100000000)`,
+			"array repeat count too large: 100000000",
+		},
+		{
+			`9223372036854775807 * [1, 2]`,
+			"array repeat count too large: 9223372036854775807",
+		},
+		{
+			"struct P { x }; P(1).y",
+			"unknown field y of P",
+		},
+		{
+			"struct P { x }; p := P(1); p.y = 2",
+			"unknown field y of P",
+		},
+		{
+			"struct P { x }; P(1)[0]",
+			"unusable as field name: int",
+		},
+		{
+			"struct P { x }; p := P(1); p[[1]] = 2",
+			"unusable as field name: array",
+		},
+		{
+			"h := {}; h[[1]] = 1",
+			"unusable as hash key: array",
+		},
+		{
+			`xs := [1]; xs["a"] = 2`,
+			"set item operation not supported: left=array index=str",
+		},
+		{
+			"xs := [1]; xs[1] = 2",
+			"index out of bounds: 1",
+		},
+		{
+			"struct P { x, y }; P(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"struct int { x }",
+			"struct int redefines a builtin type",
+		},
 	}
 
 	for _, tt := range tests {
@@ -375,6 +525,153 @@ func TestAssignmentExpressions(t *testing.T) {
 	}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"x := 9223372036854775807 * 4; [x / 4, typeof(x)]", `[9223372036854775807, "int"]`},
+		{"fact := fn(n) { if (n == 0) { return 1 }; n * fact(n - 1) }; fact(25)", "15511210043330985984000000"},
+		{"x := 9223372036854775807 * 2; [x > 1, x < 1, -x < 1, x >= x, x == x + 0, x != 1]", "[true, false, true, true, true, true]"},
+		{"[-(9223372036854775807 * 3), ~(9223372036854775807 * 2)]", "[-27670116110564327421, -18446744073709551615]"},
+		{"x := 9223372036854775807 * 2; [x % 1000, x & 255]", "[614, 254]"},
+		{`h := {9223372036854775807 * 2: "a"}; h[9223372036854775807 + 9223372036854775807]`, `"a"`},
+		{"9223372036854775808", "9223372036854775808"},
+		{"[0x1_0000_0000_0000_0000, 0o2000000000000000000000]", "[18446744073709551616, 18446744073709551616]"},
+		{"-9223372036854775808 == -9223372036854775807 - 1", "true"},
+		{"match (18446744073709551616) { 18446744073709551616 => 1, _ => 2 }", "1"},
+		{"[1][9223372036854775807 * 2]", "ERROR: index out of bounds: 18446744073709551614"},
+		{`"a"[9223372036854775807 * 2]`, "ERROR: index out of bounds: 18446744073709551614"},
+		{"[1][(1 << 64):]", "ERROR: index out of bounds: 18446744073709551616"},
+		{"xs := [1]; xs[1 << 64] = 2", "ERROR: index out of bounds: 18446744073709551616"},
+		{`int("-100000000000000000000") / 10`, "-10000000000000000000"},
+		{"(9223372036854775807 * 2) / 0", "ERROR: division by zero"},
+		{"1 % (9223372036854775807 * 2 - 9223372036854775807 * 2)", "ERROR: division by zero"},
+		{"1 << -1", "ERROR: negative shift count"},
+		{"(1 << 64) >> -1", "ERROR: negative shift count"},
+		{"1 << (1 << 64)", "ERROR: shift count too large"},
+		{"2 ** -1", "ERROR: negative exponent"},
+		{"1 << 100000000000", "ERROR: shift count too large"},
+		{"(1 << 64) << 16777210", "ERROR: shift count too large"},
+		{"2 ** 100000000000", "ERROR: exponent too large"},
+		{"(1 << 64) ** (1 << 64)", "ERROR: exponent too large"},
+		{"[0 << 100000000000, 1 ** 100000000000, (-1) ** 100000000001]", "[0, 1, -1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs := freeze([1, [2]]); [isFrozen(xs), isFrozen(xs[1])]", "[true, true]"},
+		{`h := freeze({"a": {"b": [1]}}); isFrozen(h.a.b)`, "true"},
+		{"isFrozen([1])", "false"},
+		{`[isFrozen(1), isFrozen("a"), isFrozen(null)]`, "[true, true, true]"},
+		{"xs := freeze([1]); ys := xs + [2]; ys[1] = 3; ys", "[1, 3]"},
+		{`h := {}; h.self = h; freeze(h); isFrozen(h.self)`, "true"},
+		{"xs := freeze([1]); xs[0] = 2", "ERROR: cannot modify frozen array"},
+		{`h := freeze({"a": [1]}); h.a[0] += 1`, "ERROR: cannot modify frozen array"},
+		{`h := freeze({}); h["a"] = 1`, "ERROR: cannot modify frozen hash"},
+		{"h := freeze({}); h.a = 1", "ERROR: cannot modify frozen hash"},
+		{"struct P { x }; p := freeze(P([1])); [isFrozen(p), isFrozen(p.x), isFrozen(P(1))]", "[true, true, false]"},
+		{"struct P { x }; p := freeze(P(1)); p.x = 2", "ERROR: cannot modify frozen P"},
+		{`struct P { x }; p := freeze(P(1)); p["x"] += 1`, "ERROR: cannot modify frozen P"},
+		{"push(freeze([]), 1)", "ERROR: cannot modify frozen array"},
+		{"pop(freeze([1]))", "ERROR: cannot modify frozen array"},
+		{"setmeta(freeze({}), {})", "ERROR: cannot modify frozen hash"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1; x", "1"},
+		{"const f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(10)", "55"},
+		{"const xs = [1]; xs[0] = 2; xs", "[2]"},
+		{"x := 1; const x = 2; x", "2"},
+		{"const x = 1; f := fn(x) { x += 1; x }; f(5)", "6"},
+		{"len := fn(x) { 0 }; len = fn(x) { 1 }; len([])", "1"},
+		{"i := 0; ys := []; while (i < 3) { const y = i * 2; ys = push(ys, y); i += 1 }; ys", "[0, 2, 4]"},
+		{"f := fn(n) { const y = n; y }; [f(1), f(2)]", "[1, 2]"},
+		{"const x = 1; f := fn() { x := 2; x }; [f(), x]", "[2, 1]"},
+		{"const x = 1; f := fn() { const x = 2; x }; [f(), x]", "[2, 1]"},
+		{"const x = 1; f := fn() { [x, y] := [2, 3]; x + y }; [f(), x]", "[5, 1]"},
+		{"f := fn() { const n = 1; fn() { n := 2; n } }; f()()", "2"},
+		{"const x = 1; x = 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; x -= 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; x := 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; const x = 2", "ERROR: cannot assign to constant x"},
+		{"i := 0; while (i < 2) { const y = i; const y = 2; i += 1 }", "ERROR: cannot assign to constant y"},
+		{"const x = 1; [x] = [2]", "ERROR: cannot assign to constant x"},
+		{"const x = 1; {x} := {\"x\": 2}", "ERROR: cannot assign to constant x"},
+		{"const x = 1; f := fn() { x = 2 }; f()", "ERROR: cannot assign to constant x"},
+		{"f := fn() { const x = 1; x := 2 }; f()", "ERROR: cannot assign to constant x"},
+		{"const P = 1; struct P { x }", "ERROR: cannot assign to constant P"},
+		{"const x = 1; match (5) { x => x }", "ERROR: cannot assign to constant x"},
+		{"const x = 1; match ([5, 6]) { [y, ...x] => x }", "ERROR: cannot assign to constant x"},
+		{`const r = 1; match ({"r": [5]}) { {r: [r]} => r }`, "ERROR: cannot assign to constant r"},
+		{"const x = 1; match (5) { y => y }", "5"},
+		{"len = 1", "ERROR: cannot assign to constant len"},
+		{"len += 1", "ERROR: cannot assign to constant len"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x := 1; x += 2", "null"},
+		{"x := 1; x += 2; x", "3"},
+		{"x := 10; x -= 3; x *= 2; x /= 7; x", "2"},
+		{"x := 12; x &= 10; x |= 1; x ^= 3; x", "10"},
+		{`s := "foo"; s += "bar"; s`, `"foobar"`},
+		{"f := fn() { n := 1; n += 4; n }; f()", "5"},
+		{"xs := [1, 2]; xs[1] *= 5; xs", "[1, 10]"},
+		{`h := {"count": 0}; h.count += 1; h.count += 1; h.count`, "2"},
+		{"struct P { x }; p := P(1); p.x += 2; p", "P{x: 3}"},
+		{"n := [0]; xs := [0, 0]; i := fn() { n[0] += 1; 1 }; xs[i()] += 5; [n, xs]", "[[1], [0, 5]]"},
+		{"x := 1; x += true", "ERROR: type mismatch: int + bool"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestBindExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -434,6 +731,34 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f := fn(a, b = 10) { a + b }; f(1)", "11"},
+		{"f := fn(a, b = 10) { a + b }; f(1, 2)", "3"},
+		{"f := fn(a = 1, b = a + 1) { [a, b] }; f()", "[1, 2]"},
+		{"f := fn(a = 1, b = a + 1) { [a, b] }; f(5)", "[5, 6]"},
+		{"x := 1; f := fn(a = x) { a }; x = 2; f()", "2"},
+		{"f := fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+		{"f := fn(a, b = 2, ...rest) { [a, b, rest] }; f(1)", "[1, 2, []]"},
+		{"f := fn([a, b] = [1, 2]) { a + b }; f()", "3"},
+		{"f := fn(a, b, c) { [a, b, c] }; f(1, ...[2], 3)", "[1, 2, 3]"},
+		{"f := fn(...xs) { xs }; xs := [1, 2]; f(0, ...xs, ...xs)", "[0, 1, 2, 1, 2]"},
+		{`len(...["abc"])`, "3"},
+		{"fn(a, b = 10, ...rest) { a }", "fn(a, b = 10, ...rest) {\na\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 	newAdder := fn(x) {
@@ -498,6 +823,18 @@ func TestStringIndexExpressions(t *testing.T) {
 			`"foo"[-1]`,
 			"",
 		},
+		{
+			`"héllo, 世界"[1]`,
+			"é",
+		},
+		{
+			`"héllo, 世界"[8]`,
+			"界",
+		},
+		{
+			`"héllo, 世界"[9]`,
+			"",
+		},
 	}
 
 	for _, tt := range tests {
@@ -560,6 +897,23 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`str("foo")`, "foo"},
 		{`str([1, 2, 3])`, "[1, 2, 3]"},
 		{`str({"a": 1})`, "{\"a\": 1}"},
+		{`len("héllo, 世界")`, 9},
+		{`ord("a")`, 97},
+		{`ord("世")`, 19990},
+		{`ord("ab")`, errors.New("argument to `ord` must be a single character, got 2")},
+		{`ord(1)`, errors.New("argument to `ord` must be str, got int")},
+		{`chr(97)`, "a"},
+		{`chr(19990)`, "世"},
+		{`chr(-1)`, errors.New("argument to `chr` is not a valid code point: -1")},
+		{`chr(55296)`, errors.New("argument to `chr` is not a valid code point: 55296")},
+		{`chr(1 << 70)`, errors.New("argument to `chr` is not a valid code point: 1180591620717411303424")},
+		{`exit(1 << 70)`, errors.New("argument to `exit` is out of range: 1180591620717411303424")},
+		{`bool(1 << 70)`, true},
+		{`len(bytes("é"))`, 2},
+		{`bytes("é")[1]`, 169},
+		{`bytes(1)`, errors.New("argument to `bytes` must be str, got int")},
+		{`find("世界", "界")`, 1},
+		{`"\u{48}\u{1F600}"`, "H😀"},
 	}
 
 	for _, tt := range tests {
@@ -701,6 +1055,160 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[a, b] := [1, 2]; a + b", "3"},
+		{"[a, ...rest] := [1, 2, 3]; rest", "[2, 3]"},
+		{"[a, ...rest] := [1]; rest", "[]"},
+		{"[[a, b], c] := [[1, 2], 3]; [a, b, c]", "[1, 2, 3]"},
+		{`{name, age} := {"name": "Bob", "age": 42}; [name, age]`, `["Bob", 42]`},
+		{`[{x}, [y]] := [{"x": 1}, [2]]; x + y`, "3"},
+		{"a := 1; b := 2; [a, b] = [b, a]; [a, b]", "[2, 1]"},
+		{"[a, b] := [1, 2]", "null"},
+		{"f := fn(xs) { [a, ...b] := xs; b }; f([1, 2, 3])", "[2, 3]"},
+		{`f := fn([a, b], {c}) { a + b + c }; f([1, 2], {"c": 3})`, "6"},
+		{"x := 1; f := fn([x]) { x }; [f([5]), x]", "[5, 1]"},
+		{"const x = 1; f := fn([x]) { x }; [f([5]), x]", "[5, 1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (1) { 1 => "one", _ => "other" }`, `"one"`},
+		{`match (2) { 1 => "one" }`, "null"},
+		{`match ("b") { "a" | "b" => 1, _ => 2 }`, "1"},
+		{`match (-1) { -1 => true }`, "true"},
+		{`match ("1") { 1 => "int", "1" => "str" }`, `"str"`},
+		{`match ([1, 2]) { [] => 0, [x] => x, [x, y] => x + y }`, "3"},
+		{`match ([1, 2, 3]) { [x, ...rest] => rest }`, "[2, 3]"},
+		{`match ([2, 1]) { [x, y] if x < y => "asc", [x, y] => "desc" }`, `"desc"`},
+		{`match ({"kind": "circle", "r": 2}) { {kind: "square"} => 0, {kind: "circle", r} => r * r }`, "4"},
+		{`match ([1]) { {} => "hash", [_] => "array" }`, `"array"`},
+		{`match (3) { n => {} }`, "null"},
+		{"x := [1, 2]; match (x) { [y, x] => [x, y] }", "[2, 1]"},
+		{`f := fn(n) { match (n) { 0 => 0, n => n + f(n - 1) } }; f(10)`, "55"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "null"},
+		{"struct Point { x, y }; Point(1, [2])", "Point{x: 1, y: [2]}"},
+		{"struct Point { x, y }; Point", "<struct Point>"},
+		{`struct Point { x, y }; p := Point(1, 2); p.x + p["y"]`, "3"},
+		{"struct Point { x, y }; typeof(Point(1, 2))", `"Point"`},
+		{"struct Point { x, y }; p := Point(1, 2); p.x = 3; p", "Point{x: 3, y: 2}"},
+		{"struct Point { x, y, fn norm() { self.x * self.x + self.y * self.y } }; Point(3, 4).norm()", "25"},
+		{"struct Point { x, y, fn add(o) { Point(self.x + o.x, self.y + o.y) } }; Point(1, 2).add(Point(3, 4))", "Point{x: 4, y: 6}"},
+		{"struct C { n, fn inc(by = 1) { self.n = self.n + by; self } }; C(0).inc().inc(2).n", "3"},
+		{"struct C { n, fn get() { self.n } }; C(7).get", "<bound method C.get>"},
+		{"struct S { xs, fn len() { len(self.xs) } }; S([1, 2]).len()", "2"},
+		{"make := fn(v) { struct Box { v, fn get() { v } }; Box(v) }; make(5).get()", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestMetatables(t *testing.T) {
+	vec := `V := {}; vec := fn(x, y) { setmeta({"x": x, "y": y}, V) }
+V["__add"] = fn(a, b) { vec(a.x + b.x, a.y + b.y) }
+V["__eq"] = fn(a, b) { a.x == b.x && a.y == b.y }
+V["__lt"] = fn(a, b) { a.x < b.x }
+V["__str"] = fn(v) { "(${v.x}, ${v.y})" }
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`getmeta({})`, "null"},
+		{`h := setmeta({}, {}); setmeta(h, null); getmeta(h)`, "null"},
+		{vec + `v := vec(1, 2) + vec(3, 4); v.y`, "6"},
+		{vec + `1 + setmeta({}, {"__add": fn(a, b) { a }})`, "1"},
+		{vec + `xs := [vec(1, 2) == vec(1, 2), vec(1, 2) != vec(1, 2), vec(1, 2) == vec(2, 2)]; xs`, "[true, false, false]"},
+		{vec + `xs := [vec(1, 0) < vec(2, 0), vec(1, 0) > vec(2, 0), vec(1, 0) <= vec(1, 0), vec(1, 0) >= vec(2, 0)]; xs`, "[true, false, true, false]"},
+		{vec + `str(vec(1, 2))`, `"(1, 2)"`},
+		{vec + `"v=${vec(1, 2)}"`, `"v=(1, 2)"`},
+		{`len(setmeta({}, {"__len": fn(h) { 42 }}))`, "42"},
+		{`h := setmeta({"x": 1}, {"__index": {"y": 2}}); [h.x, h.y, h.z]`, "[1, 2, null]"},
+		{`h := setmeta({}, {"__index": fn(h, k) { k + "!" }}); h.hi`, `"hi!"`},
+		{`h := setmeta({"n": 2}, {"__call": fn(self, x) { self.n * x }}); h(21)`, "42"},
+		{`m := {}; m["__index"] = setmeta({}, m); setmeta({}, m).x`, `ERROR: __index chain too long looking up "x"`},
+		{`str(setmeta({}, {"__str": fn(h) { 1 }}))`, "ERROR: __str must return str, got int"},
+		{`setmeta(1, {})`, "ERROR: argument #1 to `setmeta` must be hash, got int"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{"xs := [1, 2, 3]; ys := xs[:]; ys[0] = 4; xs", "[1, 2, 3]"},
+		{`"monkey"[1:3]`, `"on"`},
+		{`"monkey"[:-3]`, `"mon"`},
+		{`"monkey"[3:]`, `"key"`},
+		{`"héllo, 世界"[1:2]`, `"é"`},
+		{`"héllo, 世界"[-2:]`, `"世界"`},
+		{`"monkey"[10:]`, `""`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong slice for %q. got=%s, want=%s",
+				tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `two := "two";
     {
@@ -741,6 +1249,34 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"c": 1, "a": 2, "b": 3}`, `{"c": 1, "a": 2, "b": 3}`},
+		{`h := {"b": 1}; h["a"] = 2; h.c = 3; h.b = 4; h`, `{"b": 4, "a": 2, "c": 3}`},
+		{`{"b": 1, "a": 2} + {"c": 3, "b": 4}`, `{"b": 4, "a": 2, "c": 3}`},
+		{`keys({"b": 1, "a": 2})`, `["b", "a"]`},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`items({"b": 1, 2: true})`, `[["b", 1], [2, true]]`},
+		{`h := {"a": 1, "b": 2}; [delete(h, "a"), delete(h, "a"), h]`, `[true, false, {"b": 2}]`},
+		{`h := {"a": 1, "b": 2}; delete(h, "a"); h.a = 3; keys(h)`, `["b", "a"]`},
+		{`h := {"a": null}; [has(h, "a"), has(h, "b"), has(h, 1)]`, "[true, false, false]"},
+		{`keys([])`, "ERROR: argument to `keys` must be hash, got array"},
+		{`has({}, [])`, "ERROR: unusable as hash key: array"},
+		{`delete(freeze({"a": 1}), "a")`, "ERROR: cannot modify frozen hash"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashMerging(t *testing.T) {
 	input := `{"a": 1} + {"b": 2}`
 	evaluated := testEval(input)
@@ -844,6 +1380,28 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestCoverage(t *testing.T) {
+	input := `
+	f := fn(x) {
+		if (x > 1) {
+			return "big"
+		}
+		return "small"
+	}
+	f(0); f(1)
+	`
+
+	Coverage = cover.Counts{}
+	defer func() { Coverage = nil }()
+
+	testEval(input)
+
+	expected := cover.Counts{2: 1, 3: 2, 6: 2, 8: 2}
+	if fmt.Sprint(Coverage) != fmt.Sprint(expected) {
+		t.Errorf("wrong coverage. want=%v, got=%v", expected, Coverage)
+	}
+}
+
 func TestExamples(t *testing.T) {
 	matches, err := filepath.Glob("./examples/*.monkey")
 	if err != nil {
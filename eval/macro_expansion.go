@@ -0,0 +1,205 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/object"
+)
+
+// DefineMacros removes all top-level macro definitions of the form
+// `name := macro(...) { ... }` from program and binds them in env
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		if name, macro, ok := macroDefinition(statement); ok {
+			env.Set(name, &object.Macro{
+				Parameters: macro.Parameters,
+				Body:       macro.Body,
+				Env:        env,
+			})
+			continue
+		}
+		statements = append(statements, statement)
+	}
+
+	program.Statements = statements
+}
+
+func macroDefinition(statement ast.Statement) (string, *ast.MacroLiteral, bool) {
+	stmt, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return "", nil, false
+	}
+
+	be, ok := stmt.Expression.(*ast.BindExpression)
+	if !ok {
+		return "", nil, false
+	}
+
+	ident, ok := be.Left.(*ast.Identifier)
+	if !ok {
+		return "", nil, false
+	}
+
+	macro, ok := be.Value.(*ast.MacroLiteral)
+	if !ok {
+		return "", nil, false
+	}
+
+	return ident.Value, macro, true
+}
+
+// ExpandMacros replaces all calls to the macros defined in env within
+// program by the quoted AST node they evaluate to. Macros receive their
+// arguments unevaluated as quoted AST nodes. Returns an error if a call to
+// `quote` remains outside of a macro, as only the evaluator could run it,
+// unless the program binds `quote` itself.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf(
+				"wrong number of arguments: want=%d, got=%d",
+				len(macro.Parameters), len(call.Arguments),
+			)
+			return node
+		}
+
+		evaluated := Eval(macro.Body, extendMacroEnv(macro, quoteArgs(call)))
+
+		switch evaluated := unwrapReturnValue(evaluated).(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			err = fmt.Errorf("%s", evaluated.Message)
+		default:
+			err = fmt.Errorf(
+				"macro %s must return a quoted AST node",
+				call.Function,
+			)
+		}
+		return node
+	})
+	if err != nil || bindsName(expanded, "quote") {
+		return expanded, err
+	}
+
+	ast.Inspect(expanded, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok && err == nil {
+			if ident, ok := call.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+				err = fmt.Errorf("quote can only be used in a macro")
+			}
+		}
+		return err == nil
+	})
+
+	return expanded, err
+}
+
+// bindsName reports whether name is bound anywhere within node by a binding,
+// a parameter, a match pattern or a struct
+func bindsName(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BindExpression:
+			found = found || patternBindsName(node.Left, name)
+		case *ast.MatchArm:
+			found = found || patternBindsName(node.Pattern, name)
+		case *ast.StructLiteral:
+			found = found || node.Name.Value == name
+		case *ast.FunctionLiteral:
+			for _, p := range node.Parameters {
+				found = found || p.Value == name
+			}
+			found = found || node.Rest != nil && node.Rest.Value == name
+		}
+		return !found
+	})
+	return found
+}
+
+// patternBindsName reports whether the identifier, destructuring pattern or
+// match pattern binds name
+func patternBindsName(pattern ast.Expression, name string) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return pattern.Value == name
+	case *ast.AlternativePattern:
+		for _, alt := range pattern.Alternatives {
+			if patternBindsName(alt, name) {
+				return true
+			}
+		}
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			if patternBindsName(el, name) {
+				return true
+			}
+		}
+		return pattern.Rest != nil && pattern.Rest.Value == name
+	case *ast.HashPattern:
+		for i, key := range pattern.Keys {
+			if i < len(pattern.Patterns) && pattern.Patterns[i] != nil {
+				if patternBindsName(pattern.Patterns[i], name) {
+					return true
+				}
+			} else if key.Value == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isMacroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func quoteArgs(call *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range call.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	env := macro.Env.Clone()
+
+	for paramIdx, param := range macro.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
@@ -0,0 +1,123 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/token"
+)
+
+// quote returns node unevaluated as a Quote object after replacing all
+// unquote(...) calls within it by the AST node of their evaluated argument
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node, err := evalUnquoteCalls(node, env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// isQuoteCall reports whether call is a call to quote, i.e: to the name
+// `quote` not bound in env
+func isQuoteCall(call *ast.CallExpression, env *object.Environment) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok || ident.Value != "quote" {
+		return false
+	}
+	_, bound := env.Get(ident.Value)
+	return !bound
+}
+
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
+			return node
+		}
+
+		call := node.(*ast.CallExpression)
+		if len(call.Arguments) != 1 {
+			err = newError(
+				"wrong number of arguments: want=1, got=%d",
+				len(call.Arguments),
+			)
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if isError(unquoted) {
+			err = unquoted.(*object.Error)
+			return node
+		}
+
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	return node, err
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// convertObjectToASTNode returns the AST node of a literal evaluating to obj
+func convertObjectToASTNode(obj object.Object) (ast.Expression, bool) {
+	switch obj := obj.(type) {
+
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.BigInteger:
+		t := token.Token{Type: token.INT, Literal: obj.Value.String()}
+		return &ast.IntegerLiteral{Token: t, Big: new(big.Int).Set(obj.Value)}, true
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, true
+
+	case *object.Null:
+		t := token.Token{Type: token.NULL, Literal: "null"}
+		return &ast.Null{Token: t}, true
+
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			element, ok := convertObjectToASTNode(el)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = element
+		}
+		t := token.Token{Type: token.LBRACKET, Literal: "["}
+		return &ast.ArrayLiteral{Token: t, Elements: elements}, true
+
+	case *object.Quote:
+		expression, ok := obj.Node.(ast.Expression)
+		return expression, ok
+
+	default:
+		return nil, false
+	}
+}
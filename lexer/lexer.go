@@ -6,17 +6,23 @@ package lexer
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/prologic/monkey-lang/token"
 )
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
 // Lexer represents the lexer and contains the source input and internal state
@@ -24,46 +30,72 @@ type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
-	prevCh       byte // previous char read
+	ch           rune // current char (Unicode code point) under examination
+	prevCh       rune // previous char read
+	line         int  // current line in input (of current char)
+	column       int  // current column in input (of current char)
 }
 
-func newToken(tokenType token.Type, ch byte) token.Token {
+func newToken(tokenType token.Type, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// newError returns an ILLEGAL token for a malformed literal whose literal is
+// the error message so the parser can report it
+func newError(err error) token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+}
+
 // New returns a new Lexer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
 	l.prevCh = l.ch
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
+	l.column++
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
 	}
 }
 
 // NextToken returns the next token read from the input stream
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
+func (l *Lexer) NextToken() (tok token.Token) {
 	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '*' {
+		line, column := l.line, l.column
+		if !l.skipBlockComment() {
+			return token.Token{Type: token.ILLEGAL, Literal: "/*", Line: line, Column: column}
+		}
+		l.skipWhitespace()
+	}
+
+	line, column := l.line, l.column
+	defer func() {
+		tok.Line, tok.Column = line, column
+	}()
 
 	switch l.ch {
 	case '#':
@@ -75,13 +107,28 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -94,21 +141,46 @@ func (l *Lexer) NextToken() token.Token {
 	case '/':
 		if l.peekChar() == '/' {
 			l.readChar() // skip over the '/'
-			tok.Type = token.COMMENT
+			// A third '/' starts a doc comment unless followed by more
+			if l.peekChar() == '/' && !strings.HasPrefix(l.input[l.readPosition:], "//") {
+				l.readChar()
+				tok.Type = token.DOC_COMMENT
+			} else {
+				tok.Type = token.COMMENT
+			}
 			tok.Literal = l.readLine()
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.DIVIDE_ASSIGN, Literal: "/="}
 		} else {
 			tok = newToken(token.DIVIDE, l.ch)
 		}
 	case '*':
-		tok = newToken(token.MULTIPLY, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: "**"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MULTIPLY_ASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.MULTIPLY, l.ch)
+		}
 	case '%':
-		tok = newToken(token.MODULO, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MODULO_ASSIGN, Literal: "%="}
+		} else {
+			tok = newToken(token.MODULO, l.ch)
+		}
 	case '&':
 		if l.peekChar() == '&' {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.AND, Literal: literal}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.BitwiseAND_ASSIGN, Literal: "&="}
 		} else {
 			tok = newToken(token.BitwiseAND, l.ch)
 		}
@@ -118,15 +190,26 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.OR, Literal: literal}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.BitwiseOR_ASSIGN, Literal: "|="}
 		} else {
 			tok = newToken(token.BitwiseOR, l.ch)
 		}
 	case '^':
-		tok = newToken(token.BitwiseXOR, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.BitwiseXOR_ASSIGN, Literal: "^="}
+		} else {
+			tok = newToken(token.BitwiseXOR, l.ch)
+		}
 	case '~':
 		tok = newToken(token.BitwiseNOT, l.ch)
 	case '<':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.LSHIFT, Literal: "<<"}
+		} else if l.peekChar() == '=' {
 			l.readChar()
 			tok = newToken(token.LTE, l.ch)
 			tok.Literal = "<="
@@ -134,7 +217,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.LT, l.ch)
 		}
 	case '>':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.RSHIFT, Literal: ">>"}
+		} else if l.peekChar() == '=' {
 			l.readChar()
 			tok = newToken(token.GTE, l.ch)
 			tok.Literal = ">="
@@ -155,7 +241,13 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if strings.HasPrefix(l.input[l.readPosition:], "..") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -172,9 +264,27 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	case '"':
-		str, err := l.readString()
+		if strings.HasPrefix(l.input[l.readPosition:], `""`) {
+			tok = l.readMultilineString()
+			break
+		}
+
+		position := l.position + 1
+		texts, exprs, err := l.readString('"')
 		if err != nil {
-			tok = newToken(token.ILLEGAL, l.prevCh)
+			tok = newError(err)
+			l.skipString()
+		} else if len(exprs) > 0 {
+			tok.Type = token.TEMPLATE
+			tok.Literal = l.input[position:l.position]
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = texts[0]
+		}
+	case '`':
+		str, err := l.readRawString()
+		if err != nil {
+			tok = newError(err)
 		} else {
 			tok.Type = token.STRING
 			tok.Literal = str
@@ -206,9 +316,12 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// readNumber reads an integer literal including any base prefix such as 0x
+// and _ digit separators. Any letters or digits that follow are read as part
+// of the literal for the parser to report them as malformed.
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for isDigit(l.ch) {
+	for isDigit(l.ch) || isLetter(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -225,13 +338,23 @@ func (l *Lexer) readLine() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() (string, error) {
+// readString reads a string literal up to and including its closing quote
+// (or the end of the input if quote is 0) and returns its text parts (with
+// escapes processed) and the source of the expressions of any ${...}
+// interpolations between them. There is always one more text part than
+// expressions.
+func (l *Lexer) readString(quote rune) ([]string, []string, error) {
+	var (
+		texts []string
+		exprs []string
+	)
+
 	b := &strings.Builder{}
 	for {
 		l.readChar()
 
-		// Support some basic escapes like \"
-		if l.ch == '\\' {
+		// Support some basic escapes like \" (a trailing '\\' is left as is)
+		if l.ch == '\\' && l.peekChar() != 0 {
 			switch l.peekChar() {
 			case '"':
 				b.WriteByte('"')
@@ -243,33 +366,267 @@ func (l *Lexer) readString() (string, error) {
 				b.WriteByte('\t')
 			case '\\':
 				b.WriteByte('\\')
+			case '$':
+				b.WriteByte('$')
 			case 'x':
 				// Skip over the the '\\', 'x' and the next two bytes (hex)
 				l.readChar()
 				l.readChar()
 				l.readChar()
-				src := string([]byte{l.prevCh, l.ch})
+				src := string([]rune{l.prevCh, l.ch})
 				dst, err := hex.DecodeString(src)
 				if err != nil {
-					return "", err
+					return nil, nil, fmt.Errorf("invalid \\x escape %q", src)
 				}
 				b.Write(dst)
 				continue
+			case 'u':
+				// Skip over the '\\' and 'u' and read the code point in
+				// hex between the braces
+				l.readChar()
+				ch, err := l.readCodePoint()
+				if err != nil {
+					return nil, nil, err
+				}
+				b.WriteRune(ch)
+				continue
 			}
 
 			// Skip over the '\\' and the matched single escape char
 			l.readChar()
 			continue
+		} else if l.ch == '$' && l.peekChar() == '{' {
+			expr, err := l.readInterpolation()
+			if err != nil {
+				return nil, nil, err
+			}
+			texts = append(texts, b.String())
+			exprs = append(exprs, expr)
+			b.Reset()
+			continue
 		} else {
-			if l.ch == '"' || l.ch == 0 {
+			if l.ch == quote || l.ch == 0 {
 				break
 			}
 		}
 
-		b.WriteByte(l.ch)
+		// Copy the char's bytes as is so invalid UTF-8 is preserved
+		b.WriteString(l.input[l.position:l.readPosition])
+	}
+
+	return append(texts, b.String()), exprs, nil
+}
+
+// readCodePoint reads a Unicode code point in hex between braces, e.g: {1F600}
+// up to and including the closing brace
+func (l *Lexer) readCodePoint() (rune, error) {
+	l.readChar()
+	if l.ch != '{' {
+		return 0, errors.New("expected { after \\u")
 	}
 
-	return b.String(), nil
+	position := l.position + 1
+	for l.peekChar() != '}' {
+		if l.peekChar() == 0 || l.peekChar() == '"' {
+			return 0, errors.New("unterminated \\u{...} escape")
+		}
+		l.readChar()
+	}
+	src := l.input[position:l.readPosition]
+	l.readChar() // skip over the '}'
+
+	n, err := strconv.ParseUint(src, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, fmt.Errorf("invalid code point %q in \\u{...} escape", src)
+	}
+
+	return rune(n), nil
+}
+
+// readInterpolation reads an interpolation ${...} starting at its '$' up to
+// and including the matching '}' and returns the source of its expression
+func (l *Lexer) readInterpolation() (string, error) {
+	l.readChar() // skip over the '$'
+	position := l.position + 1
+
+	depth := 1
+	for depth > 0 {
+		l.readChar()
+
+		switch l.ch {
+		case 0:
+			return "", errors.New("unterminated string interpolation")
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if _, _, err := l.readString('"'); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return l.input[position:l.position], nil
+}
+
+// Template splits the literal of a TEMPLATE token into its text parts (with
+// escapes processed) and the source of the expressions interpolated between
+// them. There is always one more text part than expressions.
+func Template(literal string) ([]string, []string, error) {
+	// The literal of a multi-line string may contain unescaped quotes so
+	// read it up to the end of the input rather than a closing quote
+	l := &Lexer{input: literal, line: 1}
+	return l.readString(0)
+}
+
+// readRawString reads a raw string literal between backticks up to and
+// including its closing backtick. Raw strings may span lines and their
+// contents are taken as is without processing escapes or interpolations.
+func (l *Lexer) readRawString() (string, error) {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			return "", errors.New("unterminated raw string")
+		} else if l.ch == '`' {
+			break
+		}
+	}
+	return l.input[position:l.position], nil
+}
+
+// readMultilineString reads a triple-quoted string literal up to and
+// including its closing quotes. The indentation common to its lines is
+// stripped before its escapes and interpolations are processed as for a
+// regular string literal.
+func (l *Lexer) readMultilineString() token.Token {
+	l.readChar()
+	l.readChar() // skip over the opening quotes
+	position := l.position + 1
+
+	var err error
+	for {
+		l.readChar()
+
+		if l.ch == 0 || l.ch == '"' && strings.HasPrefix(l.input[l.position:], `"""`) {
+			break
+		} else if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		} else if l.ch == '$' && l.peekChar() == '{' {
+			if _, err = l.readInterpolation(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil && l.ch == 0 {
+		err = errors.New("unterminated multi-line string")
+	}
+	end := l.position
+	if end > len(l.input) {
+		end = len(l.input)
+	}
+	body := trimIndent(l.input[position:end])
+
+	if l.ch != 0 {
+		l.readChar()
+		l.readChar() // skip over the closing quotes but the last
+	}
+
+	if err != nil {
+		return newError(err)
+	}
+
+	texts, exprs, err := (&Lexer{input: body, line: 1}).readString(0)
+	if err != nil {
+		return newError(err)
+	} else if len(exprs) > 0 {
+		return token.Token{Type: token.TEMPLATE, Literal: body}
+	}
+	return token.Token{Type: token.STRING, Literal: texts[0]}
+}
+
+// trimIndent drops the first line of a multi-line string if it is blank (the
+// line break after the opening quotes) and the last line if it is blank (the
+// indentation of the closing quotes) and removes the indentation common to
+// the remaining non-blank lines. Blank lines are made empty.
+func trimIndent(s string) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) == 1 {
+		return s
+	}
+
+	if strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		prefix := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = prefix, false
+			continue
+		}
+
+		i := 0
+		for i < len(indent) && i < len(prefix) && indent[i] == prefix[i] {
+			i++
+		}
+		indent = indent[:i]
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = line[len(indent):]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// skipString skips over the rest of a string literal whose escapes or
+// interpolations are invalid so lexing continues after its closing quote
+func (l *Lexer) skipString() {
+	for l.ch != '"' && l.ch != 0 {
+		if l.ch == '\\' {
+			l.readChar()
+		}
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips over a block comment /* ... */ starting at its '/'
+// up to and including its closing */ and reports false if it is unterminated.
+// Block comments may be nested.
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+	for {
+		switch {
+		case l.ch == 0:
+			return false
+		case l.ch == '/' && l.peekChar() == '*':
+			l.readChar()
+			depth++
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			depth--
+			if depth == 0 {
+				l.readChar()
+				return true
+			}
+		}
+		l.readChar()
+	}
 }
 
 func (l *Lexer) skipWhitespace() {
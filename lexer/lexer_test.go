@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/prologic/monkey-lang/token"
@@ -17,7 +18,7 @@ add := fn(x, y) {
 
 # this is a comment
 result := add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -36,6 +37,12 @@ if (5 < 10) {
 d.foo
 &|^~
 !&&||
+[a, ...b] ..
+match (x) { _ => 1 }
+struct P { x }
++= -= *= /= %= &= |= ^=
+<< >> **
+0xFF 0b10 0o7 1_000 0x
 `
 
 	tests := []struct {
@@ -136,6 +143,44 @@ d.foo
 		{token.NOT, "!"},
 		{token.AND, "&&"},
 		{token.OR, "||"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.STRUCT, "struct"},
+		{token.IDENT, "P"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.MULTIPLY_ASSIGN, "*="},
+		{token.DIVIDE_ASSIGN, "/="},
+		{token.MODULO_ASSIGN, "%="},
+		{token.BitwiseAND_ASSIGN, "&="},
+		{token.BitwiseOR_ASSIGN, "|="},
+		{token.BitwiseXOR_ASSIGN, "^="},
+		{token.LSHIFT, "<<"},
+		{token.RSHIFT, ">>"},
+		{token.POWER, "**"},
+		{token.INT, "0xFF"},
+		{token.INT, "0b10"},
+		{token.INT, "0o7"},
+		{token.INT, "1_000"},
+		{token.INT, "0x"},
 		{token.EOF, ""},
 	}
 
@@ -197,3 +242,327 @@ c := "\r\n\t"
 	}
 
 }
+
+func TestUnicode(t *testing.T) {
+	input := `größe := "\u{48}\u{1F600}"; π "\u{110000}" "世界"`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.IDENT, "größe", 1},
+		{token.BIND, ":=", 7},
+		{token.STRING, "H😀", 10},
+		{token.SEMICOLON, ";", 27},
+		{token.IDENT, "π", 29},
+		{token.ILLEGAL, `invalid code point "110000" in \u{...} escape`, 31},
+		{token.STRING, "世界", 44},
+		{token.EOF, "", 48},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, token.Literal)
+		}
+
+		if token.Column != test.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, test.expectedColumn, token.Column)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"x=${x}, sum=${a + b}" "\${x}" "${ {"a": "}"}["a"] }" "${"`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.TEMPLATE, "x=${x}, sum=${a + b}"},
+		{token.STRING, "${x}"},
+		{token.TEMPLATE, `${ {"a": "}"}["a"] }`},
+		{token.ILLEGAL, "unterminated string interpolation"},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, token.Literal)
+		}
+	}
+}
+
+func TestBlockAndDocComments(t *testing.T) {
+	input := `/* a /* nested */ comment */ x /**/ := 1 /* *
+*/
+/// Doc for y
+/// on two lines
+//// not a doc comment
+///
+y`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.IDENT, "x", 1},
+		{token.BIND, ":=", 1},
+		{token.INT, "1", 1},
+		{token.DOC_COMMENT, " Doc for y", 3},
+		{token.DOC_COMMENT, " on two lines", 4},
+		{token.COMMENT, "// not a doc comment", 5},
+		{token.DOC_COMMENT, "", 6},
+		{token.IDENT, "y", 7},
+		{token.EOF, "", 7},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, token.Literal)
+		}
+
+		if token.Line != test.expectedLine {
+			t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d",
+				i, test.expectedLine, token.Line)
+		}
+	}
+
+	lexer = New("x /* /* */")
+	lexer.NextToken()
+	if token := lexer.NextToken(); token.Type != "ILLEGAL" || token.Column != 3 {
+		t.Fatalf("expected ILLEGAL at column 3 for unterminated comment, got=%q at %d",
+			token.Type, token.Column)
+	}
+
+	lexer = New("x\n  /* outer\n /* inner */\n")
+	lexer.NextToken()
+	if token := lexer.NextToken(); token.Type != "ILLEGAL" || token.Line != 2 || token.Column != 3 {
+		t.Fatalf("expected ILLEGAL at 2:3 for unterminated nested comment, got=%q at %d:%d",
+			token.Type, token.Line, token.Column)
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	input := "`C:\\dir\\n` `${x} \"q\"` `two\nlines` `` `unterminated"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.STRING, `C:\dir\n`},
+		{token.STRING, `${x} "q"`},
+		{token.STRING, "two\nlines"},
+		{token.STRING, ""},
+		{token.ILLEGAL, "unterminated raw string"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, token.Literal)
+		}
+	}
+}
+
+func TestMultilineStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{`""""""`, token.STRING, ""},
+		{`"""say "hi"\t"""`, token.STRING, "say \"hi\"\t"},
+		{"\"\"\"\n    a\n      b\n    \"\"\"", token.STRING, "a\n  b"},
+		{"\"\"\"\n\ta\n\n\t  b\n\t\"\"\"", token.STRING, "a\n\n  b"},
+		{"\"\"\"a\n  b\"\"\"", token.STRING, "a\n  b"},
+		{"\"\"\"\n  a\\n\n  \"\"\"", token.STRING, "a\n"},
+		{"\"\"\"\n  x=${x}\n  \"y\"\n  \"\"\"", token.TEMPLATE, "x=${x}\n\"y\""},
+		{"\"\"\"\n  ${ \"}\" }\n  \"\"\"", token.TEMPLATE, "${ \"}\" }"},
+		{`"""${x"""`, token.ILLEGAL, "unterminated string interpolation"},
+		{`"""\u{D800}"""`, token.ILLEGAL, `invalid code point "D800" in \u{...} escape`},
+		{"\"\"\"abc\nprint(1)", token.ILLEGAL, "unterminated multi-line string"},
+		{`"""abc""`, token.ILLEGAL, "unterminated multi-line string"},
+	}
+
+	for i, test := range tests {
+		lexer := New(test.input)
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, token.Literal)
+		}
+
+		if token := lexer.NextToken(); token.Type != "EOF" {
+			t.Fatalf("tests[%d] - expected EOF, got=%q", i, token.Type)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		literal       string
+		expectedTexts []string
+		expectedExprs []string
+	}{
+		{"x=${x}, sum=${a + b}", []string{"x=", ", sum=", ""}, []string{"x", "a + b"}},
+		{`\t${x}\n`, []string{"\t", "\n"}, []string{"x"}},
+		{`${ "}" }`, []string{"", ""}, []string{` "}" `}},
+		{`${f(fn() { 1 })}`, []string{"", ""}, []string{"f(fn() { 1 })"}},
+		{`$x ${"${y}"}`, []string{"$x ", ""}, []string{`"${y}"`}},
+		{`"${x}"`, []string{`"`, `"`}, []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		texts, exprs, err := Template(tt.literal)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", tt.literal, err)
+		}
+
+		if strings.Join(texts, "|") != strings.Join(tt.expectedTexts, "|") {
+			t.Errorf("texts wrong for %q. expected=%q, got=%q",
+				tt.literal, tt.expectedTexts, texts)
+		}
+
+		if strings.Join(exprs, "|") != strings.Join(tt.expectedExprs, "|") {
+			t.Errorf("exprs wrong for %q. expected=%q, got=%q",
+				tt.literal, tt.expectedExprs, exprs)
+		}
+	}
+
+	if _, _, err := Template("${x"); err == nil {
+		t.Errorf("expected error for unterminated interpolation")
+	}
+}
+
+func TestMalformedTemplates(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{`"${x}\`, token.TEMPLATE, `${x}\`},
+		{`"${x`, token.ILLEGAL, "unterminated string interpolation"},
+		{`"${`, token.ILLEGAL, "unterminated string interpolation"},
+		{`"\xZZ"`, token.ILLEGAL, `invalid \x escape "ZZ"`},
+		{`"\u0041"`, token.ILLEGAL, `expected { after \u`},
+		{`"a\`, token.STRING, `a\`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("wrong token for %q. expected=%s %q, got=%s %q",
+				tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("expected EOF after %q, got=%s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `x := 1
+  y := "foo"
+`
+
+	tests := []struct {
+		expectedType   token.Type
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.IDENT, 1, 1},
+		{token.BIND, 1, 3},
+		{token.INT, 1, 6},
+		{token.IDENT, 2, 3},
+		{token.BIND, 2, 5},
+		{token.STRING, 2, 8},
+		{token.EOF, 3, 1},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q",
+				i, test.expectedType, token.Type)
+		}
+
+		if token.Line != test.expectedLine || token.Column != test.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, test.expectedLine, test.expectedColumn, token.Line, token.Column)
+		}
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	f.Add(`x := 5; f := fn(a, b) { a + b }`)
+	f.Add(`"foo\tbar\x00" [1, 2] {"a": 1} // comment`)
+	f.Add(`!= == <= >= && || & | ^ ~ % .`)
+	f.Add(`"${x}\`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+
+		// Every token consumes at least one character of input
+		for i := 0; i <= len(input)+1; i++ {
+			if tok := l.NextToken(); tok.Type == token.EOF {
+				return
+			}
+		}
+
+		t.Fatalf("lexer did not reach EOF for %q", input)
+	})
+}
@@ -14,11 +14,14 @@ import (
 	"path"
 	"strings"
 
+	"github.com/prologic/monkey-lang/ast"
 	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/eval"
 	"github.com/prologic/monkey-lang/lexer"
 	"github.com/prologic/monkey-lang/object"
 	"github.com/prologic/monkey-lang/parser"
 	"github.com/prologic/monkey-lang/repl"
+	"github.com/prologic/monkey-lang/rvm"
 )
 
 var (
@@ -27,11 +30,14 @@ var (
 	compile     bool
 	version     bool
 	debug       bool
+	coverage    string
 )
 
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [<filename>]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s test [options] [<dir|file>...]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s doc [options] [<dir|file>...] [<name>...]\n", path.Base(os.Args[0]))
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
@@ -39,9 +45,30 @@ func init() {
 	flag.BoolVar(&version, "v", false, "display version information")
 	flag.BoolVar(&debug, "d", false, "enable debug mode")
 	flag.BoolVar(&compile, "c", false, "compile input to bytecode")
+	flag.StringVar(&coverage, "cover", "", "record statement coverage and accumulate it in `file`")
 
 	flag.BoolVar(&interactive, "i", false, "enable interactive mode")
-	flag.StringVar(&engine, "e", "vm", "engine to use (eval or vm)")
+	flag.StringVar(&engine, "e", "vm", "engine to use (eval, vm or rvm)")
+}
+
+// disassembleRVM compiles program for the register based virtual machine
+// and prints its instructions and constants
+func disassembleRVM(program *ast.Program) {
+	c := rvm.NewCompiler()
+	if err := c.Compile(program); err != nil {
+		log.Fatal(err)
+	}
+
+	code := c.Bytecode()
+	fmt.Printf("Main:\n%s\n", code.Main.Instructions)
+
+	fmt.Print("Constants:\n")
+	for i, constant := range code.Constants {
+		fmt.Printf("%04d %s\n", i, constant.Inspect())
+		if fn, ok := constant.(*rvm.Function); ok {
+			fmt.Printf("%s\n", Indent(fn.Instructions.String(), "     "))
+		}
+	}
 }
 
 // Indent indents a block of text with an indent string
@@ -75,6 +102,14 @@ func main() {
 
 	args := flag.Args()
 
+	if len(args) > 0 && args[0] == "test" {
+		os.Exit(runTests(args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "doc" {
+		os.Exit(runDoc(args[1:]))
+	}
+
 	copy(object.Arguments, args)
 	object.StandardInput = os.Stdin
 	object.StandardOutput = os.Stdout
@@ -100,6 +135,17 @@ func main() {
 			log.Fatal(p.Errors())
 		}
 
+		macros := object.NewEnvironment()
+		eval.DefineMacros(program, macros)
+		if _, err := eval.ExpandMacros(program, macros); err != nil {
+			log.Fatal(err)
+		}
+
+		if engine == "rvm" {
+			disassembleRVM(program)
+			return
+		}
+
 		c := compiler.New()
 		err = c.Compile(program)
 		if err != nil {
@@ -121,6 +167,7 @@ func main() {
 			Debug:       debug,
 			Engine:      engine,
 			Interactive: interactive,
+			Cover:       coverage,
 		}
 		repl := repl.New(user.Username, args, opts)
 		repl.Run()
@@ -0,0 +1,260 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// MaxIntegerBits is the largest bit length of the result of a left shift or
+// an exponentiation, beyond which they return an error rather than exhaust
+// the available memory
+const MaxIntegerBits = 1 << 24
+
+// BigInteger is the integer type used to represent integers that do not fit
+// in an int64 and holds an internal arbitrary-precision value. Integer
+// operations promote their results to a BigInteger on overflow and demote
+// them back to an Integer when they fit, so a BigInteger is never in the
+// range of an int64.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (i *BigInteger) Equal(other Object) bool {
+	if obj, ok := other.(*BigInteger); ok {
+		return i.Value.Cmp(obj.Value) == 0
+	}
+	return false
+}
+
+func (i *BigInteger) String() string {
+	return i.Inspect()
+}
+
+// Clone creates a new copy
+func (i *BigInteger) Clone() Object {
+	return &BigInteger{Value: new(big.Int).Set(i.Value)}
+}
+
+// Type returns the type of the object
+func (i *BigInteger) Type() Type { return INTEGER }
+
+// Inspect returns a stringified version of the object for debugging
+func (i *BigInteger) Inspect() string { return i.Value.String() }
+
+// HashKey returns a HashKey object
+func (i *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	if i.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(i.Value.Bytes())
+
+	return HashKey{Type: i.Type(), Value: h.Sum64()}
+}
+
+// NewBigInteger returns value as an Integer if it fits in an int64 or as a
+// BigInteger otherwise
+func NewBigInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+// IsInteger reports whether obj is an Integer or a BigInteger
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger:
+		return true
+	default:
+		return false
+	}
+}
+
+// toBigInt returns the value of the Integer or BigInteger obj as a big.Int
+func toBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInteger:
+		return obj.Value
+	default:
+		panic(fmt.Sprintf("expected int got=%T", obj))
+	}
+}
+
+// IntegerOperation applies the arithmetic or bitwise operator, one of
+// + - * / % | ^ & << >> **, to the integers left and right. Results that
+// overflow an int64 are promoted to a BigInteger. Returns an error on
+// division by zero, for negative shift counts or exponents and for shifts
+// and exponentiations whose result would exceed MaxIntegerBits.
+func IntegerOperation(operator string, left, right Object) (Object, error) {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			result, ok, err := int64Operation(operator, l.Value, r.Value)
+			if ok || err != nil {
+				return &Integer{Value: result}, err
+			}
+		}
+	}
+
+	leftVal, rightVal := toBigInt(left), toBigInt(right)
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		result.Add(leftVal, rightVal)
+	case "-":
+		result.Sub(leftVal, rightVal)
+	case "*":
+		result.Mul(leftVal, rightVal)
+	case "/":
+		if rightVal.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result.Quo(leftVal, rightVal)
+	case "%":
+		if rightVal.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result.Rem(leftVal, rightVal)
+	case "|":
+		result.Or(leftVal, rightVal)
+	case "^":
+		result.Xor(leftVal, rightVal)
+	case "&":
+		result.And(leftVal, rightVal)
+	case "<<", ">>":
+		if rightVal.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count")
+		}
+		if !rightVal.IsInt64() {
+			return nil, fmt.Errorf("shift count too large")
+		}
+		if operator == "<<" {
+			if leftVal.Sign() != 0 && int64(leftVal.BitLen())+rightVal.Int64() > MaxIntegerBits {
+				return nil, fmt.Errorf("shift count too large")
+			}
+			result.Lsh(leftVal, uint(rightVal.Int64()))
+		} else {
+			result.Rsh(leftVal, uint(rightVal.Int64()))
+		}
+	case "**":
+		if rightVal.Sign() < 0 {
+			return nil, fmt.Errorf("negative exponent")
+		}
+		// The result of a base other than 0, 1 or -1 has at least
+		// (bits-1)*exponent bits
+		if bits := int64(new(big.Int).Abs(leftVal).BitLen()); bits > 1 &&
+			(!rightVal.IsInt64() || rightVal.Int64() > MaxIntegerBits/(bits-1)) {
+			return nil, fmt.Errorf("exponent too large")
+		}
+		result.Exp(leftVal, rightVal, nil)
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %s", operator)
+	}
+
+	return NewBigInteger(result), nil
+}
+
+// int64Operation applies operator to left and right and reports false if
+// the result overflows an int64
+func int64Operation(operator string, left, right int64) (int64, bool, error) {
+	switch operator {
+	case "+":
+		result := left + right
+		return result, (result > left) == (right > 0), nil
+	case "-":
+		result := left - right
+		return result, (result < left) == (right > 0), nil
+	case "*":
+		if left == 0 || right == 0 {
+			return 0, true, nil
+		}
+		result := left * right
+		overflow := result/right != left ||
+			(left == -1 && right == math.MinInt64) ||
+			(right == -1 && left == math.MinInt64)
+		return result, !overflow, nil
+	case "/":
+		if right == 0 {
+			return 0, false, fmt.Errorf("division by zero")
+		}
+		if left == math.MinInt64 && right == -1 {
+			return 0, false, nil
+		}
+		return left / right, true, nil
+	case "%":
+		if right == 0 {
+			return 0, false, fmt.Errorf("division by zero")
+		}
+		return left % right, true, nil
+	case "|":
+		return left | right, true, nil
+	case "^":
+		return left ^ right, true, nil
+	case "&":
+		return left & right, true, nil
+	case "<<":
+		if right < 0 {
+			return 0, false, fmt.Errorf("negative shift count")
+		}
+		if right < 63 {
+			if result := left << right; result>>right == left {
+				return result, true, nil
+			}
+		}
+		return 0, left == 0, nil
+	case ">>":
+		if right < 0 {
+			return 0, false, fmt.Errorf("negative shift count")
+		}
+		if right > 63 {
+			right = 63
+		}
+		return left >> right, true, nil
+	case "**":
+		if right < 0 {
+			return 0, false, fmt.Errorf("negative exponent")
+		}
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("unknown integer operator: %s", operator)
+	}
+}
+
+// CompareIntegers compares the integers left and right and returns -1 if
+// left is less than right, 0 if they are equal and +1 otherwise
+func CompareIntegers(left, right Object) int {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			switch {
+			case l.Value < r.Value:
+				return -1
+			case l.Value > r.Value:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return toBigInt(left).Cmp(toBigInt(right))
+}
+
+// NegateInteger returns the negation of the integer obj
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	return NewBigInteger(new(big.Int).Neg(toBigInt(obj)))
+}
+
+// InvertInteger returns the bitwise complement of the integer obj
+func InvertInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok {
+		return &Integer{Value: ^i.Value}
+	}
+	return NewBigInteger(new(big.Int).Not(toBigInt(obj)))
+}
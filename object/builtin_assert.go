@@ -2,7 +2,6 @@ package object
 
 import (
 	"fmt"
-	"os"
 )
 
 // Assert ...
@@ -21,8 +20,12 @@ func Assert(args ...Object) Object {
 	}
 
 	if !args[0].(*Boolean).Value {
+		if AssertFunction != nil {
+			AssertFunction(args[1].(*String).Value)
+			return nil
+		}
 		fmt.Printf("Assertion Error: %s", args[1].(*String).Value)
-		os.Exit(1)
+		ExitFunction(1)
 	}
 
 	return nil
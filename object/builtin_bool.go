@@ -17,6 +17,9 @@ func Bool(args ...Object) Object {
 			return &Boolean{Value: false}
 		}
 		return &Boolean{Value: true}
+	case *BigInteger:
+		// A BigInteger is never in the range of an int64 and so never zero
+		return &Boolean{Value: true}
 	case *String:
 		if len(arg.Value) > 0 {
 			return &Boolean{Value: true}
@@ -0,0 +1,22 @@
+package object
+
+// Bytes returns the UTF-8 encoded bytes of a string as an array of ints
+func Bytes(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `bytes` must be str, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(str.Value))
+	for i := 0; i < len(str.Value); i++ {
+		elements[i] = &Integer{Value: int64(str.Value[i])}
+	}
+
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,31 @@
+package object
+
+import (
+	"unicode/utf8"
+)
+
+// Chr returns a single character string of a Unicode code point
+func Chr(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if _, ok := args[0].(*BigInteger); ok {
+		return newError("argument to `chr` is not a valid code point: %s",
+			args[0].Inspect())
+	}
+
+	i, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `chr` must be int, got %s",
+			args[0].Type())
+	}
+
+	if i.Value < 0 || i.Value > utf8.MaxRune || !utf8.ValidRune(rune(i.Value)) {
+		return newError("argument to `chr` is not a valid code point: %d",
+			i.Value)
+	}
+
+	return &String{Value: string(rune(i.Value))}
+}
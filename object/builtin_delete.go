@@ -0,0 +1,26 @@
+package object
+
+// Delete removes a key from a hash and returns true if it was present
+func Delete(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `delete` must be hash, got %s",
+			args[0].Type())
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	if hash.Frozen {
+		return newError("cannot modify frozen hash")
+	}
+
+	return &Boolean{Value: hash.Delete(key.HashKey())}
+}
@@ -4,11 +4,16 @@ package object
 func Exit(args ...Object) Object {
 	var status int
 	if len(args) == 1 {
-		if args[0].Type() != INTEGER {
+		if _, ok := args[0].(*BigInteger); ok {
+			return newError("argument to `exit` is out of range: %s",
+				args[0].Inspect())
+		}
+		i, ok := args[0].(*Integer)
+		if !ok {
 			return newError("argument to `exit` must be INTEGER, got %s",
 				args[0].Type())
 		}
-		status = int(args[0].(*Integer).Value)
+		status = int(i.Value)
 	}
 
 	ExitFunction(status)
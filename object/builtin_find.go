@@ -1,9 +1,5 @@
 package object
 
-import (
-	"strings"
-)
-
 // Find ...
 func Find(args ...Object) Object {
 	if len(args) != 2 {
@@ -13,8 +9,7 @@ func Find(args ...Object) Object {
 
 	if haystack, ok := args[0].(*String); ok {
 		if needle, ok := args[1].(*String); ok {
-			index := strings.Index(haystack.Value, needle.Value)
-			return &Integer{Value: int64(index)}
+			return &Integer{Value: int64(haystack.IndexOf(needle.Value))}
 		} else {
 			return newError("expected arg #2 to be `str` got got=%T", args[1])
 		}
@@ -0,0 +1,70 @@
+package object
+
+// Freeze makes an array, hash or struct instance and, recursively, the
+// arrays, hashes and instances it contains immutable and returns it. Other
+// values are returned as is.
+func Freeze(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	freeze(args[0])
+	return args[0]
+}
+
+// IsFrozen returns true if a value cannot be modified, i.e: it is a frozen
+// array, hash or struct instance or an immutable value such as an int or str
+func IsFrozen(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Boolean{Value: arg.Frozen}
+	case *Hash:
+		return &Boolean{Value: arg.Frozen}
+	case *Instance:
+		return &Boolean{Value: arg.Frozen}
+	case Immutable, *Null:
+		return &Boolean{Value: true}
+	default:
+		return &Boolean{Value: false}
+	}
+}
+
+// freeze freezes obj if it is an array, hash or struct instance and the
+// arrays, hashes and instances it contains, stopping at those already frozen
+// so cycles terminate
+func freeze(obj Object) {
+	switch obj := obj.(type) {
+	case *Array:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, element := range obj.Elements {
+			freeze(element)
+		}
+
+	case *Hash:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Items() {
+			freeze(pair.Value)
+		}
+
+	case *Instance:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, field := range obj.Fields {
+			freeze(field)
+		}
+	}
+}
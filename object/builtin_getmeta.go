@@ -0,0 +1,20 @@
+package object
+
+// GetMeta returns the metatable of a hash or null if it has none
+func GetMeta(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `getmeta` must be hash, got %s",
+			args[0].Type())
+	}
+
+	if hash.Meta == nil {
+		return nil
+	}
+	return hash.Meta
+}
@@ -0,0 +1,23 @@
+package object
+
+// Has returns true if a hash contains a key
+func Has(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `has` must be hash, got %s",
+			args[0].Type())
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok = hash.Pairs[key.HashKey()]
+	return &Boolean{Value: ok}
+}
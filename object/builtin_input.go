@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
 )
 
 // Input ...
@@ -17,14 +16,14 @@ func Input(args ...Object) Object {
 				args[0].Type(),
 			)
 		}
-		fmt.Fprintf(os.Stdout, obj.Value)
+		fmt.Fprint(StandardOutput, obj.Value)
 	}
 
-	buffer := bufio.NewReader(os.Stdin)
+	buffer := bufio.NewReader(StandardInput)
 
 	line, _, err := buffer.ReadLine()
 	if err != nil && err != io.EOF {
-		return newError(fmt.Sprintf("error reading input from stdin: %s", err))
+		return newError("error reading input from stdin: %s", err)
 	}
 	return &String{Value: string(line)}
 }
@@ -1,7 +1,7 @@
 package object
 
 import (
-	"strconv"
+	"math/big"
 )
 
 // Int ...
@@ -17,14 +17,14 @@ func Int(args ...Object) Object {
 			return &Integer{Value: 1}
 		}
 		return &Integer{Value: 0}
-	case *Integer:
+	case *Integer, *BigInteger:
 		return arg
 	case *String:
-		n, err := strconv.ParseInt(arg.Value, 10, 64)
-		if err != nil {
-			return newError("could not parse string to int: %s", err)
+		n, ok := new(big.Int).SetString(arg.Value, 10)
+		if !ok {
+			return newError("could not parse string to int: %q", arg.Value)
 		}
-		return &Integer{Value: n}
+		return NewBigInteger(n)
 	default:
 		return newError("argument to `int` not supported, got %s",
 			args[0].Type())
@@ -0,0 +1,22 @@
+package object
+
+// Items returns the pairs of a hash in insertion order as `[key, value]`
+// arrays
+func Items(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `items` must be hash, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Items() {
+		elements[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+	}
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,21 @@
+package object
+
+// Keys returns the keys of a hash in insertion order
+func Keys(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `keys` must be hash, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Items() {
+		elements[i] = pair.Key
+	}
+	return &Array{Elements: elements}
+}
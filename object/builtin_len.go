@@ -1,9 +1,5 @@
 package object
 
-import (
-	"unicode/utf8"
-)
-
 // Len ...
 func Len(args ...Object) Object {
 	if len(args) != 1 {
@@ -15,7 +11,7 @@ func Len(args ...Object) Object {
 	case *Array:
 		return &Integer{Value: int64(len(arg.Elements))}
 	case *String:
-		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+		return &Integer{Value: int64(arg.Len())}
 	default:
 		return newError("argument to `len` not supported, got %s",
 			args[0].Type())
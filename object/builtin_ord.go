@@ -0,0 +1,27 @@
+package object
+
+import (
+	"unicode/utf8"
+)
+
+// Ord returns the Unicode code point of a single character string
+func Ord(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `ord` must be str, got %s",
+			args[0].Type())
+	}
+
+	if str.Len() != 1 {
+		return newError("argument to `ord` must be a single character, got %d",
+			str.Len())
+	}
+
+	ch, _ := utf8.DecodeRuneInString(str.Value)
+	return &Integer{Value: int64(ch)}
+}
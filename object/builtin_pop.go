@@ -12,6 +12,9 @@ func Pop(args ...Object) Object {
 	}
 
 	arr := args[0].(*Array)
+	if arr.Frozen {
+		return newError("cannot modify frozen array")
+	}
 	length := len(arr.Elements)
 
 	if length == 0 {
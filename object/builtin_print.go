@@ -7,7 +7,7 @@ import (
 // Print ...
 func Print(args ...Object) Object {
 	for _, arg := range args {
-		fmt.Println(arg.String())
+		fmt.Fprintln(StandardOutput, arg.String())
 	}
 
 	return nil
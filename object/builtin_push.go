@@ -12,6 +12,9 @@ func Push(args ...Object) Object {
 	}
 
 	arr := args[0].(*Array)
+	if arr.Frozen {
+		return newError("cannot modify frozen array")
+	}
 	length := len(arr.Elements)
 
 	newElements := make([]Object, length+1, length+1)
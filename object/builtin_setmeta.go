@@ -0,0 +1,32 @@
+package object
+
+// SetMeta sets the metatable of a hash, or removes it if null, and returns
+// the hash
+func SetMeta(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument #1 to `setmeta` must be hash, got %s",
+			args[0].Type())
+	}
+
+	if hash.Frozen {
+		return newError("cannot modify frozen hash")
+	}
+
+	switch meta := args[1].(type) {
+	case *Hash:
+		hash.Meta = meta
+	case *Null:
+		hash.Meta = nil
+	default:
+		return newError("argument #2 to `setmeta` must be hash or null, got %s",
+			args[1].Type())
+	}
+
+	return hash
+}
@@ -0,0 +1,21 @@
+package object
+
+// Values returns the values of a hash in insertion order of their keys
+func Values(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `values` must be hash, got %s",
+			args[0].Type())
+	}
+
+	elements := make([]Object, len(hash.Keys))
+	for i, pair := range hash.Items() {
+		elements[i] = pair.Value
+	}
+	return &Array{Elements: elements}
+}
@@ -7,28 +7,159 @@ import (
 
 // Builtins ...
 var Builtins = map[string]*Builtin{
-	"len":    &Builtin{Name: "len", Fn: Len},
-	"input":  &Builtin{Name: "input", Fn: Input},
-	"print":  &Builtin{Name: "print", Fn: Print},
-	"first":  &Builtin{Name: "first", Fn: First},
-	"last":   &Builtin{Name: "last", Fn: Last},
-	"rest":   &Builtin{Name: "rest", Fn: Rest},
-	"push":   &Builtin{Name: "push", Fn: Push},
-	"pop":    &Builtin{Name: "pop", Fn: Pop},
-	"exit":   &Builtin{Name: "exit", Fn: Exit},
-	"assert": &Builtin{Name: "assert", Fn: Assert},
-	"bool":   &Builtin{Name: "bool", Fn: Bool},
-	"int":    &Builtin{Name: "int", Fn: Int},
-	"str":    &Builtin{Name: "str", Fn: Str},
-	"typeof": &Builtin{Name: "typeof", Fn: TypeOf},
-	"args":   &Builtin{Name: "args", Fn: Args},
-	"lower":  &Builtin{Name: "lower", Fn: Lower},
-	"upper":  &Builtin{Name: "upper", Fn: Upper},
-	"join":   &Builtin{Name: "join", Fn: Join},
-	"split":  &Builtin{Name: "split", Fn: Split},
-	"find":   &Builtin{Name: "find", Fn: Find},
-	"read":   &Builtin{Name: "read", Fn: Read},
-	"write":  &Builtin{Name: "write", Fn: Write},
+	"len": {
+		Name: "len", Fn: Len, Usage: "len(iterable)",
+		Doc: "Returns the length of the iterable (`str`, `array` or `hash`). The length\n" +
+			"of a `str` is its number of characters (Unicode code points).",
+	},
+	"input": {
+		Name: "input", Fn: Input, Usage: "input([prompt])",
+		Doc: "Reads a line from standard input optionally printing `prompt`.",
+	},
+	"print": {
+		Name: "print", Fn: Print, Usage: "print(value...)",
+		Doc: "Prints the `value`(s) to standard output followed by a newline.",
+	},
+	"first": {
+		Name: "first", Fn: First, Usage: "first(array)",
+		Doc: "Returns the first element of the `array`.",
+	},
+	"last": {
+		Name: "last", Fn: Last, Usage: "last(array)",
+		Doc: "Returns the last element of the `array`.",
+	},
+	"rest": {
+		Name: "rest", Fn: Rest, Usage: "rest(array)",
+		Doc: "Returns a new array with the first element of `array` removed.",
+	},
+	"push": {
+		Name: "push", Fn: Push, Usage: "push(array, value)",
+		Doc: "Returns a new array with `value` pushed onto the end of `array`.",
+	},
+	"pop": {
+		Name: "pop", Fn: Pop, Usage: "pop(array)",
+		Doc: "Returns the last value of the `array` or `null` if empty.",
+	},
+	"exit": {
+		Name: "exit", Fn: Exit, Usage: "exit([status])",
+		Doc: "Exits the program immediately with the optional `status` or `0`.",
+	},
+	"assert": {
+		Name: "assert", Fn: Assert, Usage: "assert(expr, msg)",
+		Doc: "Exits the program immediately with a non-zero status displaying `msg` if\n" +
+			"`expr` is `false`. Under the test runner the failure is recorded instead.",
+	},
+	"bool": {
+		Name: "bool", Fn: Bool, Usage: "bool(value)",
+		Doc: "Converts `value` to a `bool`. Returns `true` for non-zero `int`(s) and\n" +
+			"non-empty `str`, `array` and `hash` values, `false` for `null` and `true`\n" +
+			"for all other values.",
+	},
+	"int": {
+		Name: "int", Fn: Int, Usage: "int(value)",
+		Doc: "Converts a decimal `str` or a `bool` to an `int`. If `value` is an `int`\n" +
+			"returns its value directly.",
+	},
+	"str": {
+		Name: "str", Fn: Str, Usage: "str(value)",
+		Doc: "Returns the string representation of `value`, the string itself for a\n" +
+			"`str` (not quoted).",
+	},
+	"typeof": {
+		Name: "typeof", Fn: TypeOf, Usage: "typeof(value)",
+		Doc: "Returns a `str` denoting the type of `value`, e.g: `int` or `array`.",
+	},
+	"args": {
+		Name: "args", Fn: Args, Usage: "args()",
+		Doc: "Returns an array of command-line options passed to the program.",
+	},
+	"lower": {
+		Name: "lower", Fn: Lower, Usage: "lower(str)",
+		Doc: "Returns a lowercased version of `str`.",
+	},
+	"upper": {
+		Name: "upper", Fn: Upper, Usage: "upper(str)",
+		Doc: "Returns an uppercased version of `str`.",
+	},
+	"join": {
+		Name: "join", Fn: Join, Usage: "join(array, sep)",
+		Doc: "Concatenates the `str`s in `array` to form a single `str`, with the\n" +
+			"separator `sep` between each element.",
+	},
+	"split": {
+		Name: "split", Fn: Split, Usage: "split(str[, sep])",
+		Doc: "Splits `str` using the separator `sep` and returns the parts (excluding\n" +
+			"the separator) as an `array`. If `sep` is not given or `null`, it splits\n" +
+			"on whitespace.",
+	},
+	"find": {
+		Name: "find", Fn: Find, Usage: "find(haystack, needle)",
+		Doc: "Returns the index of the `needle` `str` in the `haystack` `str`, or the\n" +
+			"index of the `needle` element in the `haystack` array. Returns -1 if not\n" +
+			"found.",
+	},
+	"read": {
+		Name: "read", Fn: Read, Usage: "read(filename)",
+		Doc: "Reads the contents of the file `filename` and returns it as a `str`.",
+	},
+	"write": {
+		Name: "write", Fn: Write, Usage: "write(filename, data)",
+		Doc: "Writes the `str` `data` to the file `filename`.",
+	},
+	"ord": {
+		Name: "ord", Fn: Ord, Usage: "ord(str)",
+		Doc: "Returns the Unicode code point of the single character `str` as an `int`.",
+	},
+	"chr": {
+		Name: "chr", Fn: Chr, Usage: "chr(int)",
+		Doc: "Returns a `str` of the single character with the Unicode code point `int`.",
+	},
+	"bytes": {
+		Name: "bytes", Fn: Bytes, Usage: "bytes(str)",
+		Doc: "Returns the UTF-8 encoded bytes of `str` as an `array` of `int`s.",
+	},
+	"setmeta": {
+		Name: "setmeta", Fn: SetMeta, Usage: "setmeta(hash, meta)",
+		Doc: "Sets the metatable of `hash` to the `hash` `meta`, or removes it if `meta`\n" +
+			"is `null`, and returns `hash`.",
+	},
+	"freeze": {
+		Name: "freeze", Fn: Freeze, Usage: "freeze(value)",
+		Doc: "Makes the `array`, `hash` or struct instance `value` and, recursively,\n" +
+			"the arrays, hashes and instances it contains immutable and returns it.\n" +
+			"Modifying a frozen value is an error.",
+	},
+	"isFrozen": {
+		Name: "isFrozen", Fn: IsFrozen, Usage: "isFrozen(value)",
+		Doc: "Returns `true` if `value` cannot be modified, i.e: it is a frozen\n" +
+			"`array`, `hash` or struct instance or an immutable value such as an\n" +
+			"`int` or `str`.",
+	},
+	"getmeta": {
+		Name: "getmeta", Fn: GetMeta, Usage: "getmeta(hash)",
+		Doc: "Returns the metatable of `hash` or `null` if it has none.",
+	},
+	"keys": {
+		Name: "keys", Fn: Keys, Usage: "keys(hash)",
+		Doc: "Returns an `array` of the keys of `hash` in insertion order.",
+	},
+	"values": {
+		Name: "values", Fn: Values, Usage: "values(hash)",
+		Doc: "Returns an `array` of the values of `hash` in insertion order.",
+	},
+	"items": {
+		Name: "items", Fn: Items, Usage: "items(hash)",
+		Doc: "Returns an `array` of the `[key, value]` pairs of `hash` in insertion\n" +
+			"order.",
+	},
+	"has": {
+		Name: "has", Fn: Has, Usage: "has(hash, key)",
+		Doc: "Returns `true` if `hash` contains `key`.",
+	},
+	"delete": {
+		Name: "delete", Fn: Delete, Usage: "delete(hash, key)",
+		Doc: "Removes `key` from `hash` and returns `true` if it was present.",
+	},
 }
 
 // BuiltinsIndex ...
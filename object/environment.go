@@ -1,5 +1,7 @@
 package object
 
+import "github.com/prologic/monkey-lang/ast"
+
 // NewEnvironment constructs a new Environment object to hold bindings
 // of identifiers to their names
 func NewEnvironment() *Environment {
@@ -10,6 +12,7 @@ func NewEnvironment() *Environment {
 // Environment is an object that holds a mapping of names to bound objets
 type Environment struct {
 	store  map[string]Object
+	consts map[string]ast.Node
 	parent *Environment
 }
 
@@ -35,3 +38,39 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// SetConst stores the object with the given name as a constant declared
+// by decl
+func (e *Environment) SetConst(name string, val Object, decl ast.Node) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]ast.Node)
+	}
+	e.consts[name] = decl
+	e.store[name] = val
+	return val
+}
+
+// IsConst returns true if name is bound to a constant, i.e: the binding
+// returned by Get is a constant
+func (e *Environment) IsConst(name string) bool {
+	if _, ok := e.store[name]; ok {
+		return e.consts[name] != nil
+	}
+	if e.parent != nil {
+		return e.parent.IsConst(name)
+	}
+	return false
+}
+
+// IsLocalConst returns true if name is bound to a constant in this
+// environment rather than in an enclosing environment
+func (e *Environment) IsLocalConst(name string) bool {
+	return e.consts[name] != nil
+}
+
+// IsDeclaredBy returns true if name is bound to a constant declared by decl
+// in this environment, i.e: decl is being evaluated again such as in the
+// body of a loop
+func (e *Environment) IsDeclaredBy(name string, decl ast.Node) bool {
+	return e.consts[name] != nil && e.consts[name] == decl
+}
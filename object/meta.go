@@ -0,0 +1,127 @@
+package object
+
+import (
+	"fmt"
+)
+
+// maxIndexChain is the maximum number of hashes followed through __index
+// metamethods when looking up a key before giving up, to guard against
+// metatables that refer back to themselves
+const maxIndexChain = 100
+
+// Caller calls a function with arguments and returns its result. It is
+// provided by the evaluator and the virtual machines to call metamethods.
+type Caller func(fn Object, args ...Object) (Object, error)
+
+// Metamethod returns the metamethod called name defined by the metatable of
+// obj if obj is a hash with a metatable that defines it
+func Metamethod(obj Object, name string) (Object, bool) {
+	hash, ok := obj.(*Hash)
+	if !ok || hash.Meta == nil {
+		return nil, false
+	}
+
+	key := &String{Value: name}
+	pair, ok := hash.Meta.Pairs[key.HashKey()]
+	if !ok || pair.Value.Type() == NULL {
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+// BinaryMetamethod returns the metamethod called name of left or, if left
+// does not define it, of right
+func BinaryMetamethod(left, right Object, name string) (Object, bool) {
+	if hook, ok := Metamethod(left, name); ok {
+		return hook, true
+	}
+	return Metamethod(right, name)
+}
+
+// Index returns the value of key in the hash. If the hash does not contain
+// key and its metatable defines __index the key is looked up in turn in the
+// __index hash or, if __index is a function, the result of calling it with
+// call, the hash and key is returned. Reports false if key is not found.
+func (h *Hash) Index(key Object, call Caller) (Object, bool, error) {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return nil, false, fmt.Errorf("unusable as hash key: %s", key.Type())
+	}
+	hashed := hashable.HashKey()
+
+	for i := 0; i < maxIndexChain; i++ {
+		if pair, ok := h.Pairs[hashed]; ok {
+			return pair.Value, true, nil
+		}
+
+		hook, ok := Metamethod(h, "__index")
+		if !ok {
+			return nil, false, nil
+		}
+
+		next, ok := hook.(*Hash)
+		if !ok {
+			value, err := call(hook, h, key)
+			return value, err == nil, err
+		}
+		h = next
+	}
+
+	return nil, false, fmt.Errorf("__index chain too long looking up %s", key.Inspect())
+}
+
+// ToString returns the string representation of obj, which is the result of
+// calling its __str metamethod with call if it has one
+func ToString(obj Object, call Caller) (string, error) {
+	hook, ok := Metamethod(obj, "__str")
+	if !ok {
+		return obj.String(), nil
+	}
+
+	result, err := call(hook, obj)
+	if err != nil {
+		return "", err
+	}
+	str, ok := result.(*String)
+	if !ok {
+		return "", fmt.Errorf("__str must return str, got %s", result.Type())
+	}
+	return str.Value, nil
+}
+
+// CallBuiltin calls the builtin with args. The `len` builtin calls the __len
+// metamethod of its argument instead, if it has one, and `str` and `print`
+// convert arguments with a __str metamethod to strings first. Metamethods
+// are called with call.
+func CallBuiltin(builtin *Builtin, call Caller, args ...Object) (Object, error) {
+	switch builtin.Name {
+	case "len":
+		if len(args) == 1 {
+			if hook, ok := Metamethod(args[0], "__len"); ok {
+				return call(hook, args[0])
+			}
+		}
+
+	case "str", "print":
+		var converted []Object
+		for i, arg := range args {
+			if _, ok := Metamethod(arg, "__str"); !ok {
+				continue
+			}
+			str, err := ToString(arg, call)
+			if err != nil {
+				return nil, err
+			}
+			if converted == nil {
+				converted = make([]Object, len(args))
+				copy(converted, args)
+			}
+			converted[i] = &String{Value: str}
+		}
+		if converted != nil {
+			args = converted
+		}
+	}
+
+	return builtin.Fn(args...), nil
+}
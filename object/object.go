@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/prologic/monkey-lang/ast"
 	"github.com/prologic/monkey-lang/code"
@@ -42,16 +43,31 @@ const (
 	// BUILTIN is the Builtin object type
 	BUILTIN = "builtin"
 
-	// CLOSURE is the Closure object type
-	CLOSURE = "closure"
-
 	// ARRAY is the Array object type
 	ARRAY = "array"
 
 	// HASH is the Hash object type
 	HASH = "hash"
+
+	// QUOTE is the Quote object type
+	QUOTE = "quote"
+
+	// MACRO is the Macro object type
+	MACRO = "macro"
+
+	// STRUCT is the Struct object type, instances of a struct have the
+	// struct's name as their type
+	STRUCT = "struct"
 )
 
+// builtinTypes are the types of the builtin objects which struct names may
+// not redefine
+var builtinTypes = map[Type]bool{
+	INTEGER: true, STRING: true, BOOLEAN: true, NULL: true, RETURN: true,
+	ERROR: true, FUNCTION: true, COMPILED_FUNCTION: true, BUILTIN: true,
+	ARRAY: true, HASH: true, QUOTE: true, MACRO: true, STRUCT: true,
+}
+
 // Comparable is the interface for comparing two Object and their underlying
 // values. It is the responsibility of the caller (left) to check for types.
 // Returns `true` iif the types and values are identical, `false` otherwise.
@@ -113,6 +129,10 @@ func (i *Integer) Type() Type { return INTEGER }
 // Inspect returns a stringified version of the object for debugging
 func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 
+// MaxStringLength is the length in bytes of the longest string a repetition
+// may produce
+const MaxStringLength = 1 << 30
+
 // String is the string type used to represent string literals and holds
 // an internal string value
 type String struct {
@@ -141,6 +161,72 @@ func (s *String) Type() Type { return STRING }
 // Inspect returns a stringified version of the object for debugging
 func (s *String) Inspect() string { return fmt.Sprintf("%#v", s.Value) }
 
+// Len returns the number of characters (Unicode code points) in the string
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// CharAt returns the character (Unicode code point) at index i as a string
+// or false if i is out of bounds
+func (s *String) CharAt(i int64) (string, bool) {
+	if i < 0 {
+		return "", false
+	}
+
+	for offset := 0; offset < len(s.Value); i-- {
+		_, width := utf8.DecodeRuneInString(s.Value[offset:])
+		if i == 0 {
+			return s.Value[offset : offset+width], true
+		}
+		offset += width
+	}
+
+	return "", false
+}
+
+// IndexOf returns the index in characters (Unicode code points) of the first
+// occurrence of substr in the string or -1 if not present
+func (s *String) IndexOf(substr string) int {
+	i := strings.Index(s.Value, substr)
+	if i < 0 {
+		return i
+	}
+	return utf8.RuneCountInString(s.Value[:i])
+}
+
+// Repeat returns the string repeated n times, or an empty string if n is
+// negative. Returns an error if the result would be longer than
+// MaxStringLength bytes.
+func (s *String) Repeat(n int64) (*String, error) {
+	if n <= 0 || s.Value == "" {
+		return &String{}, nil
+	}
+	if n > int64(MaxStringLength/len(s.Value)) {
+		return nil, fmt.Errorf("string repeat count too large: %d", n)
+	}
+	return &String{Value: strings.Repeat(s.Value, int(n))}, nil
+}
+
+// Slice returns the characters (Unicode code points) of the string from
+// index start up to but not including index end
+func (s *String) Slice(start, end int) *String {
+	from, to, i := len(s.Value), len(s.Value), 0
+	for offset := range s.Value {
+		if i == start {
+			from = offset
+		}
+		if i == end {
+			to = offset
+			break
+		}
+		i++
+	}
+	if from > to {
+		from = to
+	}
+	return &String{Value: s.Value[from:to]}
+}
+
 // Boolean is the boolean type and used to represent boolean literals and
 // holds an interval bool value
 type Boolean struct {
@@ -228,11 +314,20 @@ func (e *Error) Type() Type { return ERROR }
 func (e *Error) Inspect() string { return "ERROR: " + e.Message }
 
 // CompiledFunction is the compiled function type that holds the function's
-// compiled body as bytecode instructions
+// compiled body as bytecode instructions. The last NumDefaults parameters
+// have default values and Entries[i] is the offset of the instructions to
+// start executing at when only NumParameters-NumDefaults+i arguments are
+// given, which evaluate the missing defaults before jumping to the body. If
+// Variadic is true any extra arguments are collected into the local after
+// the parameters.
 type CompiledFunction struct {
 	Instructions  code.Instructions
+	SourceMap     code.SourceMap
 	NumLocals     int
 	NumParameters int
+	NumDefaults   int
+	Entries       []int
+	Variadic      bool
 }
 
 func (cf *CompiledFunction) String() string {
@@ -251,10 +346,31 @@ func (cf *CompiledFunction) Inspect() string {
 // body and an environment to support closures.
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
+// CheckArity returns an error if a function with numParameters parameters,
+// the last numDefaults of which have default values, and a rest parameter if
+// variadic is true cannot be called with numArgs arguments
+func CheckArity(numParameters, numDefaults int, variadic bool, numArgs int) error {
+	required := numParameters - numDefaults
+	switch {
+	case numDefaults == 0 && !variadic && numArgs != numParameters:
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			numParameters, numArgs)
+	case numArgs < required:
+		return fmt.Errorf("wrong number of arguments: want at least %d, got=%d",
+			required, numArgs)
+	case numArgs > numParameters && !variadic:
+		return fmt.Errorf("wrong number of arguments: want at most %d, got=%d",
+			numParameters, numArgs)
+	}
+	return nil
+}
+
 func (f *Function) String() string {
 	return f.Inspect()
 }
@@ -267,8 +383,16 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	optional := len(f.Parameters) - len(f.Defaults)
+	for i, p := range f.Parameters {
+		if i >= optional {
+			params = append(params, p.String()+" = "+f.Defaults[i-optional].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -281,12 +405,66 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote is the quote object type that holds an unevaluated AST node
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) String() string {
+	return q.Inspect()
+}
+
+// Type returns the type of the object
+func (q *Quote) Type() Type { return QUOTE }
+
+// Inspect returns a stringified version of the object for debugging
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is the macro type that holds the macro's formal parameters, body
+// and the environment it was defined in.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) String() string {
+	return m.Inspect()
+}
+
+// Type returns the type of the object
+func (m *Macro) Type() Type { return MACRO }
+
+// Inspect returns a stringified version of the object for debugging
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
 // Builtin  is the builtin object type that simply holds a reference to
 // a BuiltinFunction type that takes zero or more objects as arguments
-// and returns an object.
+// and returns an object. Usage and Doc describe how to call the builtin
+// and what it does for the documentation generator.
 type Builtin struct {
-	Name string
-	Fn   BuiltinFunction
+	Name  string
+	Fn    BuiltinFunction
+	Usage string // e.g: len(iterable)
+	Doc   string
 }
 
 func (b *Builtin) String() string {
@@ -313,16 +491,22 @@ func (c *Closure) String() string {
 }
 
 // Type returns the type of the object
-func (c *Closure) Type() Type { return CLOSURE }
+func (c *Closure) Type() Type { return FUNCTION }
 
 // Inspect returns a stringified version of the object for debugging
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
 
-// Array is the array literal type that holds a slice of Object(s)
+// MaxArrayLength is the number of elements of the longest array a repetition
+// may produce
+const MaxArrayLength = 1 << 24
+
+// Array is the array literal type that holds a slice of Object(s). A frozen
+// array, see `freeze`, cannot be modified.
 type Array struct {
 	Elements []Object
+	Frozen   bool
 }
 
 func (ao *Array) Equal(other Object) bool {
@@ -368,6 +552,79 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// Repeat returns a new array of the elements repeated n times, or of the
+// elements as they are if n is less than 2. Returns an error if the result
+// would have more than MaxArrayLength elements.
+func (ao *Array) Repeat(n int64) (*Array, error) {
+	if n < 2 || len(ao.Elements) == 0 {
+		return &Array{Elements: ao.Elements}, nil
+	}
+	if n > int64(MaxArrayLength/len(ao.Elements)) {
+		return nil, fmt.Errorf("array repeat count too large: %d", n)
+	}
+	elements := make([]Object, 0, len(ao.Elements)*int(n))
+	for i := int64(0); i < n; i++ {
+		elements = append(elements, ao.Elements...)
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// Slice returns a new array of the elements from index start up to but not
+// including index end
+func (ao *Array) Slice(start, end int) *Array {
+	elements := make([]Object, end-start)
+	copy(elements, ao.Elements[start:end])
+	return &Array{Elements: elements}
+}
+
+// IndexOutOfBounds returns the error for an Integer or BigInteger index out
+// of the bounds of a sequence
+func IndexOutOfBounds(index Object) error {
+	return fmt.Errorf("index out of bounds: %s", index.Inspect())
+}
+
+// SliceBounds resolves the start and end of a slice of a sequence of the
+// given length. Either bound may be a Null if it was omitted, negative bounds
+// count from the end of the sequence and bounds are clamped to the sequence.
+// A BigInteger bound is an error rather than clamped.
+func SliceBounds(length int, start, end Object) (int, int, error) {
+	resolve := func(bound Object, def int) (int, error) {
+		switch bound := bound.(type) {
+		case *Null:
+			return def, nil
+		case *Integer:
+			i := bound.Value
+			if i < 0 {
+				i += int64(length)
+			}
+			if i < 0 {
+				return 0, nil
+			}
+			if i > int64(length) {
+				return length, nil
+			}
+			return int(i), nil
+		case *BigInteger:
+			return 0, IndexOutOfBounds(bound)
+		default:
+			return 0, fmt.Errorf("slice index must be int, got %s", bound.Type())
+		}
+	}
+
+	from, err := resolve(start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := resolve(end, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		to = from
+	}
+	return from, to, nil
+}
+
 // HashKey represents a hash key object and holds the Type of Object
 // hashed and its hash value in Value
 type HashKey struct {
@@ -407,9 +664,70 @@ type HashPair struct {
 	Value Object
 }
 
-// Hash is a hash map and holds a map of HashKey to HashPair(s)
+// Hash is a hash map and holds a map of HashKey to HashPair(s), the keys in
+// insertion order and an optional metatable, set with `setmeta`, whose
+// metamethods customize the behaviour of the hash. A frozen hash, see
+// `freeze`, cannot be modified. Pairs must be modified with Set and Delete
+// which maintain the order of the keys.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Keys   []HashKey
+	Meta   *Hash
+	Frozen bool
+}
+
+// NewHash returns a new empty hash
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set sets the pair of key, appending key to the order of the keys if it is
+// new or keeping its position otherwise
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// Delete removes the pair of key and reports whether it was present
+func (h *Hash) Delete(key HashKey) bool {
+	if _, ok := h.Pairs[key]; !ok {
+		return false
+	}
+	delete(h.Pairs, key)
+	for i, k := range h.Keys {
+		if k == key {
+			h.Keys = append(h.Keys[:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Items returns the pairs of the hash in insertion order
+func (h *Hash) Items() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
+}
+
+// Merge returns a new hash with the pairs of h followed by those of other.
+// Keys of other already in h replace their values but keep their position.
+func (h *Hash) Merge(other *Hash) *Hash {
+	hash := NewHash()
+	for _, key := range h.Keys {
+		hash.Set(key, h.Pairs[key])
+	}
+	for _, key := range other.Keys {
+		hash.Set(key, other.Pairs[key])
+	}
+	return hash
 }
 
 func (h *Hash) Equal(other Object) bool {
@@ -417,10 +735,9 @@ func (h *Hash) Equal(other Object) bool {
 		if len(h.Pairs) != len(obj.Pairs) {
 			return false
 		}
-		for _, pair := range h.Pairs {
+		for key, pair := range h.Pairs {
 			left := pair.Value
-			hashed := left.(Hashable)
-			right, ok := obj.Pairs[hashed.HashKey()]
+			right, ok := obj.Pairs[key]
 			if !ok {
 				return false
 			}
@@ -450,7 +767,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Items() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -461,3 +778,242 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// UnpackArray destructures obj which must be an array of exactly n elements
+// or, if rest is true, at least n elements. It returns the n elements followed,
+// if rest is true, by an array of the remaining elements.
+func UnpackArray(obj Object, n int, rest bool) ([]Object, error) {
+	array, ok := obj.(*Array)
+	if !ok {
+		return nil, fmt.Errorf("cannot destructure %s as array", obj.Type())
+	}
+
+	length := len(array.Elements)
+	if rest && length < n {
+		return nil, fmt.Errorf(
+			"cannot destructure array of length %d into at least %d elements",
+			length, n,
+		)
+	} else if !rest && length != n {
+		return nil, fmt.Errorf(
+			"cannot destructure array of length %d into %d elements",
+			length, n,
+		)
+	}
+
+	values := make([]Object, n, n+1)
+	copy(values, array.Elements[:n])
+	if rest {
+		values = append(values, array.Slice(n, length))
+	}
+	return values, nil
+}
+
+// UnpackHash destructures obj which must be a hash containing all of keys and
+// returns the values of the keys
+func UnpackHash(obj Object, keys []Object) ([]Object, error) {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return nil, fmt.Errorf("cannot destructure %s as hash", obj.Type())
+	}
+
+	values := make([]Object, len(keys))
+	for i, key := range keys {
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		pair, ok := hash.Pairs[hashable.HashKey()]
+		if !ok {
+			return nil, fmt.Errorf("missing key %s in hash", key.Inspect())
+		}
+		values[i] = pair.Value
+	}
+	return values, nil
+}
+
+// MatchLiteral reports whether obj equals literal, the value of a literal
+// pattern in a match expression. Objects of different types never match.
+func MatchLiteral(obj, literal Object) bool {
+	if obj.Type() != literal.Type() {
+		return false
+	}
+	comparable, ok := obj.(Comparable)
+	return ok && comparable.Equal(literal)
+}
+
+// MatchArray reports whether obj is an array matched by an array pattern of
+// n elements, that is an array of exactly n elements or, if rest is true, at
+// least n elements
+func MatchArray(obj Object, n int, rest bool) bool {
+	array, ok := obj.(*Array)
+	if !ok {
+		return false
+	}
+	if rest {
+		return len(array.Elements) >= n
+	}
+	return len(array.Elements) == n
+}
+
+// MatchHash reports whether obj is a hash containing all of keys
+func MatchHash(obj Object, keys []Object) bool {
+	_, err := UnpackHash(obj, keys)
+	return err == nil
+}
+
+// Struct is a user-defined record type declared with `struct` which holds
+// the names of its fields and its methods. Calling a struct with a value
+// for each field constructs an Instance.
+type Struct struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Object
+
+	index map[string]int
+}
+
+// NewStruct returns a new struct with the given name and fields and no
+// methods. It is an error for the name to be that of a builtin type.
+func NewStruct(name string, fields []string) (*Struct, error) {
+	if builtinTypes[Type(name)] {
+		return nil, fmt.Errorf("struct %s redefines a builtin type", name)
+	}
+
+	index := make(map[string]int, len(fields))
+	for i, field := range fields {
+		index[field] = i
+	}
+
+	return &Struct{
+		Name:    name,
+		Fields:  fields,
+		Methods: map[string]Object{},
+		index:   index,
+	}, nil
+}
+
+// Copy returns a new struct with the same name and fields as the struct and
+// no methods
+func (s *Struct) Copy() *Struct {
+	return &Struct{
+		Name:    s.Name,
+		Fields:  s.Fields,
+		Methods: map[string]Object{},
+		index:   s.index,
+	}
+}
+
+// New returns a new instance of the struct with the values of its fields
+func (s *Struct) New(values []Object) (*Instance, error) {
+	if len(values) != len(s.Fields) {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			len(s.Fields), len(values))
+	}
+
+	fields := make([]Object, len(values))
+	copy(fields, values)
+	return &Instance{Struct: s, Fields: fields}, nil
+}
+
+func (s *Struct) String() string {
+	return s.Inspect()
+}
+
+// Type returns the type of the object
+func (s *Struct) Type() Type { return STRUCT }
+
+// Inspect returns a stringified version of the object for debugging
+func (s *Struct) Inspect() string {
+	return fmt.Sprintf("<struct %s>", s.Name)
+}
+
+// Instance is an instance of a Struct which holds the values of its fields
+// in the order the fields are declared. The fields of a frozen instance, see
+// `freeze`, cannot be assigned.
+type Instance struct {
+	Struct *Struct
+	Fields []Object
+	Frozen bool
+}
+
+// Get returns the value of the field of the instance called name or, if
+// the struct has a method called name, the method bound to the instance
+func (i *Instance) Get(name Object) (Object, error) {
+	key, ok := name.(*String)
+	if !ok {
+		return nil, fmt.Errorf("unusable as field name: %s", name.Type())
+	}
+
+	if index, ok := i.Struct.index[key.Value]; ok {
+		return i.Fields[index], nil
+	}
+	if method, ok := i.Struct.Methods[key.Value]; ok {
+		return &BoundMethod{Self: i, Name: key.Value, Method: method}, nil
+	}
+
+	return nil, fmt.Errorf("unknown field %s of %s", key.Value, i.Struct.Name)
+}
+
+// Set sets the value of the field of the instance called name
+func (i *Instance) Set(name, value Object) error {
+	key, ok := name.(*String)
+	if !ok {
+		return fmt.Errorf("unusable as field name: %s", name.Type())
+	}
+
+	index, ok := i.Struct.index[key.Value]
+	if !ok {
+		return fmt.Errorf("unknown field %s of %s", key.Value, i.Struct.Name)
+	}
+	if i.Frozen {
+		return fmt.Errorf("cannot modify frozen %s", i.Struct.Name)
+	}
+
+	i.Fields[index] = value
+	return nil
+}
+
+func (i *Instance) String() string {
+	return i.Inspect()
+}
+
+// Type returns the type of the object, the name of its struct
+func (i *Instance) Type() Type { return Type(i.Struct.Name) }
+
+// Inspect returns a stringified version of the object for debugging
+func (i *Instance) Inspect() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for index, field := range i.Struct.Fields {
+		fields = append(fields, field+": "+i.Fields[index].Inspect())
+	}
+
+	out.WriteString(i.Struct.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// BoundMethod is a method of a struct bound to an instance of the struct
+// which is passed to the method as its first parameter, self, when called
+type BoundMethod struct {
+	Self   *Instance
+	Name   string
+	Method Object
+}
+
+func (bm *BoundMethod) String() string {
+	return bm.Inspect()
+}
+
+// Type returns the type of the object
+func (bm *BoundMethod) Type() Type { return FUNCTION }
+
+// Inspect returns a stringified version of the object for debugging
+func (bm *BoundMethod) Inspect() string {
+	return fmt.Sprintf("<bound method %s.%s>", bm.Self.Struct.Name, bm.Name)
+}
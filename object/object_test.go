@@ -1,6 +1,7 @@
 package object
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,346 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestHashEqual(t *testing.T) {
+	hash := func(key, value Object) *Hash {
+		h := NewHash()
+		h.Set(key.(Hashable).HashKey(), HashPair{Key: key, Value: value})
+		return h
+	}
+
+	a := hash(&String{Value: "a"}, &Integer{Value: 1})
+	b := hash(&String{Value: "a"}, &Integer{Value: 1})
+	c := hash(&String{Value: "a"}, &Integer{Value: 2})
+	d := hash(&String{Value: "b"}, &Integer{Value: 1})
+
+	if !a.Equal(b) {
+		t.Errorf("hashes with same pairs are not equal")
+	}
+	if a.Equal(c) {
+		t.Errorf("hashes with different values are equal")
+	}
+	if a.Equal(d) {
+		t.Errorf("hashes with different keys are equal")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	str := func(s string) *String { return &String{Value: s} }
+	set := func(h *Hash, key string, value int64) {
+		h.Set(str(key).HashKey(), HashPair{Key: str(key), Value: &Integer{Value: value}})
+	}
+
+	h := NewHash()
+	set(h, "b", 1)
+	set(h, "a", 2)
+	set(h, "c", 3)
+	set(h, "b", 4)
+
+	if h.Inspect() != `{"b": 4, "a": 2, "c": 3}` {
+		t.Errorf("hash is not in insertion order. got=%s", h.Inspect())
+	}
+
+	if !h.Delete(str("a").HashKey()) || h.Delete(str("a").HashKey()) {
+		t.Errorf("delete did not report whether the key was present")
+	}
+	set(h, "a", 5)
+	if h.Inspect() != `{"b": 4, "c": 3, "a": 5}` {
+		t.Errorf("deleted key was not appended again. got=%s", h.Inspect())
+	}
+
+	other := NewHash()
+	set(other, "d", 6)
+	set(other, "b", 7)
+	merged := h.Merge(other)
+	if merged.Inspect() != `{"b": 7, "c": 3, "a": 5, "d": 6}` {
+		t.Errorf("merged hash is not in insertion order. got=%s", merged.Inspect())
+	}
+	if h.Inspect() != `{"b": 4, "c": 3, "a": 5}` {
+		t.Errorf("merge modified the hash. got=%s", h.Inspect())
+	}
+}
+
+func TestStringCharacters(t *testing.T) {
+	str := &String{Value: "a\xffé世"}
+
+	if str.Len() != 4 {
+		t.Errorf("wrong length. want=4, got=%d", str.Len())
+	}
+
+	tests := []struct {
+		index    int64
+		expected string
+		ok       bool
+	}{
+		{-1, "", false},
+		{0, "a", true},
+		{1, "\xff", true},
+		{2, "é", true},
+		{3, "世", true},
+		{4, "", false},
+	}
+
+	for _, tt := range tests {
+		char, ok := str.CharAt(tt.index)
+		if char != tt.expected || ok != tt.ok {
+			t.Errorf("wrong char at %d. want=%q, %t, got=%q, %t",
+				tt.index, tt.expected, tt.ok, char, ok)
+		}
+	}
+
+	if i := str.IndexOf("世"); i != 3 {
+		t.Errorf("wrong index of 世. want=3, got=%d", i)
+	}
+	if i := str.IndexOf("x"); i != -1 {
+		t.Errorf("wrong index of x. want=-1, got=%d", i)
+	}
+}
+
+func TestStructInstances(t *testing.T) {
+	if _, err := NewStruct("str", nil); err == nil {
+		t.Errorf("expected error redefining a builtin type")
+	}
+
+	point, err := NewStruct("Point", []string{"x", "y"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	point.Methods["norm"] = &Builtin{Name: "norm"}
+
+	p, err := point.New([]Object{&Integer{Value: 1}, &Integer{Value: 2}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.Type() != "Point" {
+		t.Errorf("wrong type. want=Point, got=%s", p.Type())
+	}
+	if p.Inspect() != "Point{x: 1, y: 2}" {
+		t.Errorf("wrong inspect. got=%s", p.Inspect())
+	}
+
+	if err := p.Set(&String{Value: "y"}, &Integer{Value: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if y, _ := p.Get(&String{Value: "y"}); y.Inspect() != "3" {
+		t.Errorf("wrong value of y. want=3, got=%s", y.Inspect())
+	}
+
+	method, err := p.Get(&String{Value: "norm"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bm, ok := method.(*BoundMethod); !ok || bm.Self != p {
+		t.Errorf("method is not bound to the instance. got=%s", method.Inspect())
+	}
+
+	if _, err := p.Get(&String{Value: "z"}); err == nil || err.Error() != "unknown field z of Point" {
+		t.Errorf("wrong error getting unknown field. got=%v", err)
+	}
+	if err := p.Set(&String{Value: "norm"}, &Integer{Value: 1}); err == nil {
+		t.Errorf("expected error setting a method")
+	}
+
+	if _, err := point.New(nil); err == nil {
+		t.Errorf("expected error with missing fields")
+	}
+	if copied := point.Copy(); len(copied.Methods) != 0 || copied.Name != "Point" {
+		t.Errorf("wrong copy of struct. got=%s", copied.Inspect())
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 1}}}
+	key := &String{Value: "a"}
+	h := NewHash()
+	h.Set(key.HashKey(), HashPair{Key: key, Value: inner})
+	outer := &Array{Elements: []Object{h}}
+	inner.Elements = append(inner.Elements, outer)
+
+	if result := Freeze(outer); result != outer {
+		t.Fatalf("freeze did not return its argument. got=%v", result)
+	}
+	if !outer.Frozen || !h.Frozen || !inner.Frozen {
+		t.Errorf("freeze is not deep. outer=%t, hash=%t, inner=%t",
+			outer.Frozen, h.Frozen, inner.Frozen)
+	}
+
+	result := Push(inner, &Integer{Value: 2})
+	if err, ok := result.(*Error); !ok || err.Message != "cannot modify frozen array" {
+		t.Errorf("push to frozen array did not fail. got=%v", result)
+	}
+
+	st, _ := NewStruct("P", []string{"x"})
+	instance, _ := st.New([]Object{&Array{}})
+	Freeze(&Array{Elements: []Object{instance}})
+	if !instance.Frozen || !instance.Fields[0].(*Array).Frozen {
+		t.Errorf("freeze is not deep for instances. instance=%t, field=%t",
+			instance.Frozen, instance.Fields[0].(*Array).Frozen)
+	}
+
+	err := instance.Set(&String{Value: "x"}, &Integer{Value: 1})
+	if err == nil || err.Error() != "cannot modify frozen P" {
+		t.Errorf("set of frozen instance field did not fail. got=%v", err)
+	}
+}
+
+func TestMetamethods(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			key := pairs[i].(Hashable).HashKey()
+			h.Set(key, HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	str := func(s string) *String { return &String{Value: s} }
+
+	var calls []string
+	call := func(fn Object, args ...Object) (Object, error) {
+		calls = append(calls, fn.(*Builtin).Name)
+		return &String{Value: "called"}, nil
+	}
+
+	base := hash(str("x"), &Integer{Value: 1})
+	meta := hash(
+		str("__index"), base,
+		str("__len"), &Builtin{Name: "__len"},
+		str("__str"), &Builtin{Name: "__str"},
+		str("__add"), &Null{},
+	)
+	h := hash(str("y"), &Integer{Value: 2})
+	h.Meta = meta
+
+	if _, ok := Metamethod(h, "__add"); ok {
+		t.Errorf("null metamethod is defined")
+	}
+	if _, ok := Metamethod(base, "__len"); ok {
+		t.Errorf("hash without metatable has metamethod")
+	}
+	if hook, ok := BinaryMetamethod(base, h, "__len"); !ok || hook.(*Builtin).Name != "__len" {
+		t.Errorf("metamethod of right operand not found")
+	}
+
+	for key, expected := range map[string]string{"x": "1", "y": "2"} {
+		value, ok, err := h.Index(str(key), call)
+		if err != nil || !ok || value.Inspect() != expected {
+			t.Errorf("wrong value of %s. want=%s, got=%v (%v)", key, expected, value, err)
+		}
+	}
+	if _, ok, err := h.Index(str("z"), call); ok || err != nil {
+		t.Errorf("missing key found. err=%v", err)
+	}
+	base.Meta = hash(str("__index"), &Builtin{Name: "__index"})
+	if value, ok, _ := h.Index(str("z"), call); !ok || value.Inspect() != `"called"` {
+		t.Errorf("__index function not called. got=%v", value)
+	}
+	base.Meta = meta
+	if _, _, err := h.Index(str("z"), call); err == nil {
+		t.Errorf("expected error for __index cycle")
+	}
+
+	result, err := CallBuiltin(Builtins["len"], call, h)
+	if err != nil || result.Inspect() != `"called"` {
+		t.Errorf("wrong len result. got=%v (%v)", result, err)
+	}
+	result, err = CallBuiltin(Builtins["str"], call, h)
+	if err != nil || result.Inspect() != `"called"` {
+		t.Errorf("wrong str result. got=%v (%v)", result, err)
+	}
+	if s, _ := ToString(&Integer{Value: 3}, call); s != "3" {
+		t.Errorf("wrong string of int. got=%s", s)
+	}
+
+	expected := []string{"__index", "__len", "__str"}
+	if strings.Join(calls, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong metamethods called. want=%v, got=%v", expected, calls)
+	}
+
+	meta.Pairs[str("__str").HashKey()] = HashPair{Key: str("__str"), Value: &Builtin{Name: "int"}}
+	bad := func(fn Object, args ...Object) (Object, error) { return &Integer{Value: 1}, nil }
+	if _, err := ToString(h, bad); err == nil || err.Error() != "__str must return str, got int" {
+		t.Errorf("wrong error for __str not returning str. got=%v", err)
+	}
+}
+
+func TestIntegerOperation(t *testing.T) {
+	tests := []struct {
+		operator string
+		left     string
+		right    string
+		expected string
+		big      bool
+	}{
+		{"+", "1", "2", "3", false},
+		{"+", "9223372036854775807", "1", "9223372036854775808", true},
+		{"-", "-9223372036854775808", "1", "-9223372036854775809", true},
+		{"*", "4294967296", "4294967296", "18446744073709551616", true},
+		{"*", "-1", "-9223372036854775808", "9223372036854775808", true},
+		{"/", "-9223372036854775808", "-1", "9223372036854775808", true},
+		{"-", "9223372036854775808", "1", "9223372036854775807", false},
+		{"/", "18446744073709551616", "4294967296", "4294967296", false},
+		{"%", "18446744073709551617", "10", "7", false},
+		{"&", "18446744073709551615", "-1", "18446744073709551615", true},
+		{"|", "-18446744073709551616", "1", "-18446744073709551615", true},
+		{"^", "18446744073709551616", "18446744073709551616", "0", false},
+	}
+
+	for _, tt := range tests {
+		left, right := Int(&String{Value: tt.left}), Int(&String{Value: tt.right})
+		result, err := IntegerOperation(tt.operator, left, right)
+		if err != nil {
+			t.Fatalf("%s %s %s: unexpected error: %s", tt.left, tt.operator, tt.right, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s %s %s: want=%s, got=%s",
+				tt.left, tt.operator, tt.right, tt.expected, result.Inspect())
+		}
+		if _, big := result.(*BigInteger); big != tt.big {
+			t.Errorf("%s %s %s: want big=%t, got=%T",
+				tt.left, tt.operator, tt.right, tt.big, result)
+		}
+	}
+
+	for _, operator := range []string{"/", "%"} {
+		big := Int(&String{Value: "18446744073709551616"})
+		for _, left := range []Object{&Integer{Value: 1}, big} {
+			_, err := IntegerOperation(operator, left, &Integer{Value: 0})
+			if err == nil || err.Error() != "division by zero" {
+				t.Errorf("%s %s 0: want division by zero, got=%v",
+					left.Inspect(), operator, err)
+			}
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	a := Int(&String{Value: "18446744073709551616"})
+	b := Int(&String{Value: "18446744073709551616"})
+	c := Int(&String{Value: "-18446744073709551616"})
+
+	if !a.(Comparable).Equal(b) {
+		t.Errorf("big integers with same value are not equal")
+	}
+	if a.(Comparable).Equal(c) {
+		t.Errorf("big integers with different values are equal")
+	}
+	if a.(Hashable).HashKey() != b.(Hashable).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if a.(Hashable).HashKey() == c.(Hashable).HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+	if a.Type() != INTEGER {
+		t.Errorf("big integer has wrong type. got=%s", a.Type())
+	}
+
+	if CompareIntegers(c, &Integer{Value: 0}) != -1 || CompareIntegers(a, c) != 1 {
+		t.Errorf("big integers compare wrong")
+	}
+	if n := NegateInteger(&Integer{Value: -9223372036854775808}); n.Inspect() != "9223372036854775808" {
+		t.Errorf("wrong negation of min int64. got=%s", n.Inspect())
+	}
+	if n := InvertInteger(c); n.Inspect() != "18446744073709551615" {
+		t.Errorf("wrong inversion of %s. got=%s", c.Inspect(), n.Inspect())
+	}
+}
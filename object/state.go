@@ -2,11 +2,21 @@ package object
 
 import (
 	"io"
+	"os"
 )
 
 var (
 	Arguments      []string
-	StandardInput  io.Reader
-	StandardOutput io.Writer
-	ExitFunction   func(int)
+	StandardInput  io.Reader = os.Stdin
+	StandardOutput io.Writer = os.Stdout
+	ExitFunction   func(int) = os.Exit
+
+	// AssertFunction, if set, is called by the `assert` builtin with the
+	// assertion message when an assertion fails instead of exiting.
+	AssertFunction func(message string)
+
+	// ErrorFunction, if set, is called by the virtual machine with the
+	// message of an error returned by a builtin which is discarded, e.g. as
+	// the value of an expression statement, rather than used.
+	ErrorFunction func(message string)
 )
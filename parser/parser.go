@@ -2,7 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/prologic/monkey-lang/ast"
 	"github.com/prologic/monkey-lang/lexer"
@@ -22,9 +25,11 @@ const (
 	BitwiseOR   // |
 	BitwiseXOR  // ^
 	BitwiseAND  // &
+	SHIFT       // << or >>
 	SUM         // + or -
 	PRODUCT     // * / or %
 	PREFIX      // -X or !X
+	POWER       // **
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 
@@ -53,6 +58,19 @@ var precedences = map[token.Type]int{
 	token.LPAREN:     CALL,
 	token.LBRACKET:   INDEX,
 	token.DOT:        INDEX,
+
+	token.PLUS_ASSIGN:       ASSIGN,
+	token.MINUS_ASSIGN:      ASSIGN,
+	token.MULTIPLY_ASSIGN:   ASSIGN,
+	token.DIVIDE_ASSIGN:     ASSIGN,
+	token.MODULO_ASSIGN:     ASSIGN,
+	token.BitwiseAND_ASSIGN: ASSIGN,
+	token.BitwiseOR_ASSIGN:  ASSIGN,
+	token.BitwiseXOR_ASSIGN: ASSIGN,
+
+	token.LSHIFT: SHIFT,
+	token.RSHIFT: SHIFT,
+	token.POWER:  POWER,
 }
 
 type (
@@ -78,9 +96,11 @@ func New(l *lexer.Lexer) *Parser {
 	}
 
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
@@ -88,7 +108,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.STRUCT, p.parseStructLiteral)
+	p.registerPrefix(token.CONST, p.parseConstExpression)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -107,6 +131,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.BitwiseOR, p.parseInfixExpression)
 	p.registerInfix(token.BitwiseXOR, p.parseInfixExpression)
 	p.registerInfix(token.BitwiseAND, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
 
 	p.registerPrefix(token.NOT, p.parsePrefixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
@@ -115,12 +142,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.ELLIPSIS, p.parseSpreadExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.registerInfix(token.BIND, p.parseBindExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.MULTIPLY_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.DIVIDE_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.MODULO_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.BitwiseAND_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.BitwiseOR_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.BitwiseXOR_ASSIGN, p.parseAssignmentExpression)
 	p.registerInfix(token.DOT, p.parseSelectorExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -133,6 +169,16 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// The lexer reports an unterminated block comment as an illegal "/*"
+	// token positioned at the opening of the comment, which swallowed the
+	// rest of the input, so end the program there.
+	if p.peekToken.Type == token.ILLEGAL && p.peekToken.Literal == "/*" {
+		msg := fmt.Sprintf("unterminated block comment at line %d, column %d",
+			p.peekToken.Line, p.peekToken.Column)
+		p.errors = append(p.errors, msg)
+		p.peekToken = token.Token{Type: token.EOF, Line: p.peekToken.Line, Column: p.peekToken.Column}
+	}
 }
 
 func (p *Parser) curTokenIs(t token.Type) bool {
@@ -192,6 +238,8 @@ func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.COMMENT:
 		return p.parseComment()
+	case token.DOC_COMMENT:
+		return p.parseDocComment()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	default:
@@ -203,6 +251,41 @@ func (p *Parser) parseComment() ast.Statement {
 	return &ast.Comment{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseDocComment parses the consecutive lines of a doc comment and attaches
+// it to the binding or struct declared by the statement that follows. A doc
+// comment not followed by a statement is parsed as a comment.
+func (p *Parser) parseDocComment() ast.Statement {
+	comment := &ast.Comment{Token: p.curToken, Value: p.parseDoc()}
+
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.RBRACE) {
+		return comment
+	}
+	p.nextToken()
+
+	stmt := p.parseStatement()
+	if es, ok := stmt.(*ast.ExpressionStatement); ok {
+		switch node := es.Expression.(type) {
+		case *ast.BindExpression:
+			node.Doc = comment.Value
+		case *ast.StructLiteral:
+			node.Doc = comment.Value
+		}
+	}
+
+	return stmt
+}
+
+// parseDoc reads the lines of a doc comment starting at the current token
+// and returns its text with the space after each line's /// removed
+func (p *Parser) parseDoc() string {
+	lines := []string{strings.TrimPrefix(p.curToken.Literal, " ")}
+	for p.peekTokenIs(token.DOC_COMMENT) {
+		p.nextToken()
+		lines = append(lines, strings.TrimPrefix(p.curToken.Literal, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -276,22 +359,166 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
+	if err := checkIntegerLiteral(p.curToken.Literal); err != nil {
+		msg := fmt.Sprintf("%s at line %d, column %d",
+			err, p.curToken.Line, p.curToken.Column)
 		p.errors = append(p.errors, msg)
 		return nil
 	}
 
+	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err != nil {
+		b, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+		if !ok {
+			msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		lit.Big = b
+		return lit
+	}
+
 	lit.Value = value
 
 	return lit
 }
 
+// checkIntegerLiteral checks that lit is a decimal integer literal or a hex,
+// binary or octal literal with a 0x, 0b or 0o prefix, whose digits may be
+// separated by single underscores, e.g: 1_000_000 or 0xFF_FF. The literal of
+// a negative integer in a match pattern is prefixed with a -.
+func checkIntegerLiteral(lit string) error {
+	unsigned := strings.TrimPrefix(lit, "-")
+	base, name, digits := 10, "decimal", unsigned
+	if len(unsigned) > 1 && unsigned[0] == '0' {
+		switch unsigned[1] {
+		case 'x', 'X':
+			base, name, digits = 16, "hex", unsigned[2:]
+		case 'b', 'B':
+			base, name, digits = 2, "binary", unsigned[2:]
+		case 'o', 'O':
+			base, name, digits = 8, "octal", unsigned[2:]
+		default:
+			if rest := strings.TrimLeft(unsigned[1:], "_"); rest != "" && isDigit(rest[0]) {
+				return fmt.Errorf("leading zeros in decimal literal %q, use 0o for octal", lit)
+			}
+		}
+	}
+
+	if digits == "" {
+		return fmt.Errorf("%s literal %q has no digits", name, lit)
+	}
+
+	for i, ch := range digits {
+		if ch == '_' {
+			if i == 0 || i == len(digits)-1 || digits[i-1] == '_' {
+				return fmt.Errorf("'_' must separate successive digits in %q", lit)
+			}
+			continue
+		}
+		if digitValue(ch) >= base {
+			return fmt.Errorf("invalid digit %q in %s literal %q", ch, name, lit)
+		}
+	}
+
+	return nil
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// digitValue returns the value of the digit ch in bases up to 16, or 16 if
+// ch is not a digit
+func digitValue(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	default:
+		return 16
+	}
+}
+
+// parseIllegal reports an illegal token. The lexer reports a malformed
+// string literal as an ILLEGAL token whose literal is the error message
+// rather than the single illegal character.
+func (p *Parser) parseIllegal() ast.Expression {
+	if utf8.RuneCountInString(p.curToken.Literal) == 1 {
+		p.noPrefixParseFnError(p.curToken.Type)
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s at line %d, column %d",
+		p.curToken.Literal, p.curToken.Line, p.curToken.Column)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	lit := &ast.TemplateLiteral{Token: p.curToken}
+
+	texts, exprs, err := lexer.Template(p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as string: %s", p.curToken.Literal, err)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	for i, text := range texts {
+		if text != "" {
+			t := token.Token{
+				Type:    token.STRING,
+				Literal: text,
+				Line:    p.curToken.Line,
+				Column:  p.curToken.Column,
+			}
+			lit.Parts = append(lit.Parts, &ast.StringLiteral{Token: t, Value: text})
+		}
+
+		if i < len(exprs) {
+			exp := p.parseInterpolation(exprs[i])
+			if exp == nil {
+				return nil
+			}
+			lit.Parts = append(lit.Parts, exp)
+		}
+	}
+
+	return lit
+}
+
+// parseInterpolation parses the source of an expression interpolated in a
+// string with a new parser and adds its errors to ours
+func (p *Parser) parseInterpolation(src string) ast.Expression {
+	ip := New(lexer.New(src))
+
+	if ip.curTokenIs(token.EOF) {
+		p.errors = append(p.errors, "empty expression in string interpolation")
+		return nil
+	}
+
+	exp := ip.parseExpression(LOWEST)
+	if len(ip.errors) == 0 && !ip.peekTokenIs(token.EOF) {
+		msg := fmt.Sprintf("unexpected %s in string interpolation", ip.peekToken.Type)
+		ip.errors = append(ip.errors, msg)
+	}
+
+	if len(ip.errors) != 0 {
+		p.errors = append(p.errors, ip.errors...)
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -313,6 +540,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	// ** is right associative so 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if p.curTokenIs(token.POWER) {
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -364,13 +595,11 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 		if p.peekTokenIs(token.IF) {
 			p.nextToken()
-			expression.Alternative = &ast.BlockStatement{
-				Statements: []ast.Statement{
-					&ast.ExpressionStatement{
-						Expression: p.parseIfExpression(),
-					},
-				},
+			elseIf, ok := p.parseIfExpression().(*ast.IfExpression)
+			if !ok {
+				return nil
 			}
+			expression.ElseIf = elseIf
 			return expression
 		}
 
@@ -407,6 +636,235 @@ func (p *Parser) parseWhileExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+
+	var guard ast.Expression
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	arm := &ast.MatchArm{Token: p.curToken, Pattern: pattern, Guard: guard}
+
+	p.nextToken()
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+	} else {
+		body := &ast.ExpressionStatement{Token: p.curToken}
+		body.Expression = p.parseExpression(LOWEST)
+		arm.Body = &ast.BlockStatement{
+			Token:      arm.Token,
+			Statements: []ast.Statement{body},
+		}
+	}
+
+	return arm
+}
+
+// parsePattern parses the pattern of a match arm which is either a single
+// pattern or several alternative patterns separated by |
+func (p *Parser) parsePattern() ast.Expression {
+	tok := p.curToken
+
+	pattern := p.parsePrimaryPattern()
+	if pattern == nil || !p.peekTokenIs(token.BitwiseOR) {
+		return pattern
+	}
+
+	alternatives := []ast.Expression{pattern}
+	for p.peekTokenIs(token.BitwiseOR) {
+		p.nextToken()
+		p.nextToken()
+		pattern := p.parsePrimaryPattern()
+		if pattern == nil {
+			return nil
+		}
+		alternatives = append(alternatives, pattern)
+	}
+
+	for _, alt := range alternatives {
+		if ident := patternBinding(alt); ident != nil {
+			msg := fmt.Sprintf("alternative patterns cannot bind %s", ident)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	return &ast.AlternativePattern{Token: tok, Alternatives: alternatives}
+}
+
+func (p *Parser) parsePrimaryPattern() ast.Expression {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseIdentifier()
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBoolean()
+	case token.NULL:
+		return p.parseNull()
+	case token.MINUS:
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		p.curToken.Literal = "-" + p.curToken.Literal
+		return p.parseIntegerLiteral()
+	case token.LBRACKET:
+		return p.parseArrayMatchPattern()
+	case token.LBRACE:
+		return p.parseHashMatchPattern()
+	default:
+		msg := fmt.Sprintf("invalid pattern %s", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayMatchPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+func (p *Parser) parseHashMatchPattern() ast.Expression {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		var value ast.Expression
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if value = p.parsePattern(); value == nil {
+				return nil
+			}
+		}
+
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Patterns = append(pattern.Patterns, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+// patternBinding returns the first variable bound by a match pattern or nil
+// if the pattern binds no variables
+func patternBinding(pattern ast.Expression) *ast.Identifier {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			return pattern
+		}
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			if ident := patternBinding(el); ident != nil {
+				return ident
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			return pattern.Rest
+		}
+	case *ast.HashPattern:
+		for i, key := range pattern.Keys {
+			if pattern.Patterns[i] == nil {
+				return key
+			}
+			if ident := patternBinding(pattern.Patterns[i]); ident != nil {
+				return ident
+			}
+		}
+	}
+	return nil
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -431,42 +889,351 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	prelude := p.parseFunctionParameters(lit)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+	lit.Body.Statements = append(prelude, lit.Body.Statements...)
+
+	return lit
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	params := &ast.FunctionLiteral{}
+	prelude := p.parseFunctionParameters(params)
+	if len(params.Defaults) > 0 || params.Rest != nil {
+		msg := "macro parameters cannot have defaults or a rest parameter"
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Parameters = params.Parameters
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
 	lit.Body = p.parseBlockStatement()
+	lit.Body.Statements = append(prelude, lit.Body.Statements...)
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+func (p *Parser) parseStructLiteral() ast.Expression {
+	lit := &ast.StructLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	lit.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	member := func(ident *ast.Identifier) bool {
+		if seen[ident.Value] {
+			msg := fmt.Sprintf("duplicate field or method %s in struct %s", ident, lit.Name)
+			p.errors = append(p.errors, msg)
+			return false
+		}
+		seen[ident.Value] = true
+		return true
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		switch {
+		case p.peekTokenIs(token.IDENT):
+			p.nextToken()
+			field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !member(field) {
+				return nil
+			}
+			lit.Fields = append(lit.Fields, field)
+
+		case p.peekTokenIs(token.DOC_COMMENT) || p.peekTokenIs(token.FUNCTION):
+			p.nextToken()
+			doc := ""
+			if p.curTokenIs(token.DOC_COMMENT) {
+				doc = p.parseDoc()
+				if !p.expectPeek(token.FUNCTION) {
+					return nil
+				}
+			}
+			name, method := p.parseMethod()
+			if method == nil || !member(name) {
+				return nil
+			}
+			method.Doc = doc
+			lit.MethodNames = append(lit.MethodNames, name)
+			lit.Methods = append(lit.Methods, method)
+
+		default:
+			p.peekError(token.IDENT)
+			return nil
+		}
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+// parseMethod parses a method declaration of a struct, e.g: fn norm() { ... },
+// into its name and a function literal whose first parameter is self
+func (p *Parser) parseMethod() (*ast.Identifier, *ast.FunctionLiteral) {
+	fn := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, nil
+	}
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil, nil
+	}
+
+	prelude := p.parseFunctionParameters(fn)
+	if prelude == nil {
+		return nil, nil
+	}
+	self := &ast.Identifier{
+		Token: token.Token{
+			Type:    token.IDENT,
+			Literal: "self",
+			Line:    name.Token.Line,
+			Column:  name.Token.Column,
+		},
+		Value: "self",
+	}
+	fn.Parameters = append([]*ast.Identifier{self}, fn.Parameters...)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil, nil
+	}
+
+	fn.Body = p.parseBlockStatement()
+	fn.Body.Statements = append(prelude, fn.Body.Statements...)
+
+	return name, fn
+}
+
+// parseFunctionParameters parses the parameters of a function (or macro)
+// literal into lit along with any default values and rest parameter.
+// Destructured parameters are bound to a hidden parameter named after the
+// pattern, which cannot clash with an identifier, and are destructured by the
+// returned prelude of statements at the start of the function's body.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) []ast.Statement {
+	lit.Parameters = []*ast.Identifier{}
+	prelude := []ast.Statement{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return prelude
 	}
 
-	p.nextToken()
+	parseParameter := func() bool {
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.peekTokenIs(token.RPAREN) {
+				msg := fmt.Sprintf("rest parameter ...%s must be the last parameter", lit.Rest)
+				p.errors = append(p.errors, msg)
+				return false
+			}
+			return true
+		}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		var ident *ast.Identifier
+		if !p.curTokenIs(token.LBRACKET) && !p.curTokenIs(token.LBRACE) {
+			ident = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		} else {
+			tok := p.curToken
+			pattern := p.patternFrom(p.parseExpression(ASSIGN))
+			if pattern == nil {
+				return false
+			}
+
+			ident = &ast.Identifier{
+				Token: token.Token{
+					Type:    token.IDENT,
+					Literal: pattern.String(),
+					Line:    tok.Line,
+					Column:  tok.Column,
+				},
+				Value: pattern.String(),
+			}
+
+			prelude = append(prelude, &ast.ExpressionStatement{
+				Token: tok,
+				Expression: &ast.BindExpression{
+					Token: token.Token{
+						Type:    token.BIND,
+						Literal: ":=",
+						Line:    tok.Line,
+						Column:  tok.Column,
+					},
+					Left:      pattern,
+					Value:     ident,
+					Parameter: true,
+				},
+			})
+		}
+		lit.Parameters = append(lit.Parameters, ident)
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			lit.Defaults = append(lit.Defaults, p.parseExpression(LOWEST))
+		} else if len(lit.Defaults) > 0 {
+			msg := fmt.Sprintf("parameter %s without a default follows a parameter with a default", ident)
+			p.errors = append(p.errors, msg)
+			return false
+		}
+
+		return true
+	}
+
+	p.nextToken()
+	if !parseParameter() {
+		return nil
+	}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		if !parseParameter() {
+			return nil
+		}
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return identifiers
+	if msg := checkDefaults(lit, prelude); msg != "" {
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return prelude
+}
+
+// checkDefaults checks that the default value of each parameter of lit only
+// refers to the plain parameters before it, as its own parameter, the later
+// ones, the rest parameter and the variables of pattern parameters, which
+// are destructured by prelude, are not yet bound when it is evaluated.
+// Returns an error message if not.
+func checkDefaults(lit *ast.FunctionLiteral, prelude []ast.Statement) string {
+	if len(lit.Defaults) == 0 {
+		return ""
+	}
+
+	unbound := map[string]bool{}
+	for _, stmt := range prelude {
+		bind := stmt.(*ast.ExpressionStatement).Expression.(*ast.BindExpression)
+		for _, name := range boundNames(bind.Left) {
+			unbound[name] = true
+		}
+	}
+	if lit.Rest != nil {
+		unbound[lit.Rest.Value] = true
+	}
+
+	optional := len(lit.Parameters) - len(lit.Defaults)
+	for _, param := range lit.Parameters[optional:] {
+		unbound[param.Value] = true
+	}
+
+	for i, def := range lit.Defaults {
+		param := lit.Parameters[optional+i]
+		if name := unboundReference(def, unbound); name != "" {
+			return fmt.Sprintf("default of parameter %s refers to parameter %s which is not yet bound",
+				param, name)
+		}
+		delete(unbound, param.Value)
+	}
+
+	return ""
+}
+
+// boundNames returns the names of the variables bound by a pattern
+func boundNames(pattern ast.Node) []string {
+	var names []string
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	return names
+}
+
+// unboundReference returns the first of the unbound names node refers to,
+// skipping those shadowed by the parameters and bindings of nested functions,
+// or "" if none
+func unboundReference(node ast.Node, unbound map[string]bool) string {
+	var found string
+	ast.Inspect(node, func(node ast.Node) bool {
+		if found != "" {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if unbound[node.Value] {
+				found = node.Value
+			}
+
+		case *ast.FunctionLiteral:
+			inner := map[string]bool{}
+			for name := range unbound {
+				inner[name] = true
+			}
+			for _, param := range node.Parameters {
+				delete(inner, param.Value)
+			}
+			if node.Rest != nil {
+				delete(inner, node.Rest.Value)
+			}
+			ast.Inspect(node.Body, func(node ast.Node) bool {
+				if bind, ok := node.(*ast.BindExpression); ok {
+					for _, name := range boundNames(bind.Left) {
+						delete(inner, name)
+					}
+				}
+				return true
+			})
+
+			for _, def := range node.Defaults {
+				if found = unboundReference(def, inner); found != "" {
+					return false
+				}
+			}
+			found = unboundReference(node.Body, inner)
+			return false
+		}
+
+		return true
+	})
+	return found
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -524,6 +1291,10 @@ func (p *Parser) parseSelectorExpression(exp ast.Expression) ast.Expression {
 func (p *Parser) parseBindExpression(exp ast.Expression) ast.Expression {
 	switch node := exp.(type) {
 	case *ast.Identifier:
+	case *ast.ArrayLiteral, *ast.HashPattern:
+		if exp = p.patternFrom(exp); exp == nil {
+			return nil
+		}
 	default:
 		msg := fmt.Sprintf("expected identifier expression on left but got %T %#v", node, exp)
 		p.errors = append(p.errors, msg)
@@ -540,7 +1311,32 @@ func (p *Parser) parseBindExpression(exp ast.Expression) ast.Expression {
 	// functions work. This is used by the compiler to emit LoadSelf so a ref
 	// to the current function is available.
 	if fl, ok := be.Value.(*ast.FunctionLiteral); ok {
-		ident := be.Left.(*ast.Identifier)
+		if ident, ok := be.Left.(*ast.Identifier); ok {
+			fl.Name = ident.Value
+		}
+	}
+
+	return be
+}
+
+// parseConstExpression parses a constant binding of the form const x = 1
+func (p *Parser) parseConstExpression() ast.Expression {
+	be := &ast.BindExpression{Token: p.curToken, Const: true}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	be.Left = ident
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	be.Value = p.parseExpression(LOWEST)
+
+	if fl, ok := be.Value.(*ast.FunctionLiteral); ok {
 		fl.Name = ident.Value
 	}
 
@@ -548,8 +1344,19 @@ func (p *Parser) parseBindExpression(exp ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseAssignmentExpression(exp ast.Expression) ast.Expression {
+	compound := !p.curTokenIs(token.ASSIGN)
+
 	switch node := exp.(type) {
 	case *ast.Identifier, *ast.IndexExpression:
+	case *ast.ArrayLiteral, *ast.HashPattern:
+		if compound {
+			msg := fmt.Sprintf("cannot use %s with destructuring pattern %s", p.curToken.Literal, exp)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if exp = p.patternFrom(exp); exp == nil {
+			return nil
+		}
 	default:
 		msg := fmt.Sprintf("expected identifier or index expression on left but got %T %#v", node, exp)
 		p.errors = append(p.errors, msg)
@@ -557,6 +1364,9 @@ func (p *Parser) parseAssignmentExpression(exp ast.Expression) ast.Expression {
 	}
 
 	ae := &ast.AssignmentExpression{Token: p.curToken, Left: exp}
+	if compound {
+		ae.Operator = strings.TrimSuffix(p.curToken.Literal, "=")
+	}
 
 	p.nextToken()
 
@@ -565,11 +1375,75 @@ func (p *Parser) parseAssignmentExpression(exp ast.Expression) ast.Expression {
 	return ae
 }
 
-func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+// patternFrom converts an expression parsed on the left of a binding or
+// assignment (or as a function parameter) into a destructuring pattern
+func (p *Parser) patternFrom(exp ast.Expression) ast.Expression {
+	switch node := exp.(type) {
+	case *ast.Identifier, *ast.HashPattern:
+		return node
+	case *ast.ArrayLiteral:
+		pattern := &ast.ArrayPattern{Token: node.Token}
+		for i, el := range node.Elements {
+			if spread, ok := el.(*ast.SpreadExpression); ok && i == len(node.Elements)-1 {
+				if ident, ok := spread.Value.(*ast.Identifier); ok {
+					pattern.Rest = ident
+					continue
+				}
+			}
+
+			el = p.patternFrom(el)
+			if el == nil {
+				return nil
+			}
+			pattern.Elements = append(pattern.Elements, el)
+		}
+		return pattern
+	case nil:
+		return nil
+	default:
+		msg := fmt.Sprintf("invalid destructuring target %s", exp)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	exp := &ast.SpreadExpression{Token: p.curToken}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	exp.Value = p.parseExpression(PREFIX)
+
+	return exp
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -586,6 +1460,13 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
+		// A hash without values such as {name, age} is a destructuring
+		// pattern
+		if ident, ok := key.(*ast.Identifier); ok && len(hash.Pairs) == 0 &&
+			(p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE)) {
+			return p.parseHashPattern(hash.Token, ident)
+		}
+
 		if !p.expectPeek(token.COLON) {
 			return nil
 		}
@@ -594,6 +1475,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -607,3 +1489,25 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	return hash
 }
+
+func (p *Parser) parseHashPattern(tok token.Token, first *ast.Identifier) ast.Expression {
+	pattern := &ast.HashPattern{Token: tok, Keys: []*ast.Identifier{first}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		pattern.Keys = append(pattern.Keys, key)
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
@@ -40,6 +40,96 @@ func TestComments(t *testing.T) {
 	}
 }
 
+func TestDocComments(t *testing.T) {
+	input := `/// Adds a and b.
+///
+///   add(1, 2) # 3
+add := fn(a, b) { a /* plus */ + b }
+
+/// A point
+struct Point {
+  x,
+  /// The x coordinate
+  fn getX() { self.x }
+  fn getY() { 0 }
+}
+
+// Not a doc comment
+x := 1
+f := fn() {
+  /// Inner
+  y := 2
+  /// Dangling
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("program.Statements does not contain 5 statements. got=%d",
+			len(program.Statements))
+	}
+
+	add := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.BindExpression)
+	if add.Doc != "Adds a and b.\n\n  add(1, 2) # 3" {
+		t.Errorf("add.Doc wrong. got=%q", add.Doc)
+	}
+	if add.Value.String() != "fn add(a, b) (a + b)" {
+		t.Errorf("add.Value wrong. got=%q", add.Value.String())
+	}
+
+	point := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.StructLiteral)
+	if point.Doc != "A point" {
+		t.Errorf("point.Doc wrong. got=%q", point.Doc)
+	}
+	if point.Methods[0].Doc != "The x coordinate" || point.Methods[1].Doc != "" {
+		t.Errorf("method docs wrong. got=%q, %q", point.Methods[0].Doc, point.Methods[1].Doc)
+	}
+
+	x := program.Statements[3].(*ast.ExpressionStatement).Expression.(*ast.BindExpression)
+	if x.Doc != "" {
+		t.Errorf("x.Doc wrong. got=%q", x.Doc)
+	}
+
+	f := program.Statements[4].(*ast.ExpressionStatement).Expression.(*ast.BindExpression)
+	body := f.Value.(*ast.FunctionLiteral).Body.Statements
+	if len(body) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(body))
+	}
+	y := body[0].(*ast.ExpressionStatement).Expression.(*ast.BindExpression)
+	if y.Doc != "Inner" {
+		t.Errorf("y.Doc wrong. got=%q", y.Doc)
+	}
+	if comment, ok := body[1].(*ast.Comment); !ok || comment.Value != "Dangling" {
+		t.Errorf("expected dangling doc comment, got=%#v", body[1])
+	}
+}
+
+func TestUnterminatedBlockCommentsAndRawStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x := 1 /* comment", "unterminated block comment at line 1, column 8"},
+		{"x := 1\n  /* outer /* inner */\ny := 2", "unterminated block comment at line 2, column 3"},
+		{"let x /* /* */ */ = /*", "unterminated block comment at line 1, column 21"},
+		{"x := `raw\ny := 2", "unterminated raw string at line 1, column 6"},
+		{"x := \"\"\"abc\nprint(1)", "unterminated multi-line string at line 1, column 6"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestAssignmentExpressions(t *testing.T) {
 	assert := assert.New(t)
 
@@ -52,6 +142,12 @@ func TestAssignmentExpressions(t *testing.T) {
 		{"foobar = y;", "foobar=y"},
 		{"[1, 2, 3][1] = 4", "([1, 2, 3][1])=4"},
 		{`{"a": 1}["b"] = 2`, `({a:1}[b])=2`},
+		{"[a, b] = [b, a]", "[a, b]=[b, a]"},
+		{"{a, b} = h", "{a, b}=h"},
+		{"x += 1", "x+=1"},
+		{"x -= y * 2", "x-=(y * 2)"},
+		{"xs[0] *= 2", "(xs[0])*=2"},
+		{"h.count |= 1", "(h[count])|=1"},
 	}
 
 	for _, tt := range tests {
@@ -64,6 +160,38 @@ func TestAssignmentExpressions(t *testing.T) {
 	}
 }
 
+func TestCompoundAssignmentOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+	}{
+		{"x += 1", "+"},
+		{"x -= 1", "-"},
+		{"x *= 1", "*"},
+		{"x /= 1", "/"},
+		{"x %= 1", "%"},
+		{"x &= 1", "&"},
+		{"x |= 1", "|"},
+		{"x ^= 1", "^"},
+		{"x = 1", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		ae, ok := stmt.Expression.(*ast.AssignmentExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignmentExpression. got=%T", stmt.Expression)
+		}
+		if ae.Operator != tt.operator {
+			t.Errorf("ae.Operator not %q. got=%q", tt.operator, ae.Operator)
+		}
+	}
+}
+
 func TestBindExpressions(t *testing.T) {
 	assert := assert.New(t)
 
@@ -74,6 +202,12 @@ func TestBindExpressions(t *testing.T) {
 		{"x := 5;", "x:=5"},
 		{"y := true;", "y:=true"},
 		{"foobar := y;", "foobar:=y"},
+		{"[a, b] := xs;", "[a, b]:=xs"},
+		{"[a, ...rest] := xs;", "[a, ...rest]:=xs"},
+		{"[] := xs;", "[]:=xs"},
+		{"[[a, b], {c}] := xs;", "[[a, b], {c}]:=xs"},
+		{"{name, age} := person;", "{name, age}:=person"},
+		{"{name,} := person;", "{name}:=person"},
 	}
 
 	for _, tt := range tests {
@@ -86,6 +220,48 @@ func TestBindExpressions(t *testing.T) {
 	}
 }
 
+func TestConstExpressions(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 5;", "const x = 5"},
+		{"const y = x * 2", "const y = (x * 2)"},
+		{"const f = fn(a) { a }", "const f = fn f(a) a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		assert.Equal(tt.expected, program.String())
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		assert.True(stmt.Expression.(*ast.BindExpression).Const)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"const [a, b] = xs", "expected next token to be IDENT, got [ instead"},
+		{"const x := 1", "expected next token to be =, got := instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		assert.NotEmpty(p.Errors(), tt.input)
+		if len(p.Errors()) > 0 {
+			assert.Equal(tt.expected, p.Errors()[0])
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -184,6 +360,98 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"1_000_000", 1000000},
+		{"0xFF", 255},
+		{"0Xff_ff", 65535},
+		{"0b1010", 10},
+		{"0B1_0000_0000", 256},
+		{"0o17", 15},
+		{"0O7_7", 63},
+		{"0x7FFF_FFFF_FFFF_FFFF", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value of %s not %d. got=%d", tt.input, tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestBigIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"100_000_000_000_000_000_000", "100000000000000000000"},
+		{"0x1_0000_0000_0000_0000", "18446744073709551616"},
+		{"0b1_0000000000000000000000000000000000000000000000000000000000000000", "18446744073709551616"},
+		{"0o2000000000000000000000", "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Big == nil || literal.Big.String() != tt.expected {
+			t.Errorf("literal.Big of %s not %s. got=%s", tt.input, tt.expected, literal.Big)
+		}
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x", `hex literal "0x" has no digits at line 1, column 1`},
+		{"0b", `binary literal "0b" has no digits at line 1, column 1`},
+		{"0xFG", `invalid digit 'G' in hex literal "0xFG" at line 1, column 1`},
+		{"0b102", `invalid digit '2' in binary literal "0b102" at line 1, column 1`},
+		{"0o8", `invalid digit '8' in octal literal "0o8" at line 1, column 1`},
+		{"12abc", `invalid digit 'a' in decimal literal "12abc" at line 1, column 1`},
+		{"1__000", `'_' must separate successive digits in "1__000" at line 1, column 1`},
+		{"1000_", `'_' must separate successive digits in "1000_" at line 1, column 1`},
+		{"0x_FF", `'_' must separate successive digits in "0x_FF" at line 1, column 1`},
+		{"0123", `leading zeros in decimal literal "0123", use 0o for octal at line 1, column 1`},
+		{"0_1", `leading zeros in decimal literal "0_1", use 0o for octal at line 1, column 1`},
+		{"0_", `'_' must separate successive digits in "0_" at line 1, column 1`},
+		{"00", `leading zeros in decimal literal "00", use 0o for octal at line 1, column 1`},
+		{"x := 1\nprint(0123, 007)", `leading zeros in decimal literal "0123", use 0o for octal at line 2, column 7`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -295,6 +563,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"a + b << c - d >> e",
+			"(((a + b) << (c - d)) >> e)",
+		},
+		{
+			"a & b << c",
+			"(a & (b << c))",
+		},
+		{
+			"a * b ** c ** d",
+			"(a * (b ** (c ** d)))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** -b",
+			"(a ** (-b))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -407,6 +695,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"d.foo * d.bar",
 			"((d[foo]) * (d[bar]))",
 		},
+		{
+			"a * xs[1 + 1:-1] * d",
+			"((a * (xs[(1 + 1):(-1)])) * d)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -678,20 +970,13 @@ func TestIfElseIfExpression(t *testing.T) {
 		return
 	}
 
-	if len(exp.Alternative.Statements) != 1 {
-		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
-			len(exp.Alternative.Statements))
-	}
-
-	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Alternative.Statements[0])
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
 	}
 
-	altexp, ok := alternative.Expression.(*ast.IfExpression)
-	if !ok {
-		t.Fatalf("alternative.Expression is not ast.IfExpression. got=%T", alternative.Expression)
+	altexp := exp.ElseIf
+	if altexp == nil {
+		t.Fatalf("exp.ElseIf is nil")
 	}
 
 	if !testInfixExpression(t, altexp.Condition, "x", "==", "y") {
@@ -712,6 +997,192 @@ func TestIfElseIfExpression(t *testing.T) {
 	if !testIdentifier(t, altconsequence.Expression, "y") {
 		return
 	}
+
+	if altexp.ElseIf != nil || altexp.Alternative != nil {
+		t.Errorf("else if has an else if or alternative")
+	}
+}
+
+func TestIfElseIfChains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (a) { 1 } else if (b) { 2 }", "ifa 1else ifb 2"},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "ifa 1else ifb 2else 3"},
+		{"if (a) { 1 } else if (b) { 2 } else if (c) { 3 } else { 4 }", "ifa 1else ifb 2else ifc 3else 4"},
+		{"if (a) { 1 } else { if (b) { 2 } }", "ifa 1else ifb 2"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("if (a) { 1 } else if (b) { 2 } else if (c) { 3 } else { 4 }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	ie := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	for _, name := range []string{"a", "b", "c"} {
+		if !testIdentifier(t, ie.Condition, name) {
+			return
+		}
+		if name != "c" {
+			if ie.Alternative != nil {
+				t.Errorf("if (%s) has an alternative", name)
+			}
+			ie = ie.ElseIf
+		}
+	}
+	if ie.ElseIf != nil || ie.Alternative == nil {
+		t.Errorf("last else if has no alternative")
+	}
+
+	p = New(lexer.New("if (a) { 1 } else if { 2 }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected errors for else if without a condition")
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "other" }`, `matchx {1 => one, _ => other}`},
+		{`match (x) { "a" | "b" => 1 }`, `matchx {a | b => 1}`},
+		{`match (x) { -1 => 1, null => 2, true => 3 }`, `matchx {-1 => 1, null => 2, true => 3}`},
+		{`match (x) { [a, b] if a > b => a, [a, ...rest] => rest }`, `matchx {[a, b] if (a > b) => a, [a, ...rest] => rest}`},
+		{`match (x) { {kind: "circle", r} => r }`, `matchx {{kind: circle, r} => r}`},
+		{`match (x) { [{a: [1 | 2]}] => a }`, `matchx {[{a: [1 | 2]}] => a}`},
+		{`match (x) { n => { y := n; y } }`, `matchx {n => y:=ny}`},
+		{`match (x) { 1 => ({"a": 1}), }`, `matchx {1 => {a:1}}`},
+		{"match (x) {\n  1 => 2\n  _ => 3\n}", `matchx {1 => 2, _ => 3}`},
+		{`match (x) {}`, `matchx {}`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.MatchExpression); !ok {
+			t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { x + 1 => 2 }", "expected next token to be =>, got + instead"},
+		{"match (x) { f() => 2 }", "expected next token to be =>, got ( instead"},
+		{"match (x) { [a] | 1 => a }", "alternative patterns cannot bind a"},
+		{"match (x) { {a} | {b: 1} => 1 }", "alternative patterns cannot bind a"},
+		{"match (x) { fn => 1 }", "invalid pattern fn"},
+		{`match (x) { {"a": 1} => 1 }`, "expected next token to be IDENT, got STRING instead"},
+		{"match x { _ => 1 }", "expected next token to be (, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestStructLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }`, `struct Point {x, y}`},
+		{"struct Point {\n  x\n  y\n}", `struct Point {x, y}`},
+		{`struct Empty {}`, `struct Empty {}`},
+		{
+			`struct Point { x, y, fn norm() { self.x * self.x } }`,
+			`struct Point {x, y, fn norm(self) ((self[x]) * (self[x]))}`,
+		},
+		{
+			`struct Point { fn move(dx, dy = 0, ...rest) { dx } }`,
+			`struct Point {fn move(self, dx, dy = 0, ...rest) dx}`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		lit, ok := stmt.Expression.(*ast.StructLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.StructLiteral. got=%T",
+				stmt.Expression)
+		}
+
+		if len(lit.MethodNames) != len(lit.Methods) {
+			t.Errorf("wrong number of method names. want=%d, got=%d",
+				len(lit.Methods), len(lit.MethodNames))
+		}
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, x }", "duplicate field or method x in struct Point"},
+		{"struct Point { x, fn x() {} }", "duplicate field or method x in struct Point"},
+		{"struct Point { 1 }", "expected next token to be IDENT, got INT instead"},
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+		{"struct Point { fn () {} }", "expected next token to be IDENT, got ( instead"},
+		{"struct Point { x", "expected next token to be IDENT, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
 }
 
 func TestFunctionLiteralParsing(t *testing.T) {
@@ -761,6 +1232,53 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionDefinitionParsing(t *testing.T) {
 	assert := assert.New(t)
 
@@ -804,6 +1322,142 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDestructuringParameterParsing(t *testing.T) {
+	input := "fn(x, [a, ...b], {c}) { x }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+
+	expectedParams := []string{"x", "[a, ...b]", "{c}"}
+	if len(function.Parameters) != len(expectedParams) {
+		t.Fatalf("length parameters wrong. want %d, got=%d\n",
+			len(expectedParams), len(function.Parameters))
+	}
+	for i, ident := range expectedParams {
+		testLiteralExpression(t, function.Parameters[i], ident)
+	}
+
+	expectedBody := []string{"[a, ...b]:=[a, ...b]", "{c}:={c}", "x"}
+	if len(function.Body.Statements) != len(expectedBody) {
+		t.Fatalf("function.Body.Statements has wrong length. want %d, got=%d",
+			len(expectedBody), len(function.Body.Statements))
+	}
+	for i, expected := range expectedBody {
+		if got := function.Body.Statements[i].String(); got != expected {
+			t.Errorf("statement %d wrong. want=%q, got=%q", i, expected, got)
+		}
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, a] := xs", "invalid destructuring target 1"},
+		{"[a, ...b, c] := xs", "invalid destructuring target ...b"},
+		{"[a, ...b[0]] := xs", "invalid destructuring target ...(b[0])"},
+		{`fn([a, "b"]) {}`, `invalid destructuring target b`},
+		{"{a, 1} := h", "expected next token to be IDENT, got INT instead"},
+		{"[a, b] += xs", "cannot use += with destructuring pattern [a, b]"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestDefaultAndRestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+	}{
+		{"fn(a, b = 10) {};", []string{"a", "b"}, []string{"10"}, ""},
+		{"fn(a = 1, b = a + 1) {};", []string{"a", "b"}, []string{"1", "(a + 1)"}, ""},
+		{"fn(...rest) {};", []string{}, []string{}, "rest"},
+		{"fn(a, b = 10, ...rest) {};", []string{"a", "b"}, []string{"10"}, "rest"},
+		{"fn([a, b] = [1, 2]) {};", []string{"[a, b]"}, []string{"[1, 2]"}, ""},
+		{"fn(a = fn(b) { b }, b = fn() { c := 1; c }, c = 1) {};", []string{"a", "b", "c"},
+			[]string{"fn (b) b", "fn () c:=1c", "1"}, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		if len(function.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("length defaults wrong. want %d, got=%d\n",
+				len(tt.expectedDefaults), len(function.Defaults))
+		}
+		for i, expected := range tt.expectedDefaults {
+			if got := function.Defaults[i].String(); got != expected {
+				t.Errorf("default %d wrong. want=%q, got=%q", i, expected, got)
+			}
+		}
+
+		if tt.expectedRest == "" {
+			if function.Rest != nil {
+				t.Errorf("function.Rest is not nil. got=%s", function.Rest)
+			}
+		} else {
+			testIdentifier(t, function.Rest, tt.expectedRest)
+		}
+	}
+}
+
+func TestDefaultAndRestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {}", "parameter b without a default follows a parameter with a default"},
+		{"fn(...a, b) {}", "rest parameter ...a must be the last parameter"},
+		{"fn(...[a]) {}", "expected next token to be IDENT, got [ instead"},
+		{"fn(a, b = c, c = 3) {}", "default of parameter b refers to parameter c which is not yet bound"},
+		{"fn(a, b = b) {}", "default of parameter b refers to parameter b which is not yet bound"},
+		{"fn(a = [rest], ...rest) {}", "default of parameter a refers to parameter rest which is not yet bound"},
+		{"fn([x], y = x) {}", "default of parameter y refers to parameter x which is not yet bound"},
+		{"fn(a = fn() { b }, b = 1) {}", "default of parameter a refers to parameter b which is not yet bound"},
+		{"macro(a = 1) {}", "macro parameters cannot have defaults or a rest parameter"},
+		{"macro(...a) {}", "macro parameters cannot have defaults or a rest parameter"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -863,6 +1517,11 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 			expectedIdent: "add",
 			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
 		},
+		{
+			input:         "add(1, ...xs, ...[2, 3]);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "...xs", "...[2, 3]"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1050,6 +1709,66 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteralExpression(t *testing.T) {
+	input := `"x=${x}, sum=${a + b}";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	template, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(template.Parts) != 4 {
+		t.Fatalf("template.Parts has not 4 parts. got=%d", len(template.Parts))
+	}
+
+	testStringLiteral := func(exp ast.Expression, value string) {
+		literal, ok := exp.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StringLiteral. got=%T", exp)
+		}
+		if literal.Value != value {
+			t.Errorf("literal.Value not %q. got=%q", value, literal.Value)
+		}
+	}
+
+	testStringLiteral(template.Parts[0], "x=")
+	testIdentifier(t, template.Parts[1], "x")
+	testStringLiteral(template.Parts[2], ", sum=")
+	testInfixExpression(t, template.Parts[3], "a", "+", "b")
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${}"`, "empty expression in string interpolation"},
+		{`"${1 2}"`, "unexpected INT in string interpolation"},
+		{`"${)}"`, "no prefix parse function for ) found"},
+		{`"${x`, "unterminated string interpolation at line 1, column 1"},
+		{`x := "\u{110000}"`, `invalid code point "110000" in \u{...} escape at line 1, column 6`},
+		{"x := \"\"\"\n  ${x\n  \"\"\"", "unterminated string interpolation at line 1, column 6"},
+		{`"""\xZZ"""`, `invalid \x escape "ZZ" at line 1, column 1`},
+		{`@`, "no prefix parse function for ILLEGAL found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -1129,6 +1848,56 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		start interface{}
+		end   interface{}
+	}{
+		{"xs[1:3]", 1, 3},
+		{"xs[:3]", nil, 3},
+		{"xs[1:]", 1, nil},
+		{"xs[:]", nil, nil},
+		{"xs[a:b]", "a", "b"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "xs") {
+			return
+		}
+
+		for _, bound := range []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{sliceExp.Start, tt.start}, {sliceExp.End, tt.end}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("bound is not nil. got=%s", bound.exp)
+				}
+				continue
+			}
+			if !testLiteralExpression(t, bound.exp, bound.expected) {
+				return
+			}
+		}
+
+		if sliceExp.String() != "("+tt.input+")" {
+			t.Errorf("sliceExp.String() wrong. got=%q", sliceExp.String())
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -1163,6 +1932,12 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	for i, key := range []string{"one", "two", "three"} {
+		if hash.Keys[i].String() != key {
+			t.Errorf("hash.Keys[%d] is not %q. got=%q", i, key, hash.Keys[i].String())
+		}
+	}
 }
 
 func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
@@ -1302,3 +2077,18 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func FuzzParseProgram(f *testing.F) {
+	f.Add(`x := 5; f := fn(a, b) { a + b }; f(1, 2)`)
+	f.Add(`if (x > 1) { x } else if (x < 0) { -x } else { 0 }`)
+	f.Add(`while (i < 10) { xs[i] = h.a; i = i + 1 }`)
+	f.Add(`{"a": [1, 2], true: fn() { return }}`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
@@ -5,13 +5,16 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 
+	"github.com/prologic/monkey-lang/ast"
 	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/cover"
 	"github.com/prologic/monkey-lang/eval"
 	"github.com/prologic/monkey-lang/lexer"
 	"github.com/prologic/monkey-lang/object"
@@ -41,6 +44,7 @@ type Options struct {
 	Debug       bool
 	Engine      string
 	Interactive bool
+	Cover       string
 }
 
 type VMState struct {
@@ -66,10 +70,34 @@ type REPL struct {
 	user string
 	args []string
 	opts *Options
+
+	coverage cover.Counts
+
+	// macros holds the macros defined by all programs run so far
+	macros *object.Environment
 }
 
 func New(user string, args []string, opts *Options) *REPL {
-	return &REPL{user, args, opts}
+	return &REPL{
+		user:   user,
+		args:   args,
+		opts:   opts,
+		macros: object.NewEnvironment(),
+	}
+}
+
+// expandMacros defines the macros of program and expands all macro calls
+// within it, any errors are printed to stderr
+func (r *REPL) expandMacros(program *ast.Program) (*ast.Program, bool) {
+	eval.DefineMacros(program, r.macros)
+
+	expanded, err := eval.ExpandMacros(program, r.macros)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Macro expansion failed:\n %s\n", err)
+		return nil, false
+	}
+
+	return expanded.(*ast.Program), true
 }
 
 // Eval parses and evalulates the program given by f and returns the resulting
@@ -92,7 +120,18 @@ func (r *REPL) Eval(f io.Reader) (env *object.Environment) {
 		return
 	}
 
-	eval.Eval(program, env)
+	program, ok := r.expandMacros(program)
+	if !ok {
+		return
+	}
+
+	eval.Coverage = r.coverage
+	obj := eval.Eval(program, env)
+	eval.Coverage = nil
+
+	if err, ok := obj.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "Woops! Evaluation failed:\n %s\n", err.Message)
+	}
 	return
 }
 
@@ -116,6 +155,11 @@ func (r *REPL) Exec(f io.Reader) (state *VMState) {
 		return
 	}
 
+	program, ok := r.expandMacros(program)
+	if !ok {
+		return
+	}
+
 	c := compiler.NewWithState(state.symbols, state.constants)
 	c.Debug = r.opts.Debug
 	err = c.Compile(program)
@@ -129,6 +173,7 @@ func (r *REPL) Exec(f io.Reader) (state *VMState) {
 
 	machine := vm.NewWithGlobalsStore(code, state.globals)
 	machine.Debug = r.opts.Debug
+	machine.Coverage = r.coverage
 	err = machine.Run()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Woops! Executing bytecode failed:\n %s\n", err)
@@ -164,6 +209,11 @@ func (r *REPL) StartEvalLoop(in io.Reader, out io.Writer, env *object.Environmen
 			continue
 		}
 
+		program, ok := r.expandMacros(program)
+		if !ok {
+			continue
+		}
+
 		obj := eval.Eval(program, env)
 		if obj != nil {
 			if _, ok := obj.(*object.Null); !ok {
@@ -200,6 +250,11 @@ func (r *REPL) StartExecLoop(in io.Reader, out io.Writer, state *VMState) {
 			continue
 		}
 
+		program, ok := r.expandMacros(program)
+		if !ok {
+			continue
+		}
+
 		c := compiler.NewWithState(state.symbols, state.constants)
 		c.Debug = r.opts.Debug
 		err := c.Compile(program)
@@ -220,25 +275,71 @@ func (r *REPL) StartExecLoop(in io.Reader, out io.Writer, state *VMState) {
 		}
 
 		obj := machine.LastPopped()
-		if _, ok := obj.(*object.Null); !ok {
-			io.WriteString(out, obj.Inspect())
-			io.WriteString(out, "\n")
+		if obj != nil {
+			if _, ok := obj.(*object.Null); !ok {
+				io.WriteString(out, obj.Inspect())
+				io.WriteString(out, "\n")
+			}
 		}
 	}
 }
 
+// saveCoverage adds the coverage recorded for the program in filename with
+// source src to the coverage profile given by the -cover option, writes the
+// profile and prints a summary to stderr
+func (r *REPL) saveCoverage(filename string, src []byte) {
+	profile, err := cover.ReadFile(r.opts.Cover)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading coverage profile: %s\n", err)
+		return
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return
+	}
+
+	profile.Add(filename, cover.Blocks(program, string(src)), r.coverage)
+
+	if err := profile.WriteFile(r.opts.Cover); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing coverage profile: %s\n", err)
+		return
+	}
+
+	profile.WriteSummary(os.Stderr)
+}
+
 func (r *REPL) Run() {
 	if len(r.args) == 1 {
-		f, err := os.Open(r.args[0])
+		src, err := ioutil.ReadFile(r.args[0])
 		if err != nil {
 			log.Fatalf("could not open source file %s: %s", r.args[0], err)
 		}
+		f := bytes.NewReader(src)
+
+		if r.opts.Cover != "" {
+			r.coverage = cover.Counts{}
+
+			// Make sure coverage is saved if the program calls exit()
+			exit := object.ExitFunction
+			object.ExitFunction = func(status int) {
+				r.saveCoverage(r.args[0], src)
+				exit(status)
+			}
+			defer r.saveCoverage(r.args[0], src)
+		}
 
 		if r.opts.Engine == "eval" {
 			env := r.Eval(f)
 			if r.opts.Interactive {
 				r.StartEvalLoop(os.Stdin, os.Stdout, env)
 			}
+		} else if r.opts.Engine == "rvm" {
+			state := r.ExecRVM(f)
+			if r.opts.Interactive {
+				r.StartRVMLoop(os.Stdin, os.Stdout, state)
+			}
 		} else {
 			state := r.Exec(f)
 			if r.opts.Interactive {
@@ -250,6 +351,8 @@ func (r *REPL) Run() {
 		fmt.Printf("Feel free to type in commands\n")
 		if r.opts.Engine == "eval" {
 			r.StartEvalLoop(os.Stdin, os.Stdout, nil)
+		} else if r.opts.Engine == "rvm" {
+			r.StartRVMLoop(os.Stdin, os.Stdout, nil)
 		} else {
 			r.StartExecLoop(os.Stdin, os.Stdout, nil)
 		}
@@ -0,0 +1,141 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+	"github.com/prologic/monkey-lang/rvm"
+)
+
+type RVMState struct {
+	constants []object.Object
+	globals   []object.Object
+	symbols   *rvm.SymbolTable
+}
+
+func NewRVMState() *RVMState {
+	symbolTable := rvm.NewSymbolTable()
+	for i, builtin := range object.BuiltinsIndex {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+
+	return &RVMState{
+		constants: []object.Object{},
+		globals:   make([]object.Object, rvm.MaxGlobals),
+		symbols:   symbolTable,
+	}
+}
+
+// ExecRVM parses, compiles and executes the program given by f with the
+// register based virtual machine and returns its resulting state, any errors
+// are printed to stderr
+func (r *REPL) ExecRVM(f io.Reader) (state *RVMState) {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading source file: %s", err)
+		return
+	}
+
+	state = NewRVMState()
+
+	l := lexer.New(string(b))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(os.Stderr, p.Errors())
+		return
+	}
+
+	program, ok := r.expandMacros(program)
+	if !ok {
+		return
+	}
+
+	c := rvm.NewCompilerWithState(state.symbols, state.constants)
+	c.Debug = r.opts.Debug
+	err = c.Compile(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Compilation failed:\n %s\n", err)
+		return
+	}
+
+	code := c.Bytecode()
+	state.constants = code.Constants
+
+	machine := rvm.NewWithGlobalsStore(code, state.globals)
+	machine.Debug = r.opts.Debug
+	machine.Coverage = r.coverage
+	err = machine.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Executing bytecode failed:\n %s\n", err)
+		return
+	}
+
+	return
+}
+
+// StartRVMLoop starts the REPL in a continious exec loop using the register
+// based virtual machine
+func (r *REPL) StartRVMLoop(in io.Reader, out io.Writer, state *RVMState) {
+	scanner := bufio.NewScanner(in)
+
+	if state == nil {
+		state = NewRVMState()
+	}
+
+	for {
+		fmt.Printf(PROMPT)
+		scanned := scanner.Scan()
+		if !scanned {
+			return
+		}
+
+		line := scanner.Text()
+
+		l := lexer.New(line)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			continue
+		}
+
+		program, ok := r.expandMacros(program)
+		if !ok {
+			continue
+		}
+
+		c := rvm.NewCompilerWithState(state.symbols, state.constants)
+		c.Debug = r.opts.Debug
+		err := c.Compile(program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Woops! Compilation failed:\n %s\n", err)
+			return
+		}
+
+		code := c.Bytecode()
+		state.constants = code.Constants
+
+		machine := rvm.NewWithGlobalsStore(code, state.globals)
+		machine.Debug = r.opts.Debug
+		err = machine.Run()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Woops! Executing bytecode failed:\n %s\n", err)
+			return
+		}
+
+		obj := machine.Result()
+		if _, ok := obj.(*object.Null); !ok {
+			io.WriteString(out, obj.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
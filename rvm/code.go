@@ -0,0 +1,236 @@
+package rvm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Opcode is the operation of a single register machine instruction
+type Opcode byte
+
+// Instruction is a single register machine instruction. The meaning of the
+// operands A, B and C depends on the opcode, see the list of opcodes below
+// where R(x) is register x of the current frame, K(x) is constant x, G(x)
+// global x and RK(x) is R(x) if x >= 0 and K(-1-x) otherwise.
+type Instruction struct {
+	Op      Opcode
+	A, B, C int
+}
+
+const (
+	// Move          A B      R(A) = R(B)
+	Move Opcode = iota
+	// LoadConstant  A B      R(A) = K(B)
+	LoadConstant
+	// LoadNull      A        R(A) = null
+	LoadNull
+	// LoadBoolean   A B      R(A) = B != 0
+	LoadBoolean
+	// LoadGlobal    A B      R(A) = G(B)
+	LoadGlobal
+	// StoreGlobal   A B      G(A) = RK(B)
+	StoreGlobal
+	// LoadBuiltin   A B      R(A) = builtin B
+	LoadBuiltin
+	// LoadFree      A B      R(A) = free variable B of the current closure
+	LoadFree
+	// StoreFree     A B      free variable A of the current closure = RK(B)
+	StoreFree
+	// LoadSelf      A        R(A) = the current closure
+	LoadSelf
+
+	// Add .. GreaterThanEqual  A B C   R(A) = RK(B) op RK(C)
+	Add
+	Sub
+	Mul
+	Div
+	Mod
+	BitwiseOR
+	BitwiseXOR
+	BitwiseAND
+	LeftShift
+	RightShift
+	Pow
+	Or
+	And
+	Equal
+	NotEqual
+	GreaterThan
+	GreaterThanEqual
+
+	// Minus         A B      R(A) = -RK(B)
+	Minus
+	// Not           A B      R(A) = !RK(B)
+	Not
+	// BitwiseNOT    A B      R(A) = ~RK(B)
+	BitwiseNOT
+
+	// GetItem       A B C    R(A) = RK(B)[RK(C)]
+	GetItem
+	// GetSlice      A B C    R(A) = RK(B)[R(C):R(C+1)]
+	GetSlice
+	// SetItem       A B C    R(A)[RK(B)] = RK(C)
+	SetItem
+	// MakeArray     A B C    R(A) = [R(B), ..., R(B+C-1)]
+	MakeArray
+	// MakeHash      A B C    R(A) = {R(B): R(B+1), ..., R(B+C-2): R(B+C-1)}
+	MakeHash
+	// BuildString   A B C    R(A) = str(R(B)) + ... + str(R(B+C-1))
+	BuildString
+	// ExtendArray   A B      R(A) = R(A) + R(B)
+	ExtendArray
+	// UnpackArray   A B C    R(A), ..., R(A+C-1) = R(B)[0], ..., R(B)[C-1]
+	UnpackArray
+	// UnpackRest    A B C    R(A), ..., R(A+C-2) = R(B)[0], ..., R(B)[C-2]
+	//                        R(A+C-1) = R(B)[C-1:]
+	UnpackRest
+	// UnpackHash    A B C    R(A), ..., R(A+C-1) = R(B)[R(A)], ..., R(B)[R(A+C-1)]
+	UnpackHash
+	// MatchValue    A B C    R(A) = R(B) matches the literal RK(C)
+	MatchValue
+	// MatchArray    A B C    R(A) = R(B) is an array of length C
+	MatchArray
+	// MatchRest     A B C    R(A) = R(B) is an array of length at least C
+	MatchRest
+	// MatchHash     A B C    R(A) = R(B) is a hash with the keys R(A), ..., R(A+C-1)
+	MatchHash
+	// MakeClosure   A B C    R(A) = closure of K(B) with free variables
+	//                        R(C), ..., R(C+n-1)
+	MakeClosure
+	// MakeStruct    A B      R(A) = new struct of K(B)
+	MakeStruct
+	// DefineMethods A B C    methods of R(A) = {R(B): R(B+1), ...,
+	//                        R(B+2C-2): R(B+2C-1)}
+	DefineMethods
+
+	// Jump          A        pc = A
+	Jump
+	// JumpIfFalse   A B      if !R(A) { pc = B }
+	JumpIfFalse
+
+	// Call          A B C    R(A) = R(B)(R(B+1), ..., R(B+C))
+	Call
+	// CallSpread    A B      R(A) = R(B)(...R(B+1))
+	CallSpread
+	// TailCall      A B C    return R(B)(R(B+1), ..., R(B+C))
+	TailCall
+	// Return        A        return RK(A)
+	Return
+	// SetResult     A        result = RK(A)
+	SetResult
+)
+
+// Definition holds the name of an opcode and the number of its operands
+type Definition struct {
+	Name     string
+	Operands int
+}
+
+var definitions = map[Opcode]*Definition{
+	Move:             {"Move", 2},
+	LoadConstant:     {"LoadConstant", 2},
+	LoadNull:         {"LoadNull", 1},
+	LoadBoolean:      {"LoadBoolean", 2},
+	LoadGlobal:       {"LoadGlobal", 2},
+	StoreGlobal:      {"StoreGlobal", 2},
+	LoadBuiltin:      {"LoadBuiltin", 2},
+	LoadFree:         {"LoadFree", 2},
+	StoreFree:        {"StoreFree", 2},
+	LoadSelf:         {"LoadSelf", 1},
+	Add:              {"Add", 3},
+	Sub:              {"Sub", 3},
+	Mul:              {"Mul", 3},
+	Div:              {"Div", 3},
+	Mod:              {"Mod", 3},
+	BitwiseOR:        {"BitwiseOR", 3},
+	BitwiseXOR:       {"BitwiseXOR", 3},
+	BitwiseAND:       {"BitwiseAND", 3},
+	LeftShift:        {"LeftShift", 3},
+	RightShift:       {"RightShift", 3},
+	Pow:              {"Pow", 3},
+	Or:               {"Or", 3},
+	And:              {"And", 3},
+	Equal:            {"Equal", 3},
+	NotEqual:         {"NotEqual", 3},
+	GreaterThan:      {"GreaterThan", 3},
+	GreaterThanEqual: {"GreaterThanEqual", 3},
+	Minus:            {"Minus", 2},
+	Not:              {"Not", 2},
+	BitwiseNOT:       {"BitwiseNOT", 2},
+	GetItem:          {"GetItem", 3},
+	GetSlice:         {"GetSlice", 3},
+	SetItem:          {"SetItem", 3},
+	MakeArray:        {"MakeArray", 3},
+	BuildString:      {"BuildString", 3},
+	MakeHash:         {"MakeHash", 3},
+	ExtendArray:      {"ExtendArray", 2},
+	UnpackArray:      {"UnpackArray", 3},
+	UnpackRest:       {"UnpackRest", 3},
+	UnpackHash:       {"UnpackHash", 3},
+	MatchValue:       {"MatchValue", 3},
+	MatchArray:       {"MatchArray", 3},
+	MatchRest:        {"MatchRest", 3},
+	MatchHash:        {"MatchHash", 3},
+	MakeClosure:      {"MakeClosure", 3},
+	MakeStruct:       {"MakeStruct", 2},
+	DefineMethods:    {"DefineMethods", 3},
+	Jump:             {"Jump", 1},
+	JumpIfFalse:      {"JumpIfFalse", 2},
+	Call:             {"Call", 3},
+	CallSpread:       {"CallSpread", 2},
+	TailCall:         {"TailCall", 3},
+	Return:           {"Return", 1},
+	SetResult:        {"SetResult", 1},
+}
+
+// Lookup returns the definition of op
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func (o Opcode) String() string {
+	def, err := Lookup(o)
+	if err != nil {
+		return ""
+	}
+	return def.Name
+}
+
+func (ins Instruction) String() string {
+	def, err := Lookup(ins.Op)
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+
+	switch def.Operands {
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, ins.A)
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, ins.A, ins.B)
+	default:
+		return fmt.Sprintf("%s %d %d %d", def.Name, ins.A, ins.B, ins.C)
+	}
+}
+
+// Instructions is a sequence of register machine instructions
+type Instructions []Instruction
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i, in := range ins {
+		fmt.Fprintf(&out, "%04d %s\n", i, in)
+	}
+
+	return out.String()
+}
+
+// rk returns the RK operand encoding constant index i
+func rk(i int) int {
+	return -1 - i
+}
@@ -0,0 +1,1335 @@
+// Package rvm implements an alternative register based backend to the
+// stack based compiler and virtual machine (see packages compiler and vm).
+// The compiler in this package translates the AST into instructions which
+// operate on the registers of the current function's frame (its parameters,
+// local bindings and temporaries) instead of pushing and popping every
+// operand to and from a stack.
+package rvm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/object"
+)
+
+// noRegister is used as the destination of expressions whose value is not
+// used
+const noRegister = -1
+
+// scope holds the state of the function being compiled
+type scope struct {
+	fn *Function
+
+	next  int // next free register
+	floor int // registers below floor hold local bindings
+}
+
+type Compiler struct {
+	Debug bool
+
+	constants []object.Object
+	integers  map[int64]int
+	strings   map[string]int
+
+	scopes []*scope
+
+	symbolTable *SymbolTable
+}
+
+func NewCompiler() *Compiler {
+	symbolTable := NewSymbolTable()
+
+	for i, builtin := range object.BuiltinsIndex {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+
+	return &Compiler{
+		constants: []object.Object{},
+		integers:  make(map[int64]int),
+		strings:   make(map[string]int),
+
+		scopes: []*scope{{fn: &Function{Lines: map[int]int{}}}},
+
+		symbolTable: symbolTable,
+	}
+}
+
+func NewCompilerWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	c := NewCompiler()
+	c.symbolTable = symbolTable
+	c.constants = constants
+	return c
+}
+
+// Bytecode holds the compiled main function of a program and its constants
+type Bytecode struct {
+	Main      *Function
+	Constants []object.Object
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Main:      c.scopes[0].fn,
+		Constants: c.constants,
+	}
+}
+
+func (c *Compiler) scope() *scope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) enterScope(name string) {
+	c.scopes = append(c.scopes, &scope{fn: &Function{Name: name, Lines: map[int]int{}}})
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (*Function, []Symbol) {
+	fn := c.scope().fn
+	free := c.symbolTable.FreeSymbols
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+
+	return fn, free
+}
+
+// allocate allocates n consecutive temporary registers and returns the first
+func (c *Compiler) allocate(n int) int {
+	s := c.scope()
+	r := s.next
+	s.next += n
+	if s.next > s.fn.NumRegisters {
+		s.fn.NumRegisters = s.next
+	}
+	return r
+}
+
+// allocateLocal allocates a register for a local binding which is never
+// freed
+func (c *Compiler) allocateLocal() int {
+	r := c.allocate(1)
+	c.scope().floor = c.scope().next
+	return r
+}
+
+// top returns the next free register, to be passed to free once the
+// temporaries allocated after it are no longer needed
+func (c *Compiler) top() int {
+	return c.scope().next
+}
+
+// free frees all temporary registers from r upwards
+func (c *Compiler) free(r int) {
+	s := c.scope()
+	s.next = maxInt(r, s.floor)
+}
+
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	ins := Instruction{Op: op}
+	switch len(operands) {
+	case 3:
+		ins.C = operands[2]
+		fallthrough
+	case 2:
+		ins.B = operands[1]
+		fallthrough
+	case 1:
+		ins.A = operands[0]
+	}
+
+	fn := c.scope().fn
+	fn.Instructions = append(fn.Instructions, ins)
+	return len(fn.Instructions) - 1
+}
+
+// position returns the position of the next instruction to be emitted
+func (c *Compiler) position() int {
+	return len(c.scope().fn.Instructions)
+}
+
+// mark records that the next instruction emitted starts a statement on the
+// given source line
+func (c *Compiler) mark(line int) {
+	c.scope().fn.Lines[c.position()] = line
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) integer(value int64) int {
+	if i, ok := c.integers[value]; ok {
+		return i
+	}
+	i := c.addConstant(&object.Integer{Value: value})
+	c.integers[value] = i
+	return i
+}
+
+// integerLiteral returns the index of the constant holding the value of lit
+func (c *Compiler) integerLiteral(lit *ast.IntegerLiteral) int {
+	if lit.Big != nil {
+		return c.addConstant(&object.BigInteger{Value: lit.Big})
+	}
+	return c.integer(lit.Value)
+}
+
+func (c *Compiler) string(value string) int {
+	if i, ok := c.strings[value]; ok {
+		return i
+	}
+	i := c.addConstant(&object.String{Value: value})
+	c.strings[value] = i
+	return i
+}
+
+// inFunction returns true if a function body (not the program) is being
+// compiled
+func (c *Compiler) inFunction() bool {
+	return len(c.scopes) > 1
+}
+
+// Compile compiles the program. The value of each top-level expression
+// statement is recorded as the result of the program.
+func (c *Compiler) Compile(program *ast.Program) error {
+	for _, s := range program.Statements {
+		if err := c.statement(s, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) statement(s ast.Statement, result bool) error {
+	if c.Debug {
+		log.Printf("Compiling %T: %s\n", s, s.String())
+	}
+
+	top := c.top()
+	defer c.free(top)
+
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		c.mark(s.Token.Line)
+
+		if !result {
+			return c.expressionTo(s.Expression, noRegister)
+		}
+
+		operand, err := c.expression(s.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(SetResult, operand)
+
+	case *ast.ReturnStatement:
+		c.mark(s.Token.Line)
+		return c.returnStatement(s.ReturnValue)
+
+	case *ast.Comment:
+
+	default:
+		return fmt.Errorf("unknown statement %T", s)
+	}
+
+	return nil
+}
+
+func (c *Compiler) returnStatement(value ast.Expression) error {
+	if value == nil {
+		r := c.allocate(1)
+		c.emit(LoadNull, r)
+		c.emit(Return, r)
+		return nil
+	}
+
+	if call, ok := value.(*ast.CallExpression); ok && c.inFunction() &&
+		!hasSpread(call.Arguments) {
+		base, err := c.callArguments(call)
+		if err != nil {
+			return err
+		}
+		c.emit(TailCall, base, base, len(call.Arguments))
+		return nil
+	}
+
+	operand, err := c.expression(value)
+	if err != nil {
+		return err
+	}
+	c.emit(Return, operand)
+	return nil
+}
+
+// statements returns the statements of block without comments
+func statements(block *ast.BlockStatement) []ast.Statement {
+	var statements []ast.Statement
+	for _, s := range block.Statements {
+		if _, ok := s.(*ast.Comment); !ok {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+// block compiles the statements of block storing the value of its last
+// expression statement (or null) in dst
+func (c *Compiler) block(block *ast.BlockStatement, dst int) error {
+	stmts := statements(block)
+	n := len(stmts)
+
+	for i, s := range stmts {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == n-1 {
+			c.mark(es.Token.Line)
+			return c.expressionTo(es.Expression, dst)
+		}
+
+		if err := c.statement(s, false); err != nil {
+			return err
+		}
+	}
+
+	if dst != noRegister {
+		c.emit(LoadNull, dst)
+	}
+	return nil
+}
+
+// expression compiles node and returns the RK operand holding its value,
+// either a register or a constant
+func (c *Compiler) expression(node ast.Expression) (int, error) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return rk(c.integerLiteral(node)), nil
+
+	case *ast.StringLiteral:
+		return rk(c.string(node.Value)), nil
+
+	default:
+		return c.register(node)
+	}
+}
+
+// register compiles node and returns the register holding its value
+func (c *Compiler) register(node ast.Expression) (int, error) {
+	if value, ok := node.(*registerValue); ok {
+		return value.r, nil
+	}
+
+	if ident, ok := node.(*ast.Identifier); ok {
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if ok && symbol.Scope == LocalScope {
+			return symbol.Index, nil
+		}
+	}
+
+	r := c.allocate(1)
+	return r, c.expressionTo(node, r)
+}
+
+func (c *Compiler) load(symbol Symbol, dst int) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(LoadGlobal, dst, symbol.Index)
+	case LocalScope:
+		if dst != symbol.Index {
+			c.emit(Move, dst, symbol.Index)
+		}
+	case BuiltinScope:
+		c.emit(LoadBuiltin, dst, symbol.Index)
+	case FreeScope:
+		c.emit(LoadFree, dst, symbol.Index)
+	case SelfScope:
+		c.emit(LoadSelf, dst)
+	}
+}
+
+var binaryOperators = map[string]Opcode{
+	"+":  Add,
+	"-":  Sub,
+	"*":  Mul,
+	"/":  Div,
+	"%":  Mod,
+	"|":  BitwiseOR,
+	"^":  BitwiseXOR,
+	"&":  BitwiseAND,
+	"<<": LeftShift,
+	">>": RightShift,
+	"**": Pow,
+	"||": Or,
+	"&&": And,
+	">":  GreaterThan,
+	">=": GreaterThanEqual,
+	"==": Equal,
+	"!=": NotEqual,
+}
+
+var unaryOperators = map[string]Opcode{
+	"!": Not,
+	"~": BitwiseNOT,
+	"-": Minus,
+}
+
+// expressionTo compiles node storing its value in the register dst. If dst
+// is noRegister the value is discarded.
+func (c *Compiler) expressionTo(node ast.Expression, dst int) error {
+	if c.Debug {
+		log.Printf("Compiling %T: %s\n", node, node.String())
+	}
+
+	top := c.top()
+	defer c.free(top)
+
+	// target returns dst or, if the value is discarded but must be computed
+	// for its side effects, a temporary register
+	target := func() int {
+		if dst == noRegister {
+			return c.allocate(1)
+		}
+		return dst
+	}
+
+	switch node := node.(type) {
+
+	case *ast.IntegerLiteral:
+		if dst != noRegister {
+			c.emit(LoadConstant, dst, c.integerLiteral(node))
+		}
+
+	case *ast.StringLiteral:
+		if dst != noRegister {
+			c.emit(LoadConstant, dst, c.string(node.Value))
+		}
+
+	case *ast.Boolean:
+		if dst != noRegister {
+			value := 0
+			if node.Value {
+				value = 1
+			}
+			c.emit(LoadBoolean, dst, value)
+		}
+
+	case *ast.Null:
+		if dst != noRegister {
+			c.emit(LoadNull, dst)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		if dst != noRegister {
+			c.load(symbol, dst)
+		}
+
+	case *registerValue:
+		if dst != noRegister && dst != node.r {
+			c.emit(Move, dst, node.r)
+		}
+
+	case *ast.PrefixExpression:
+		op, ok := unaryOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+		right, err := c.expression(node.Right)
+		if err != nil {
+			return err
+		}
+
+		c.emit(op, target(), right)
+
+	case *ast.InfixExpression:
+		// a < b is compiled as b > a (evaluating b first like the stack
+		// based compiler does)
+		if node.Operator == "<" || node.Operator == "<=" {
+			right, err := c.expression(node.Right)
+			if err != nil {
+				return err
+			}
+			left, err := c.expression(node.Left)
+			if err != nil {
+				return err
+			}
+
+			op := GreaterThan
+			if node.Operator == "<=" {
+				op = GreaterThanEqual
+			}
+			c.emit(op, target(), right, left)
+			return nil
+		}
+
+		op, ok := binaryOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+		left, err := c.expression(node.Left)
+		if err != nil {
+			return err
+		}
+		right, err := c.expression(node.Right)
+		if err != nil {
+			return err
+		}
+
+		c.emit(op, target(), left, right)
+
+	case *ast.IndexExpression:
+		left, err := c.expression(node.Left)
+		if err != nil {
+			return err
+		}
+		index, err := c.expression(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(GetItem, target(), left, index)
+
+	case *ast.SliceExpression:
+		left, err := c.expression(node.Left)
+		if err != nil {
+			return err
+		}
+		base := c.allocate(2)
+		for i, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(LoadNull, base+i)
+				continue
+			}
+			if err := c.expressionTo(bound, base+i); err != nil {
+				return err
+			}
+		}
+
+		c.emit(GetSlice, target(), left, base)
+
+	case *ast.ArrayLiteral:
+		base := c.allocate(len(node.Elements))
+		for i, el := range node.Elements {
+			if err := c.expressionTo(el, base+i); err != nil {
+				return err
+			}
+		}
+
+		c.emit(MakeArray, target(), base, len(node.Elements))
+
+	case *ast.TemplateLiteral:
+		base := c.allocate(len(node.Parts))
+		for i, part := range node.Parts {
+			if err := c.expressionTo(part, base+i); err != nil {
+				return err
+			}
+		}
+
+		c.emit(BuildString, target(), base, len(node.Parts))
+
+	case *ast.HashLiteral:
+		keys := node.Keys
+		base := c.allocate(len(keys) * 2)
+		for i, k := range keys {
+			if err := c.expressionTo(k, base+2*i); err != nil {
+				return err
+			}
+			if err := c.expressionTo(node.Pairs[k], base+2*i+1); err != nil {
+				return err
+			}
+		}
+
+		c.emit(MakeHash, target(), base, len(keys)*2)
+
+	case *ast.BindExpression:
+		switch left := node.Left.(type) {
+		case *ast.Identifier:
+			bind := c.bind
+			if node.Const {
+				bind = c.bindConst
+			}
+			if err := bind(left.Value, node.Value); err != nil {
+				return err
+			}
+		case *ast.ArrayPattern, *ast.HashPattern:
+			value, err := c.register(node.Value)
+			if err != nil {
+				return err
+			}
+			mode := destructureBind
+			if node.Parameter {
+				mode = destructureDefine
+			}
+			if err := c.destructure(left, value, mode); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("expected identifier got=%s", node.Left)
+		}
+
+		if dst != noRegister {
+			c.emit(LoadNull, dst)
+		}
+
+	case *ast.AssignmentExpression:
+		if node.Operator != "" {
+			if err := c.compoundAssign(node); err != nil {
+				return err
+			}
+		} else if err := c.assign(node.Left, node.Value); err != nil {
+			return err
+		}
+
+		if dst != noRegister {
+			c.emit(LoadNull, dst)
+		}
+
+	case *ast.IfExpression:
+		return c.ifExpression(node, dst)
+
+	case *ast.MatchExpression:
+		return c.match(node, dst)
+
+	case *ast.WhileExpression:
+		start := c.position()
+
+		condition, err := c.register(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpIfFalse := c.emit(JumpIfFalse, condition, 0)
+		c.free(top)
+
+		if err := c.block(node.Consequence, noRegister); err != nil {
+			return err
+		}
+
+		c.emit(Jump, start)
+		c.patch(jumpIfFalse)
+
+		if dst != noRegister {
+			c.emit(LoadNull, dst)
+		}
+
+	case *ast.FunctionLiteral:
+		return c.function(node, dst)
+
+	case *ast.CallExpression:
+		if hasSpread(node.Arguments) {
+			base := c.allocate(2)
+			if err := c.expressionTo(node.Function, base); err != nil {
+				return err
+			}
+			if err := c.spreadArguments(node.Arguments, base+1); err != nil {
+				return err
+			}
+
+			if dst == noRegister {
+				dst = base
+			}
+			c.emit(CallSpread, dst, base)
+			return nil
+		}
+
+		base, err := c.callArguments(node)
+		if err != nil {
+			return err
+		}
+
+		if dst == noRegister {
+			dst = base
+		}
+		c.emit(Call, dst, base, len(node.Arguments))
+
+	case *ast.StructLiteral:
+		if err := c.structLiteral(node); err != nil {
+			return err
+		}
+
+		if dst != noRegister {
+			c.emit(LoadNull, dst)
+		}
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals must be bound to a name at the top level")
+
+	default:
+		return fmt.Errorf("unsupported expression %T", node)
+	}
+
+	return nil
+}
+
+// patch changes the jump target of the jump instruction at pos to the
+// position of the next instruction to be emitted
+func (c *Compiler) patch(pos int) {
+	ins := &c.scope().fn.Instructions[pos]
+	switch ins.Op {
+	case Jump:
+		ins.A = c.position()
+	case JumpIfFalse:
+		ins.B = c.position()
+	}
+}
+
+// callArguments compiles the function and arguments of a call into
+// consecutive registers and returns the first
+func (c *Compiler) callArguments(call *ast.CallExpression) (int, error) {
+	base := c.allocate(1 + len(call.Arguments))
+
+	if err := c.expressionTo(call.Function, base); err != nil {
+		return 0, err
+	}
+
+	for i, arg := range call.Arguments {
+		if err := c.expressionTo(arg, base+1+i); err != nil {
+			return 0, err
+		}
+	}
+
+	return base, nil
+}
+
+func hasSpread(args []ast.Expression) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// spreadArguments compiles the arguments of a call with spread arguments,
+// e.g: f(1, ...xs), into an array of the arguments in register dst
+func (c *Compiler) spreadArguments(args []ast.Expression, dst int) error {
+	var pending []ast.Expression
+	first := true
+
+	flush := func() error {
+		r := dst
+		if !first {
+			r = c.allocate(1)
+		}
+		base := c.allocate(len(pending))
+		for i, arg := range pending {
+			if err := c.expressionTo(arg, base+i); err != nil {
+				return err
+			}
+		}
+		c.emit(MakeArray, r, base, len(pending))
+		if !first {
+			c.emit(ExtendArray, dst, r)
+		}
+		pending, first = nil, false
+		return nil
+	}
+
+	for _, arg := range args {
+		spread, ok := arg.(*ast.SpreadExpression)
+		if !ok {
+			pending = append(pending, arg)
+			continue
+		}
+
+		if first || len(pending) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		r, err := c.register(spread.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(ExtendArray, dst, r)
+	}
+
+	if len(pending) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+func (c *Compiler) bind(name string, value ast.Expression) error {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if ok && symbol.Const && c.inCurrentScope(symbol) {
+		return fmt.Errorf("cannot assign to constant %s", name)
+	}
+
+	// Builtins, free variables, the function being defined and the
+	// constants of enclosing scopes are shadowed by a new binding
+	if !ok || symbol.Scope == BuiltinScope || symbol.Scope == FreeScope ||
+		symbol.Scope == SelfScope || symbol.Const {
+		return c.define(name, value)
+	}
+
+	return c.store(symbol, value)
+}
+
+// inCurrentScope reports whether symbol was defined in the current scope
+// rather than in an enclosing scope or as a builtin
+func (c *Compiler) inCurrentScope(symbol Symbol) bool {
+	switch symbol.Scope {
+	case LocalScope:
+		return true
+	case GlobalScope:
+		return !c.inFunction()
+	default:
+		return false
+	}
+}
+
+// matchBind binds name to value for a match arm. As in the evaluator an arm
+// in a function binds a global variable to a new local variable rather than
+// assigning to the global.
+func (c *Compiler) matchBind(name string, value ast.Expression) error {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if ok && symbol.Scope == GlobalScope && c.inFunction() {
+		return c.define(name, value)
+	}
+
+	return c.bind(name, value)
+}
+
+// bindConst binds name to value as a new constant and returns an error if
+// name is already bound to a constant in the current scope
+func (c *Compiler) bindConst(name string, value ast.Expression) error {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if ok && symbol.Const && c.inCurrentScope(symbol) {
+		return fmt.Errorf("cannot assign to constant %s", name)
+	}
+
+	if err := c.define(name, value); err != nil {
+		return err
+	}
+	c.symbolTable.MarkConst(name)
+	return nil
+}
+
+// define binds name to value as a new global or, in a function, local
+// variable
+func (c *Compiler) define(name string, value ast.Expression) error {
+	if !c.inFunction() {
+		operand, err := c.expression(value)
+		if err != nil {
+			return err
+		}
+		symbol := c.symbolTable.DefineGlobal(name)
+		c.emit(StoreGlobal, symbol.Index, operand)
+		return nil
+	}
+
+	r := c.allocateLocal()
+	if err := c.expressionTo(value, r); err != nil {
+		return err
+	}
+	c.symbolTable.DefineLocal(name, r)
+	return nil
+}
+
+func (c *Compiler) store(symbol Symbol, value ast.Expression) error {
+	if symbol.Const {
+		return fmt.Errorf("cannot assign to constant %s", symbol.Name)
+	}
+
+	if symbol.Scope == LocalScope {
+		return c.expressionTo(value, symbol.Index)
+	}
+
+	operand, err := c.expression(value)
+	if err != nil {
+		return err
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(StoreGlobal, symbol.Index, operand)
+	case FreeScope:
+		c.emit(StoreFree, symbol.Index, operand)
+	default:
+		return fmt.Errorf("cannot assign to %s", symbol.Name)
+	}
+
+	return nil
+}
+
+func (c *Compiler) assign(left, value ast.Expression) error {
+	switch left := left.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(left.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", left.Value)
+		}
+		return c.store(symbol, value)
+
+	case *ast.IndexExpression:
+		obj, err := c.register(left.Left)
+		if err != nil {
+			return err
+		}
+		index, err := c.expression(left.Index)
+		if err != nil {
+			return err
+		}
+		operand, err := c.expression(value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(SetItem, obj, index, operand)
+		return nil
+
+	case *ast.ArrayPattern, *ast.HashPattern:
+		r, err := c.register(value)
+		if err != nil {
+			return err
+		}
+		return c.destructure(left, r, destructureAssign)
+
+	default:
+		return fmt.Errorf("expected identifier or index expression got=%s", left)
+	}
+}
+
+// compoundAssign compiles an assignment such as x += 1 or xs[i] += 1
+// evaluating the object and index of an index expression once
+func (c *Compiler) compoundAssign(node *ast.AssignmentExpression) error {
+	op, ok := binaryOperators[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	switch left := node.Left.(type) {
+	case *ast.Identifier:
+		return c.assign(left, &ast.InfixExpression{
+			Token:    node.Token,
+			Left:     left,
+			Operator: node.Operator,
+			Right:    node.Value,
+		})
+
+	case *ast.IndexExpression:
+		obj, err := c.register(left.Left)
+		if err != nil {
+			return err
+		}
+		index, err := c.expression(left.Index)
+		if err != nil {
+			return err
+		}
+
+		value := c.allocate(1)
+		c.emit(GetItem, value, obj, index)
+		operand, err := c.expression(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(op, value, value, operand)
+
+		c.emit(SetItem, obj, index, value)
+		return nil
+
+	default:
+		return fmt.Errorf("expected identifier or index expression got=%s", left)
+	}
+}
+
+// registerValue is a pseudo expression for a value already held in a
+// register, used to bind or assign the parts of a destructured value
+type registerValue struct {
+	ast.Expression
+	r int
+}
+
+func (rv *registerValue) TokenLiteral() string { return "" }
+
+func (rv *registerValue) String() string { return fmt.Sprintf("R(%d)", rv.r) }
+
+// destructureMode is how the identifiers of a destructuring pattern are
+// stored to
+type destructureMode int
+
+const (
+	// destructureAssign assigns existing variables as = does
+	destructureAssign destructureMode = iota
+	// destructureBind binds variables as := does
+	destructureBind
+	// destructureDefine defines new variables, as for pattern parameters
+	destructureDefine
+)
+
+// destructure destructures the value held in register r into the identifiers
+// of pattern, storing them according to mode
+func (c *Compiler) destructure(pattern ast.Expression, r int, mode destructureMode) error {
+	var targets []ast.Expression
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		switch mode {
+		case destructureBind:
+			return c.bind(pattern.Value, &registerValue{r: r})
+		case destructureDefine:
+			return c.define(pattern.Value, &registerValue{r: r})
+		default:
+			return c.assign(pattern, &registerValue{r: r})
+		}
+
+	case *ast.ArrayPattern:
+		targets = append(targets, pattern.Elements...)
+		op := UnpackArray
+		if pattern.Rest != nil {
+			targets = append(targets, pattern.Rest)
+			op = UnpackRest
+		}
+		base := c.allocate(len(targets))
+		c.emit(op, base, r, len(targets))
+
+		for i, target := range targets {
+			if err := c.destructure(target, base+i, mode); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		base := c.allocate(len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			c.emit(LoadConstant, base+i, c.string(key.Value))
+		}
+		c.emit(UnpackHash, base, r, len(pattern.Keys))
+
+		for i, key := range pattern.Keys {
+			if err := c.destructure(key, base+i, mode); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("invalid destructuring target %s", pattern)
+	}
+
+	return nil
+}
+
+// structLiteral compiles a struct declaration which binds the struct's name
+// to a new struct, copied from a template constant, before compiling its
+// methods so that they can refer to the struct
+func (c *Compiler) structLiteral(node *ast.StructLiteral) error {
+	fields := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		fields[i] = field.Value
+	}
+
+	template, err := object.NewStruct(node.Name.Value, fields)
+	if err != nil {
+		return err
+	}
+
+	st := c.allocate(1)
+	c.emit(MakeStruct, st, c.addConstant(template))
+	if err := c.bind(node.Name.Value, &registerValue{r: st}); err != nil {
+		return err
+	}
+
+	methods := c.allocate(2 * len(node.Methods))
+	for i, method := range node.Methods {
+		c.emit(LoadConstant, methods+2*i, c.string(node.MethodNames[i].Value))
+		if err := c.function(method, methods+2*i+1); err != nil {
+			return err
+		}
+	}
+	c.emit(DefineMethods, st, methods, len(node.Methods))
+
+	return nil
+}
+
+// ifExpression compiles an if expression and its `else if` branches into a
+// chain of conditions each jumping to the next when false, with the end of
+// each consequence jumping to the end of the chain
+func (c *Compiler) ifExpression(node *ast.IfExpression, dst int) error {
+	var ends []int
+	for {
+		top := c.top()
+		condition, err := c.register(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpIfFalse := c.emit(JumpIfFalse, condition, 0)
+		c.free(top)
+
+		if err := c.block(node.Consequence, dst); err != nil {
+			return err
+		}
+
+		if node.ElseIf == nil && node.Alternative == nil && dst == noRegister {
+			c.patch(jumpIfFalse)
+			break
+		}
+
+		ends = append(ends, c.emit(Jump, 0))
+		c.patch(jumpIfFalse)
+
+		if node.ElseIf == nil {
+			if node.Alternative == nil {
+				c.emit(LoadNull, dst)
+			} else if err := c.block(node.Alternative, dst); err != nil {
+				return err
+			}
+			break
+		}
+		node = node.ElseIf
+	}
+
+	for _, pos := range ends {
+		c.patch(pos)
+	}
+
+	return nil
+}
+
+// match compiles a match expression into a chain of tests of the subject,
+// held in a temporary register, against the pattern of each arm
+func (c *Compiler) match(node *ast.MatchExpression, dst int) error {
+	// The subject is copied as the arms may rebind a variable holding it
+	subject := c.allocate(1)
+	if err := c.expressionTo(node.Subject, subject); err != nil {
+		return err
+	}
+
+	var ends []int
+	for _, arm := range node.Arms {
+		top := c.top()
+
+		var (
+			fails []int
+			binds []matchBinding
+		)
+		if err := c.matchPattern(arm.Pattern, subject, &fails, &binds); err != nil {
+			return err
+		}
+
+		for _, b := range binds {
+			if err := c.matchBind(b.name, &registerValue{r: b.r}); err != nil {
+				return err
+			}
+		}
+
+		if arm.Guard != nil {
+			guard, err := c.register(arm.Guard)
+			if err != nil {
+				return err
+			}
+			fails = append(fails, c.emit(JumpIfFalse, guard, 0))
+		}
+
+		if err := c.block(arm.Body, dst); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(Jump, 0))
+
+		for _, pos := range fails {
+			c.patch(pos)
+		}
+		c.free(top)
+	}
+
+	if dst != noRegister {
+		c.emit(LoadNull, dst)
+	}
+
+	for _, pos := range ends {
+		c.patch(pos)
+	}
+
+	return nil
+}
+
+// matchBinding is a variable bound by a match pattern to the part of the
+// match subject in register r
+type matchBinding struct {
+	name string
+	r    int
+}
+
+// matchPattern emits code testing whether the value in register r matches
+// pattern, adding the positions of the jumps taken when it does not to
+// fails and the variables the pattern binds to binds
+func (c *Compiler) matchPattern(pattern ast.Expression, r int, fails *[]int, binds *[]matchBinding) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			*binds = append(*binds, matchBinding{pattern.Value, r})
+		}
+
+	case *ast.AlternativePattern:
+		var oks []int
+		for i, alt := range pattern.Alternatives {
+			if i == len(pattern.Alternatives)-1 {
+				if err := c.matchPattern(alt, r, fails, binds); err != nil {
+					return err
+				}
+				break
+			}
+
+			var next []int
+			if err := c.matchPattern(alt, r, &next, binds); err != nil {
+				return err
+			}
+			oks = append(oks, c.emit(Jump, 0))
+			for _, pos := range next {
+				c.patch(pos)
+			}
+		}
+		for _, pos := range oks {
+			c.patch(pos)
+		}
+
+	case *ast.ArrayPattern:
+		op := MatchArray
+		if pattern.Rest != nil {
+			op = MatchRest
+		}
+		matched := c.allocate(1)
+		c.emit(op, matched, r, len(pattern.Elements))
+		*fails = append(*fails, c.emit(JumpIfFalse, matched, 0))
+
+		for i, el := range pattern.Elements {
+			value := c.allocate(1)
+			c.emit(GetItem, value, r, rk(c.integer(int64(i))))
+			if err := c.matchPattern(el, value, fails, binds); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			value := c.allocate(1)
+			bounds := c.allocate(2)
+			c.emit(LoadConstant, bounds, c.integer(int64(len(pattern.Elements))))
+			c.emit(LoadNull, bounds+1)
+			c.emit(GetSlice, value, r, bounds)
+			*binds = append(*binds, matchBinding{pattern.Rest.Value, value})
+		}
+
+	case *ast.HashPattern:
+		// MatchHash stores its result in the first key's register
+		base := c.allocate(maxInt(len(pattern.Keys), 1))
+		for i, key := range pattern.Keys {
+			c.emit(LoadConstant, base+i, c.string(key.Value))
+		}
+		c.emit(MatchHash, base, r, len(pattern.Keys))
+		*fails = append(*fails, c.emit(JumpIfFalse, base, 0))
+
+		for i, key := range pattern.Keys {
+			value := c.allocate(1)
+			c.emit(GetItem, value, r, rk(c.string(key.Value)))
+
+			sub := pattern.Patterns[i]
+			if sub == nil {
+				sub = key
+			}
+			if err := c.matchPattern(sub, value, fails, binds); err != nil {
+				return err
+			}
+		}
+
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.Null:
+		literal, err := c.expression(pattern)
+		if err != nil {
+			return err
+		}
+		matched := c.allocate(1)
+		c.emit(MatchValue, matched, r, literal)
+		*fails = append(*fails, c.emit(JumpIfFalse, matched, 0))
+
+	default:
+		return fmt.Errorf("invalid pattern %s", pattern)
+	}
+
+	return nil
+}
+
+func (c *Compiler) function(node *ast.FunctionLiteral, dst int) error {
+	c.enterScope(node.Name)
+
+	if node.Name != "" {
+		c.symbolTable.DefineSelf(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.DefineLocal(p.Value, c.allocateLocal())
+	}
+	if node.Rest != nil {
+		c.symbolTable.DefineLocal(node.Rest.Value, c.allocateLocal())
+	}
+
+	if err := c.body(node.Body); err != nil {
+		return err
+	}
+
+	// Calls with missing arguments enter the function at the entry
+	// evaluating the first missing default, placed after the body, and fall
+	// through the remaining defaults before jumping to the body
+	var entries []int
+	optional := len(node.Parameters) - len(node.Defaults)
+	for i, d := range node.Defaults {
+		entries = append(entries, c.position())
+		if err := c.expressionTo(d, optional+i); err != nil {
+			return err
+		}
+	}
+	if len(entries) > 0 {
+		c.emit(Jump, 0)
+	}
+
+	fn, free := c.leaveScope()
+	fn.NumParams = len(node.Parameters)
+	fn.NumDefaults = len(node.Defaults)
+	fn.Entries = entries
+	fn.Variadic = node.Rest != nil
+	fn.NumFree = len(free)
+
+	if dst == noRegister {
+		return nil
+	}
+
+	base := c.allocate(len(free))
+	for i, symbol := range free {
+		c.load(symbol, base+i)
+	}
+
+	c.emit(MakeClosure, dst, c.addConstant(fn), base)
+
+	return nil
+}
+
+// body compiles the body of a function returning the value of its last
+// expression statement (or null) if it doesn't end with a return statement
+func (c *Compiler) body(block *ast.BlockStatement) error {
+	stmts := statements(block)
+	n := len(stmts)
+	if n > 0 {
+		if es, ok := stmts[n-1].(*ast.ExpressionStatement); ok {
+			if _, ok := es.Expression.(*ast.CallExpression); ok {
+				for _, s := range stmts[:n-1] {
+					if err := c.statement(s, false); err != nil {
+						return err
+					}
+				}
+				c.mark(es.Token.Line)
+				return c.returnStatement(es.Expression)
+			}
+		}
+	}
+
+	r := c.allocate(1)
+	if err := c.block(block, r); err != nil {
+		return err
+	}
+	c.emit(Return, r)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package rvm
+
+import (
+	"fmt"
+
+	"github.com/prologic/monkey-lang/object"
+)
+
+// Function is a function compiled to register machine instructions. The
+// last NumDefaults parameters have default values and Entries[i] is the
+// instruction to start executing at when only NumParams-NumDefaults+i
+// arguments are given. If Variadic is true any extra arguments are collected
+// into the register after the parameters.
+type Function struct {
+	Name         string
+	Instructions Instructions
+	Lines        map[int]int // maps instructions starting a statement to lines
+	NumRegisters int
+	NumParams    int
+	NumDefaults  int
+	Entries      []int
+	Variadic     bool
+	NumFree      int
+}
+
+// Type returns the type of the object
+func (f *Function) Type() object.Type { return object.COMPILED_FUNCTION }
+
+// Inspect returns a stringified version of the object for debugging
+func (f *Function) Inspect() string {
+	return fmt.Sprintf("Function[%p]", f)
+}
+
+func (f *Function) String() string {
+	return f.Inspect()
+}
+
+// line returns the source line of the statement the instruction at pc
+// belongs to or 0 if unknown
+func (f *Function) line(pc int) int {
+	for i := pc; i >= 0; i-- {
+		if line, ok := f.Lines[i]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// Closure is a Function together with the values of its free variables
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+// Type returns the type of the object
+func (c *Closure) Type() object.Type { return object.FUNCTION }
+
+// Inspect returns a stringified version of the object for debugging
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+func (c *Closure) String() string {
+	return c.Inspect()
+}
@@ -0,0 +1,261 @@
+package rvm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/cover"
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+	"github.com/prologic/monkey-lang/vm"
+	"github.com/prologic/monkey-lang/vmtest"
+)
+
+// run compiles and runs program returning the value of its last expression
+// statement
+func run(program *ast.Program) (object.Object, error) {
+	c := NewCompiler()
+	if err := c.Compile(program); err != nil {
+		return nil, fmt.Errorf("compiler error: %s", err)
+	}
+
+	vm := New(c.Bytecode())
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.Result(), nil
+}
+
+func TestSharedCases(t *testing.T) {
+	vmtest.RunAll(t, run)
+}
+
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	vmtest.RunFiles(t, run, "../examples/*.monkey")
+}
+
+func TestIntegration(t *testing.T) {
+	vmtest.RunFiles(t, run, "../testdata/*.monkey")
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	vmtest.RunErrors(t, run, []vmtest.ErrorCase{
+		{Input: `1 > "a"`, Expected: "unknown operator: GreaterThan (int str)"},
+	})
+}
+
+func TestCoverage(t *testing.T) {
+	input := `
+	f := fn(x) {
+		if (x > 1) {
+			return "big"
+		}
+		return "small"
+	}
+	f(0); f(1)
+	`
+
+	program := vmtest.Parse(input)
+
+	comp := NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.Coverage = cover.Counts{}
+
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := cover.Counts{2: 1, 3: 2, 6: 2, 8: 2}
+	if fmt.Sprint(vm.Coverage) != fmt.Sprint(expected) {
+		t.Errorf("wrong coverage. want=%v, got=%v", expected, vm.Coverage)
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	tests := map[string]string{
+		"iterative": `
+		fib := fn(n) {
+		   if (n < 3) {
+			 return 1
+		   }
+		   a := 1
+		   b := 1
+		   c := 0
+		   i := 0
+		   while (i < n - 2) {
+			 c = a + b
+			 b = a
+			 a = c
+			 i = i + 1
+		   }
+		   return a
+		}
+
+		fib(35)
+		`,
+		"recursive": `
+		fib := fn(x) {
+		  if (x == 0) {
+			return 0
+		  }
+		  if (x == 1) {
+			return 1
+		  }
+		  return fib(x-1) + fib(x-2)
+		}
+
+		fib(35)
+		`,
+		"tail-recursive": `
+		fib := fn(n, a, b) {
+		  if (n == 0) {
+			return a
+		  }
+		  if (n == 1) {
+			return b
+		  }
+		  return fib(n - 1, b, a + b)
+		}
+
+		fib(35, 0, 1)
+		`,
+	}
+
+	for name, input := range tests {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				program := vmtest.Parse(input)
+
+				c := NewCompiler()
+				err := c.Compile(program)
+				if err != nil {
+					b.Log(input)
+					b.Fatalf("compiler error: %s", err)
+				}
+
+				vm := New(c.Bytecode())
+
+				err = vm.Run()
+				if err != nil {
+					b.Log(input)
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkExamples compares the register based VM with the stack based VM
+// on the example programs
+func BenchmarkExamples(b *testing.B) {
+	stdout := object.StandardOutput
+	object.StandardOutput = ioutil.Discard
+	defer func() { object.StandardOutput = stdout }()
+
+	for _, name := range []string{"fib", "fibi", "fibt", "fact", "factt", "bf"} {
+		src, err := ioutil.ReadFile(filepath.Join("..", "examples", name+".monkey"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		program := vmtest.Parse(string(src))
+
+		b.Run(name+"/vm", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c := compiler.New()
+				if err := c.Compile(program); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				if err := vm.New(c.Bytecode()).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+
+		b.Run(name+"/rvm", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c := NewCompiler()
+				if err := c.Compile(program); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				if err := New(c.Bytecode()).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := Instructions{
+		{Op: LoadSelf, A: 1},
+		{Op: LoadConstant, A: 0, B: 2},
+		{Op: Add, A: 2, B: 0, C: rk(1)},
+		{Op: Opcode(255)},
+	}
+
+	expected := `0000 LoadSelf 1
+0001 LoadConstant 0 2
+0002 Add 2 0 -2
+0003 ERROR: opcode 255 undefined
+`
+
+	if instructions.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, instructions.String())
+	}
+}
+
+func TestLimit(t *testing.T) {
+	c := NewCompiler()
+	if err := c.Compile(vmtest.Parse(`while (true) { 1 }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(c.Bytecode())
+	vm.Limit = 1000
+
+	if err := vm.Run(); err != ErrLimitExceeded {
+		t.Fatalf("expected ErrLimitExceeded, got=%v", err)
+	}
+}
+
+func FuzzRun(f *testing.F) {
+	vmtest.Quiet(f)
+
+	for _, seed := range vmtest.FuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		c := NewCompiler()
+		if err := c.Compile(program); err != nil {
+			return
+		}
+
+		vm := New(c.Bytecode())
+		vm.Limit = vmtest.FuzzLimit
+		vm.Run()
+	})
+}
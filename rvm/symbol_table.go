@@ -0,0 +1,104 @@
+package rvm
+
+type SymbolScope string
+
+const (
+	BuiltinScope SymbolScope = "BUILTIN"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	SelfScope    SymbolScope = "SELF"
+)
+
+// Symbol is a name bound to a builtin, global, register (local), free
+// variable or the function currently being defined (self)
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool // true for constants and builtins which cannot be assigned
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store      map[string]Symbol
+	numGlobals int
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]Symbol)}
+}
+
+// DefineGlobal defines name as the next global variable
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numGlobals}
+	s.store[name] = symbol
+	s.numGlobals++
+	return symbol
+}
+
+// DefineLocal defines name as a local variable held in register
+func (s *SymbolTable) DefineLocal(name string, register int) Symbol {
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: register}
+	s.store[name] = symbol
+	return symbol
+}
+
+// MarkConst marks the symbol defined for name in this table as a constant
+func (s *SymbolTable) MarkConst(name string) Symbol {
+	symbol := s.store[name]
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index, Const: true}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineSelf defines name as the function whose body is being compiled
+func (s *SymbolTable) DefineSelf(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: SelfScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{
+		Name:  original.Name,
+		Scope: FreeScope,
+		Index: len(s.FreeSymbols) - 1,
+		Const: original.Const,
+	}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.DefineFree(symbol), true
+}
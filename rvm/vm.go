@@ -0,0 +1,894 @@
+package rvm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/prologic/monkey-lang/cover"
+	"github.com/prologic/monkey-lang/object"
+)
+
+const (
+	MaxFrames  = 1024
+	MaxGlobals = 65536
+)
+
+var (
+	// ErrLimitExceeded is returned by Run when Limit instructions have been
+	// executed without the program finishing
+	ErrLimitExceeded = errors.New("instruction limit exceeded")
+)
+
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+// Small integers are preallocated to avoid allocating an object for every
+// arithmetic result
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1024
+)
+
+var integers [maxCachedInteger - minCachedInteger]*object.Integer
+
+func init() {
+	for i := range integers {
+		integers[i] = &object.Integer{Value: int64(i + minCachedInteger)}
+	}
+}
+
+func newInteger(value int64) *object.Integer {
+	if value >= minCachedInteger && value < maxCachedInteger {
+		return integers[value-minCachedInteger]
+	}
+	return &object.Integer{Value: value}
+}
+
+// isInt64 reports whether obj is an Integer, and not a BigInteger
+func isInt64(obj object.Object) bool {
+	_, ok := obj.(*object.Integer)
+	return ok
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+
+	case *object.Boolean:
+		return obj.Value
+
+	case *object.Null:
+		return false
+
+	default:
+		return true
+	}
+}
+
+// Frame is the activation of a closure whose registers start at base in the
+// VM's register file. The value returned is stored in register ret.
+type Frame struct {
+	cl   *Closure
+	pc   int
+	base int
+	ret  int
+}
+
+type VM struct {
+	Debug bool
+
+	// Coverage, if non-nil, records the number of times the statements on
+	// each source line are executed
+	Coverage cover.Counts
+
+	// Limit, if non-zero, is the maximum number of instructions Run executes
+	// before returning ErrLimitExceeded
+	Limit int
+
+	constants []object.Object
+	globals   []object.Object
+
+	frames []Frame
+	regs   []object.Object
+
+	result object.Object
+
+	// steps is the number of instructions Run has executed
+	steps int
+}
+
+func New(bytecode *Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, MaxGlobals))
+}
+
+func NewWithGlobalsStore(bytecode *Bytecode, globals []object.Object) *VM {
+	main := &Closure{Fn: bytecode.Main}
+
+	frames := make([]Frame, 1, MaxFrames)
+	frames[0] = Frame{cl: main, ret: -1}
+
+	return &VM{
+		constants: bytecode.Constants,
+		globals:   globals,
+
+		frames: frames,
+		regs:   make([]object.Object, maxInt(bytecode.Main.NumRegisters, 256)),
+
+		result: Null,
+	}
+}
+
+// Result returns the value of the last top-level expression statement
+// executed
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+// Line returns the source line of the statement currently being executed
+// or 0 if unknown
+func (vm *VM) Line() int {
+	if len(vm.frames) == 0 {
+		return 0
+	}
+	frame := &vm.frames[len(vm.frames)-1]
+	return frame.cl.Fn.line(frame.pc - 1)
+}
+
+// grow makes sure the register file holds at least n registers
+func (vm *VM) grow(n int) {
+	if n > len(vm.regs) {
+		regs := make([]object.Object, maxInt(n, 2*len(vm.regs)))
+		copy(regs, vm.regs)
+		vm.regs = regs
+	}
+}
+
+// call calls the function in register fn (relative to base) with the n
+// arguments in the registers following it storing the result in register
+// ret. If tail is true the current frame is replaced.
+func (vm *VM) call(base, fn, n, ret int, tail bool) error {
+	switch callee := vm.regs[base+fn].(type) {
+	case *Closure:
+		f := callee.Fn
+		err := object.CheckArity(f.NumParams, f.NumDefaults, f.Variadic, n)
+		if err != nil {
+			return err
+		}
+
+		args := base + fn + 1
+		vm.grow(args + f.NumRegisters)
+
+		// Collect any extra arguments into the rest parameter and clear
+		// missing arguments until their defaults are evaluated
+		if f.Variadic {
+			rest := &object.Array{Elements: []object.Object{}}
+			if n > f.NumParams {
+				rest.Elements = append(rest.Elements, vm.regs[args+f.NumParams:args+n]...)
+			}
+			vm.regs[args+f.NumParams] = rest
+		}
+
+		entry := 0
+		if missing := f.NumParams - n; missing > 0 {
+			entry = f.Entries[f.NumDefaults-missing]
+			for i := n; i < f.NumParams; i++ {
+				vm.regs[args+i] = Null
+			}
+		}
+
+		if tail {
+			numArgs := f.NumParams
+			if f.Variadic {
+				numArgs++
+			}
+			frame := &vm.frames[len(vm.frames)-1]
+			copy(vm.regs[frame.base:], vm.regs[args:args+numArgs])
+			frame.cl = callee
+			frame.pc = entry
+			vm.grow(frame.base + f.NumRegisters)
+			return nil
+		}
+
+		if len(vm.frames) >= MaxFrames {
+			return fmt.Errorf("stack overflow")
+		}
+
+		vm.frames = append(vm.frames, Frame{cl: callee, base: args, ret: ret, pc: entry})
+		return nil
+
+	case *object.Builtin:
+		args := vm.regs[base+fn+1 : base+fn+1+n]
+
+		result, err := object.CallBuiltin(callee, vm.callFunction, args...)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			result = Null
+		}
+
+		if tail {
+			return vm.ret(result)
+		}
+		vm.regs[ret] = result
+		return nil
+
+	case *object.Struct:
+		instance, err := callee.New(vm.regs[base+fn+1 : base+fn+1+n])
+		if err != nil {
+			return err
+		}
+
+		if tail {
+			return vm.ret(instance)
+		}
+		vm.regs[ret] = instance
+		return nil
+
+	case *object.BoundMethod:
+		return vm.callWithSelf(base, fn, n, ret, tail, callee.Method, callee.Self)
+
+	default:
+		if hook, ok := object.Metamethod(callee, "__call"); ok {
+			return vm.callWithSelf(base, fn, n, ret, tail, hook, callee)
+		}
+		return fmt.Errorf(
+			"calling non-closure and non-builtin: %T %v",
+			callee, callee,
+		)
+	}
+}
+
+// callWithSelf calls method in place of the function in register fn with
+// self inserted before the arguments
+func (vm *VM) callWithSelf(base, fn, n, ret int, tail bool, method, self object.Object) error {
+	args := base + fn + 1
+	vm.grow(args + n + 1)
+	copy(vm.regs[args+1:args+n+1], vm.regs[args:args+n])
+	vm.regs[args] = self
+	vm.regs[base+fn] = method
+	return vm.call(base, fn, n+1, ret, tail)
+}
+
+// callFunction calls fn with args in the registers above those of the
+// current frame and runs it to completion returning its result. It is used
+// to call metamethods while executing an instruction.
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	top := frame.base + frame.cl.Fn.NumRegisters
+	depth := len(vm.frames)
+
+	vm.grow(top + len(args) + 1)
+	vm.regs[top] = fn
+	copy(vm.regs[top+1:], args)
+
+	if err := vm.call(top, 0, len(args), top, false); err != nil {
+		return nil, err
+	}
+	if err := vm.run(depth); err != nil {
+		return nil, err
+	}
+
+	return vm.regs[top], nil
+}
+
+// ret returns from the current frame storing value in the caller's return
+// register
+func (vm *VM) ret(value object.Object) error {
+	frame := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+
+	if len(vm.frames) == 0 {
+		vm.result = value
+		return nil
+	}
+
+	vm.regs[frame.ret] = value
+	return nil
+}
+
+// Run executes the program until it finishes, an error occurs or Limit
+// instructions have been executed.
+func (vm *VM) Run() error {
+	vm.steps = 0
+	return vm.run(0)
+}
+
+// run executes instructions until the frames above depth have returned.
+// Instructions which may call metamethods, and so grow the register file,
+// store their results through vm.regs rather than the cached regs.
+func (vm *VM) run(depth int) error {
+	var (
+		frame *Frame
+		ins   Instruction
+	)
+
+	for len(vm.frames) > depth {
+		frame = &vm.frames[len(vm.frames)-1]
+		code := frame.cl.Fn.Instructions
+
+		if frame.pc >= len(code) {
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			continue
+		}
+
+		if vm.Limit > 0 {
+			if vm.steps >= vm.Limit {
+				return ErrLimitExceeded
+			}
+			vm.steps++
+		}
+
+		if vm.Coverage != nil {
+			if line, ok := frame.cl.Fn.Lines[frame.pc]; ok {
+				vm.Coverage[line]++
+			}
+		}
+
+		ins = code[frame.pc]
+		frame.pc++
+
+		if vm.Debug {
+			log.Printf(
+				"%04d %-30s [fp=%02d base=%04d]\n",
+				frame.pc-1, ins, len(vm.frames)-1, frame.base,
+			)
+		}
+
+		base := frame.base
+		regs := vm.regs
+
+		rk := func(x int) object.Object {
+			if x >= 0 {
+				return regs[base+x]
+			}
+			return vm.constants[-1-x]
+		}
+
+		switch ins.Op {
+
+		case Move:
+			regs[base+ins.A] = regs[base+ins.B]
+
+		case LoadConstant:
+			regs[base+ins.A] = vm.constants[ins.B]
+
+		case LoadNull:
+			regs[base+ins.A] = Null
+
+		case LoadBoolean:
+			regs[base+ins.A] = nativeBoolToBooleanObject(ins.B != 0)
+
+		case LoadGlobal:
+			regs[base+ins.A] = vm.globals[ins.B]
+
+		case StoreGlobal:
+			vm.globals[ins.A] = rk(ins.B)
+
+		case LoadBuiltin:
+			regs[base+ins.A] = object.BuiltinsIndex[ins.B]
+
+		case LoadFree:
+			regs[base+ins.A] = frame.cl.Free[ins.B]
+
+		case StoreFree:
+			frame.cl.Free[ins.A] = rk(ins.B)
+
+		case LoadSelf:
+			regs[base+ins.A] = frame.cl
+
+		case Add, Sub, Mul, Div, Mod,
+			BitwiseOR, BitwiseXOR, BitwiseAND, LeftShift, RightShift, Pow, Or, And:
+
+			result, err := vm.executeBinaryOperation(ins.Op, rk(ins.B), rk(ins.C))
+			if err != nil {
+				return err
+			}
+			vm.regs[base+ins.A] = result
+
+		case Equal, NotEqual, GreaterThan, GreaterThanEqual:
+			result, err := vm.executeComparison(ins.Op, rk(ins.B), rk(ins.C))
+			if err != nil {
+				return err
+			}
+			vm.regs[base+ins.A] = result
+
+		case Minus:
+			operand := rk(ins.B)
+			if !object.IsInteger(operand) {
+				return fmt.Errorf("expected int got=%T", operand)
+			}
+			regs[base+ins.A] = object.NegateInteger(operand)
+
+		case BitwiseNOT:
+			operand := rk(ins.B)
+			if !object.IsInteger(operand) {
+				return fmt.Errorf("expected int got=%T", operand)
+			}
+			regs[base+ins.A] = object.InvertInteger(operand)
+
+		case Not:
+			regs[base+ins.A] = nativeBoolToBooleanObject(!isTruthy(rk(ins.B)))
+
+		case GetItem:
+			result, err := vm.executeGetItem(rk(ins.B), rk(ins.C))
+			if err != nil {
+				return err
+			}
+			vm.regs[base+ins.A] = result
+
+		case GetSlice:
+			result, err := executeGetSlice(rk(ins.B), regs[base+ins.C], regs[base+ins.C+1])
+			if err != nil {
+				return err
+			}
+			regs[base+ins.A] = result
+
+		case SetItem:
+			err := executeSetItem(regs[base+ins.A], rk(ins.B), rk(ins.C))
+			if err != nil {
+				return err
+			}
+
+		case MakeArray:
+			elements := make([]object.Object, ins.C)
+			copy(elements, regs[base+ins.B:base+ins.B+ins.C])
+			regs[base+ins.A] = &object.Array{Elements: elements}
+
+		case BuildString:
+			var b strings.Builder
+			for _, part := range regs[base+ins.B : base+ins.B+ins.C] {
+				str, err := object.ToString(part, vm.callFunction)
+				if err != nil {
+					return err
+				}
+				b.WriteString(str)
+			}
+			vm.regs[base+ins.A] = &object.String{Value: b.String()}
+
+		case MakeHash:
+			hash, err := buildHash(regs[base+ins.B : base+ins.B+ins.C])
+			if err != nil {
+				return err
+			}
+			regs[base+ins.A] = hash
+
+		case ExtendArray:
+			array, ok := regs[base+ins.A].(*object.Array)
+			if !ok {
+				return fmt.Errorf("invalid spread arguments")
+			}
+			spread, ok := regs[base+ins.B].(*object.Array)
+			if !ok {
+				return fmt.Errorf("cannot spread %s", regs[base+ins.B].Type())
+			}
+			elements := make([]object.Object, 0, len(array.Elements)+len(spread.Elements))
+			elements = append(elements, array.Elements...)
+			elements = append(elements, spread.Elements...)
+			regs[base+ins.A] = &object.Array{Elements: elements}
+
+		case UnpackArray, UnpackRest:
+			rest := ins.Op == UnpackRest
+			n := ins.C
+			if rest {
+				n--
+			}
+			values, err := object.UnpackArray(regs[base+ins.B], n, rest)
+			if err != nil {
+				return err
+			}
+			copy(regs[base+ins.A:], values)
+
+		case UnpackHash:
+			keys := regs[base+ins.A : base+ins.A+ins.C]
+			values, err := object.UnpackHash(regs[base+ins.B], keys)
+			if err != nil {
+				return err
+			}
+			copy(keys, values)
+
+		case MatchValue:
+			matched := object.MatchLiteral(regs[base+ins.B], rk(ins.C))
+			regs[base+ins.A] = nativeBoolToBooleanObject(matched)
+
+		case MatchArray, MatchRest:
+			matched := object.MatchArray(regs[base+ins.B], ins.C, ins.Op == MatchRest)
+			regs[base+ins.A] = nativeBoolToBooleanObject(matched)
+
+		case MatchHash:
+			keys := regs[base+ins.A : base+ins.A+ins.C]
+			matched := object.MatchHash(regs[base+ins.B], keys)
+			regs[base+ins.A] = nativeBoolToBooleanObject(matched)
+
+		case MakeClosure:
+			fn, ok := vm.constants[ins.B].(*Function)
+			if !ok {
+				return fmt.Errorf("not a function: %+v", vm.constants[ins.B])
+			}
+			free := make([]object.Object, fn.NumFree)
+			copy(free, regs[base+ins.C:base+ins.C+fn.NumFree])
+			regs[base+ins.A] = &Closure{Fn: fn, Free: free}
+
+		case MakeStruct:
+			template, ok := vm.constants[ins.B].(*object.Struct)
+			if !ok {
+				return fmt.Errorf("not a struct: %+v", vm.constants[ins.B])
+			}
+			regs[base+ins.A] = template.Copy()
+
+		case DefineMethods:
+			st, ok := regs[base+ins.A].(*object.Struct)
+			if !ok {
+				return fmt.Errorf("not a struct: %+v", regs[base+ins.A])
+			}
+			for i := 0; i < ins.C; i++ {
+				name := regs[base+ins.B+2*i].(*object.String)
+				st.Methods[name.Value] = regs[base+ins.B+2*i+1]
+			}
+
+		case Jump:
+			frame.pc = ins.A
+
+		case JumpIfFalse:
+			if !isTruthy(regs[base+ins.A]) {
+				frame.pc = ins.B
+			}
+
+		case Call:
+			if err := vm.call(base, ins.B, ins.C, base+ins.A, false); err != nil {
+				return err
+			}
+
+		case CallSpread:
+			args, ok := regs[base+ins.B+1].(*object.Array)
+			if !ok {
+				return fmt.Errorf("invalid spread arguments")
+			}
+			n := len(args.Elements)
+			vm.grow(base + ins.B + 1 + n)
+			copy(vm.regs[base+ins.B+1:], args.Elements)
+			if err := vm.call(base, ins.B, n, base+ins.A, false); err != nil {
+				return err
+			}
+
+		case TailCall:
+			if err := vm.call(base, ins.B, ins.C, frame.ret, true); err != nil {
+				return err
+			}
+
+		case Return:
+			if err := vm.ret(rk(ins.A)); err != nil {
+				return err
+			}
+
+		case SetResult:
+			vm.result = rk(ins.A)
+
+		default:
+			return fmt.Errorf("unknown opcode %d at %04d", ins.Op, frame.pc-1)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) executeBinaryOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	if op == Add {
+		if hook, ok := object.BinaryMetamethod(left, right, "__add"); ok {
+			return vm.callFunction(hook, left, right)
+		}
+	}
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+
+	case leftType == object.INTEGER && rightType == object.INTEGER:
+		return executeBinaryIntegerOperation(op, left, right)
+
+	// {"a": 1} + {"b": 2}
+	case op == Add && leftType == object.HASH && rightType == object.HASH:
+		return left.(*object.Hash).Merge(right.(*object.Hash)), nil
+
+	// [1] + [2]
+	case op == Add && leftType == object.ARRAY && rightType == object.ARRAY:
+		leftVal := left.(*object.Array).Elements
+		rightVal := right.(*object.Array).Elements
+		elements := make([]object.Object, 0, len(leftVal)+len(rightVal))
+		elements = append(elements, leftVal...)
+		elements = append(elements, rightVal...)
+		return &object.Array{Elements: elements}, nil
+
+	// [1] * 3
+	case op == Mul && leftType == object.ARRAY && isInt64(right):
+		return left.(*object.Array).Repeat(right.(*object.Integer).Value)
+	// 3 * [1]
+	case op == Mul && isInt64(left) && rightType == object.ARRAY:
+		return right.(*object.Array).Repeat(left.(*object.Integer).Value)
+
+	// " " * 4
+	case op == Mul && leftType == object.STRING && isInt64(right):
+		return left.(*object.String).Repeat(right.(*object.Integer).Value)
+	// 4 * " "
+	case op == Mul && isInt64(left) && rightType == object.STRING:
+		return right.(*object.String).Repeat(left.(*object.Integer).Value)
+
+	case leftType == object.BOOLEAN && rightType == object.BOOLEAN:
+		return executeBinaryBooleanOperation(op, left, right)
+	case leftType == object.STRING && rightType == object.STRING:
+		return executeBinaryStringOperation(op, left, right)
+	default:
+		return nil, fmt.Errorf("unsupported types for binary operation: %s %s",
+			leftType, rightType)
+	}
+}
+
+func executeBinaryIntegerOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	var operator string
+
+	switch op {
+	case Add:
+		operator = "+"
+	case Sub:
+		operator = "-"
+	case Mul:
+		operator = "*"
+	case Div:
+		operator = "/"
+	case Mod:
+		operator = "%"
+	case BitwiseOR:
+		operator = "|"
+	case BitwiseXOR:
+		operator = "^"
+	case BitwiseAND:
+		operator = "&"
+	case LeftShift:
+		operator = "<<"
+	case RightShift:
+		operator = ">>"
+	case Pow:
+		operator = "**"
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %s", op)
+	}
+
+	return object.IntegerOperation(operator, left, right)
+}
+
+func executeBinaryBooleanOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	leftValue := left.(*object.Boolean).Value
+	rightValue := right.(*object.Boolean).Value
+
+	switch op {
+	case Or:
+		return nativeBoolToBooleanObject(leftValue || rightValue), nil
+	case And:
+		return nativeBoolToBooleanObject(leftValue && rightValue), nil
+	default:
+		return nil, fmt.Errorf("unknown boolean operator: %s", op)
+	}
+}
+
+func executeBinaryStringOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	if op != Add {
+		return nil, fmt.Errorf("unknown string operator: %s", op)
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return &object.String{Value: leftValue + rightValue}, nil
+}
+
+func (vm *VM) executeComparison(op Opcode, left, right object.Object) (object.Object, error) {
+	if result, ok, err := vm.executeComparisonMetamethod(op, left, right); ok {
+		return result, err
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			return compare(op, left.Value, right.Value)
+		}
+		if object.IsInteger(right) {
+			return compare(op, int64(object.CompareIntegers(left, right)), 0)
+		}
+	case *object.BigInteger:
+		if object.IsInteger(right) {
+			return compare(op, int64(object.CompareIntegers(left, right)), 0)
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok {
+			return compare(op, int64(strings.Compare(left.Value, right.Value)), 0)
+		}
+	case *object.Boolean:
+		if right, ok := right.(*object.Boolean); ok && (op == Equal || op == NotEqual) {
+			return nativeBoolToBooleanObject((left.Value == right.Value) == (op == Equal)), nil
+		}
+	}
+
+	switch op {
+	case Equal:
+		return nativeBoolToBooleanObject(left == right), nil
+	case NotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s (%s %s)",
+			op, left.Type(), right.Type())
+	}
+}
+
+// executeComparisonMetamethod compares left and right with the __eq or __lt
+// metamethod of either operand and reports whether one was called. As `<` is
+// compiled to `>` with swapped operands a > b calls __lt(b, a) and a >= b is
+// the negation of __lt(a, b).
+func (vm *VM) executeComparisonMetamethod(op Opcode, left, right object.Object) (object.Object, bool, error) {
+	name, negate := "__eq", op == NotEqual
+	switch op {
+	case GreaterThan:
+		name, left, right = "__lt", right, left
+	case GreaterThanEqual:
+		name, negate = "__lt", true
+	}
+
+	hook, ok := object.BinaryMetamethod(left, right, name)
+	if !ok {
+		return nil, false, nil
+	}
+
+	result, err := vm.callFunction(hook, left, right)
+	if err != nil {
+		return nil, true, err
+	}
+	return nativeBoolToBooleanObject(isTruthy(result) != negate), true, nil
+}
+
+func compare(op Opcode, left, right int64) (object.Object, error) {
+	switch op {
+	case Equal:
+		return nativeBoolToBooleanObject(left == right), nil
+	case NotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	case GreaterThan:
+		return nativeBoolToBooleanObject(left > right), nil
+	case GreaterThanEqual:
+		return nativeBoolToBooleanObject(left >= right), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", op)
+	}
+}
+
+func executeGetSlice(left, start, end object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.String:
+		from, to, err := object.SliceBounds(left.Len(), start, end)
+		if err != nil {
+			return nil, err
+		}
+		return left.Slice(from, to), nil
+	case *object.Array:
+		from, to, err := object.SliceBounds(len(left.Elements), start, end)
+		if err != nil {
+			return nil, err
+		}
+		return left.Slice(from, to), nil
+	}
+
+	return nil, fmt.Errorf("slice operator not supported: %s", left.Type())
+}
+
+func (vm *VM) executeGetItem(left, index object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.String:
+		switch index := index.(type) {
+		case *object.Integer:
+			char, _ := left.CharAt(index.Value)
+			return &object.String{Value: char}, nil
+		case *object.String:
+			return newInteger(int64(left.IndexOf(index.Value))), nil
+		case *object.BigInteger:
+			return nil, object.IndexOutOfBounds(index)
+		}
+
+	case *object.Array:
+		if index, ok := index.(*object.Integer); ok {
+			i := index.Value
+			if i < 0 || i >= int64(len(left.Elements)) {
+				return Null, nil
+			}
+			return left.Elements[i], nil
+		}
+		if _, ok := index.(*object.BigInteger); ok {
+			return nil, object.IndexOutOfBounds(index)
+		}
+
+	case *object.Hash:
+		value, ok, err := left.Index(index, vm.callFunction)
+		if err != nil || !ok {
+			return Null, err
+		}
+		return value, nil
+
+	case *object.Instance:
+		return left.Get(index)
+	}
+
+	return nil, fmt.Errorf(
+		"index operator not supported: left=%s index=%s",
+		left.Type(), index.Type(),
+	)
+}
+
+func executeSetItem(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		if object.IsInteger(index) {
+			if left.Frozen {
+				return fmt.Errorf("cannot modify frozen array")
+			}
+			i, ok := index.(*object.Integer)
+			if !ok || i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+				return object.IndexOutOfBounds(index)
+			}
+			left.Elements[i.Value] = value
+			return nil
+		}
+
+	case *object.Hash:
+		if left.Frozen {
+			return fmt.Errorf("cannot modify frozen hash")
+		}
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key.HashKey(), object.HashPair{Key: index, Value: value})
+		return nil
+
+	case *object.Instance:
+		return left.Set(index, value)
+	}
+
+	return fmt.Errorf(
+		"set item operation not supported: left=%s index=%s",
+		left.Type(), index.Type(),
+	)
+}
+
+func buildHash(regs []object.Object) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := 0; i+1 < len(regs); i += 2 {
+		key, value := regs[i], regs[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash, nil
+}
+
+// maxInt returns the larger of a and b
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/prologic/monkey-lang/tester"
+)
+
+// runTests implements the `test` sub-command which discovers and runs all
+// Monkey tests in the given paths and returns the process exit status
+func runTests(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s test [options] [<dir|file>...]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+
+	run := fs.String("run", "", "run only tests matching the regular expression")
+	format := fs.String("format", tester.FormatText, "output format (text, tap or junit)")
+	fs.Parse(args)
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run expression: %s\n", err)
+			return 2
+		}
+		filter = re
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var results []*tester.Result
+	for _, p := range paths {
+		files, err := discover(p, isTestFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error discovering tests: %s\n", err)
+			return 2
+		}
+
+		for _, file := range files {
+			res, err := tester.RunFile(file, filter)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return 2
+			}
+			results = append(results, res...)
+		}
+	}
+
+	if err := tester.Write(os.Stdout, *format, results); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing results: %s\n", err)
+		return 2
+	}
+
+	for _, r := range results {
+		if !r.Passed() {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// isTestFile reports whether name is a Monkey test file
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, tester.FileSuffix)
+}
@@ -0,0 +1,169 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats supported by Write
+const (
+	FormatText  = "text"
+	FormatTAP   = "tap"
+	FormatJUnit = "junit"
+)
+
+// Write writes the results to w in the given format
+func Write(w io.Writer, format string, results []*Result) error {
+	switch format {
+	case FormatText, "":
+		return WriteText(w, results)
+	case FormatTAP:
+		return WriteTAP(w, results)
+	case FormatJUnit:
+		return WriteJUnit(w, results)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteText writes a human readable report and summary of results to w
+func WriteText(w io.Writer, results []*Result) error {
+	failed := 0
+
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(w, "--- PASS: %s (%s) (%.3fs)\n",
+				r.Name, r.File, r.Duration.Seconds())
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(w, "--- FAIL: %s (%s) (%.3fs)\n",
+			r.Name, r.File, r.Duration.Seconds())
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "    %s\n", f)
+		}
+		if r.Output != "" {
+			fmt.Fprintf(w, "    output:\n")
+			for _, line := range strings.Split(strings.TrimRight(r.Output, "\n"), "\n") {
+				fmt.Fprintf(w, "        %s\n", line)
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL\n")
+	} else {
+		fmt.Fprintf(w, "PASS\n")
+	}
+
+	_, err := fmt.Fprintf(w, "%d passed, %d failed, %d total\n",
+		len(results)-failed, failed, len(results))
+	return err
+}
+
+// WriteTAP writes results to w in the Test Anything Protocol (TAP) format
+func WriteTAP(w io.Writer, results []*Result) error {
+	fmt.Fprintf(w, "TAP version 13\n")
+	fmt.Fprintf(w, "1..%d\n", len(results))
+
+	for i, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(w, "ok %d - %s: %s\n", i+1, r.File, r.Name)
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s: %s\n", i+1, r.File, r.Name)
+		fmt.Fprintf(w, "  ---\n")
+		fmt.Fprintf(w, "  failures:\n")
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "    - %q\n", f.String())
+		}
+		fmt.Fprintf(w, "  ...\n")
+	}
+
+	return nil
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// WriteJUnit writes results to w as JUnit XML with one test suite per file
+func WriteJUnit(w io.Writer, results []*Result) error {
+	var suites junitTestSuites
+
+	index := make(map[string]int)
+	durations := make(map[string]float64)
+
+	for _, r := range results {
+		i, ok := index[r.File]
+		if !ok {
+			i = len(suites.Suites)
+			index[r.File] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: r.File})
+		}
+
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: r.File,
+			Time:      fmt.Sprintf("%.3f", r.Duration.Seconds()),
+			SystemOut: r.Output,
+		}
+
+		if !r.Passed() {
+			var messages []string
+			for _, f := range r.Failures {
+				messages = append(messages, f.String())
+			}
+			tc.Failure = &junitFailure{
+				Message: r.Failures[0].Message,
+				Text:    strings.Join(messages, "\n"),
+			}
+			suites.Suites[i].Failures++
+		}
+
+		suites.Suites[i].Tests++
+		suites.Suites[i].TestCases = append(suites.Suites[i].TestCases, tc)
+		durations[r.File] += r.Duration.Seconds()
+	}
+
+	for i, suite := range suites.Suites {
+		suites.Suites[i].Time = fmt.Sprintf("%.3f", durations[suite.Name])
+	}
+
+	io.WriteString(w, xml.Header)
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,194 @@
+// Package tester implements a test runner for Monkey programs. Test files
+// are named `*_test.monkey` and every top-level function bound to a name
+// starting with `test_` is run in isolation with a fresh virtual machine.
+// Failed assertions, errors returned by builtins which are not used (such as
+// the value of an expression statement) and calls to `exit` are collected
+// (with their source location) rather than exiting the process.
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/eval"
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+	"github.com/prologic/monkey-lang/vm"
+)
+
+const (
+	// FileSuffix is the suffix of files containing Monkey tests
+	FileSuffix = "_test.monkey"
+
+	// FuncPrefix is the prefix of functions that are run as tests
+	FuncPrefix = "test_"
+)
+
+// Failure holds the location and message of a single test failure
+type Failure struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Message)
+}
+
+// Result holds the result of running a single test function
+type Result struct {
+	File     string
+	Name     string
+	Output   string
+	Failures []Failure
+	Duration time.Duration
+}
+
+// Passed returns true if the test ran without any failures
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Tests returns the names of all top-level test functions in program
+func Tests(program *ast.Program) []string {
+	var names []string
+
+	for _, s := range program.Statements {
+		es, ok := s.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		be, ok := es.Expression.(*ast.BindExpression)
+		if !ok {
+			continue
+		}
+		ident, ok := be.Left.(*ast.Identifier)
+		if !ok || !strings.HasPrefix(ident.Value, FuncPrefix) {
+			continue
+		}
+		if _, ok := be.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, ident.Value)
+		}
+	}
+
+	return names
+}
+
+// RunFile parses the test file given by filename and runs all test functions
+// whose names match filter (or all if filter is nil)
+func RunFile(filename string, filter *regexp.Regexp) ([]*Result, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	l := lexer.New(string(b))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf(
+			"%s: parser errors:\n\t%s",
+			filename, strings.Join(p.Errors(), "\n\t"),
+		)
+	}
+
+	macros := object.NewEnvironment()
+	eval.DefineMacros(program, macros)
+	if _, err := eval.ExpandMacros(program, macros); err != nil {
+		return nil, fmt.Errorf("%s: macro expansion failed: %s", filename, err)
+	}
+
+	var results []*Result
+	for _, name := range Tests(program) {
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+		results = append(results, run(filename, name, program))
+	}
+
+	return results, nil
+}
+
+// exit is the panic value used to unwind a test that calls `exit`
+type exit struct {
+	status int
+}
+
+// run runs the test function name by executing the whole program followed
+// by a call to the test function on a fresh virtual machine
+func run(filename, name string, program *ast.Program) (result *Result) {
+	result = &Result{File: filename, Name: name}
+
+	var (
+		machine *vm.VM
+		output  bytes.Buffer
+	)
+
+	fail := func(message string) {
+		line := 0
+		if machine != nil {
+			line = machine.Line()
+		}
+		result.Failures = append(
+			result.Failures,
+			Failure{File: filename, Line: line, Message: message},
+		)
+	}
+
+	stdout, exitFunction := object.StandardOutput, object.ExitFunction
+	object.StandardOutput = &output
+	object.ExitFunction = func(status int) { panic(exit{status}) }
+	object.AssertFunction = fail
+	object.ErrorFunction = fail
+
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			if e, ok := err.(exit); ok {
+				fail(fmt.Sprintf("exit called with status %d", e.status))
+			} else {
+				fail(fmt.Sprintf("panic: %v", err))
+			}
+		}
+
+		result.Duration = time.Since(start)
+		result.Output = output.String()
+
+		object.StandardOutput = stdout
+		object.ExitFunction = exitFunction
+		object.AssertFunction = nil
+		object.ErrorFunction = nil
+	}()
+
+	call := &ast.ExpressionStatement{
+		Expression: &ast.CallExpression{
+			Function: &ast.Identifier{Value: name},
+		},
+	}
+	statements := make([]ast.Statement, 0, len(program.Statements)+1)
+	statements = append(statements, program.Statements...)
+	statements = append(statements, call)
+
+	c := compiler.New()
+	err := c.Compile(&ast.Program{Statements: statements})
+	if err != nil {
+		fail(fmt.Sprintf("compiler error: %s", err))
+		return
+	}
+
+	machine = vm.New(c.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		fail(err.Error())
+	}
+
+	return
+}
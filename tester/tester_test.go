@@ -0,0 +1,107 @@
+package tester
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunFile(t *testing.T) {
+	assert := assert.New(t)
+
+	results, err := RunFile("testdata/math_test.monkey", nil)
+	assert.NoError(err)
+	assert.Len(results, 6)
+
+	assert.Equal("test_add", results[0].Name)
+	assert.True(results[0].Passed())
+
+	assert.Equal("test_add_fails", results[1].Name)
+	assert.Equal([]Failure{
+		{File: "testdata/math_test.monkey", Line: 10, Message: "add(1, 1) != 3"},
+		{File: "testdata/math_test.monkey", Line: 11, Message: "add(2, 2) != 5"},
+	}, results[1].Failures)
+	assert.Equal("adding things\n", results[1].Output)
+
+	assert.Equal("test_error", results[2].Name)
+	assert.Equal([]Failure{
+		{
+			File:    "testdata/math_test.monkey",
+			Line:    15,
+			Message: "unsupported types for binary operation: array int",
+		},
+	}, results[2].Failures)
+
+	assert.Equal("test_builtin_error", results[3].Name)
+	assert.Equal([]Failure{
+		{
+			File:    "testdata/math_test.monkey",
+			Line:    21,
+			Message: "argument to `len` not supported, got int",
+		},
+	}, results[3].Failures)
+	assert.Equal("after\n", results[3].Output)
+
+	assert.Equal("test_exit", results[4].Name)
+	assert.Equal([]Failure{
+		{
+			File:    "testdata/math_test.monkey",
+			Line:    26,
+			Message: "exit called with status 3",
+		},
+	}, results[4].Failures)
+	assert.Equal("", results[4].Output)
+
+	assert.Equal("test_checks_error", results[5].Name)
+	assert.True(results[5].Passed())
+}
+
+func TestRunFileFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	results, err := RunFile("testdata/math_test.monkey", regexp.MustCompile("add$"))
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal("test_add", results[0].Name)
+}
+
+func TestWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	results, err := RunFile("testdata/math_test.monkey", nil)
+	assert.NoError(err)
+
+	tests := []struct {
+		format   string
+		expected []string
+	}{
+		{FormatText, []string{
+			"--- PASS: test_add",
+			"--- FAIL: test_add_fails",
+			"    testdata/math_test.monkey:10: add(1, 1) != 3",
+			"2 passed, 4 failed, 6 total",
+		}},
+		{FormatTAP, []string{
+			"1..6",
+			"ok 1 - testdata/math_test.monkey: test_add",
+			"not ok 2 - testdata/math_test.monkey: test_add_fails",
+		}},
+		{FormatJUnit, []string{
+			`<testsuite name="testdata/math_test.monkey" tests="6" failures="4"`,
+			`<failure message="add(1, 1) != 3">`,
+		}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		assert.NoError(Write(&buf, tt.format, results))
+		for _, s := range tt.expected {
+			assert.True(strings.Contains(buf.String(), s), "%q not in %q", s, buf.String())
+		}
+	}
+
+	assert.Error(Write(&bytes.Buffer{}, "bogus", results))
+}
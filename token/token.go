@@ -12,6 +12,8 @@ const (
 
 	// COMMENT a line comment, e.g: # this is a comment
 	COMMENT = "COMMENT"
+	// DOC_COMMENT a line of a doc comment, e.g: /// Returns the sum of a and b
+	DOC_COMMENT = "DOC_COMMENT"
 
 	//
 	// Identifiers + literals
@@ -23,6 +25,8 @@ const (
 	INT = "INT"
 	// STRING a string, e.g: "1234"
 	STRING = "STRING"
+	// TEMPLATE an interpolated string, e.g: "x=${x}"
+	TEMPLATE = "TEMPLATE"
 
 	//
 	// Operators
@@ -42,6 +46,29 @@ const (
 	DIVIDE = "/"
 	// MODULO the modulo operator
 	MODULO = "%"
+	// POWER the exponentiation operator
+	POWER = "**"
+
+	//
+	// Compound assignment operators
+	//
+
+	// PLUS_ASSIGN the addition assignment operator
+	PLUS_ASSIGN = "+="
+	// MINUS_ASSIGN the substraction assignment operator
+	MINUS_ASSIGN = "-="
+	// MULTIPLY_ASSIGN the multiplication assignment operator
+	MULTIPLY_ASSIGN = "*="
+	// DIVIDE_ASSIGN the division assignment operator
+	DIVIDE_ASSIGN = "/="
+	// MODULO_ASSIGN the modulo assignment operator
+	MODULO_ASSIGN = "%="
+	// BitwiseAND_ASSIGN the bitwise AND assignment operator
+	BitwiseAND_ASSIGN = "&="
+	// BitwiseOR_ASSIGN the bitwise OR assignment operator
+	BitwiseOR_ASSIGN = "|="
+	// BitwiseXOR_ASSIGN the bitwise XOR assignment operator
+	BitwiseXOR_ASSIGN = "^="
 
 	//
 	// Bitwise / Logical operators
@@ -55,6 +82,10 @@ const (
 	BitwiseXOR = "^"
 	// Bitwise NOT
 	BitwiseNOT = "~"
+	// LSHIFT the left shift operator
+	LSHIFT = "<<"
+	// RSHIFT the right shift operator
+	RSHIFT = ">>"
 
 	//
 	// Logical operators
@@ -98,6 +129,10 @@ const (
 	COLON = ":"
 	// DOT a dot
 	DOT = "."
+	// ELLIPSIS three dots
+	ELLIPSIS = "..."
+	// ARROW the arrow separating a match arm's pattern from its body
+	ARROW = "=>"
 
 	// LPAREN a left paranthesis
 	LPAREN = "("
@@ -132,6 +167,14 @@ const (
 	RETURN = "RETURN"
 	// WHILE the `while` keyword (while)
 	WHILE = "WHILE"
+	// MACRO the `macro` keyword (macro)
+	MACRO = "MACRO"
+	// MATCH the `match` keyword (match)
+	MATCH = "MATCH"
+	// STRUCT the `struct` keyword (struct)
+	STRUCT = "STRUCT"
+	// CONST the `const` keyword (const)
+	CONST = "CONST"
 )
 
 var keywords = map[string]Type{
@@ -143,15 +186,22 @@ var keywords = map[string]Type{
 	"else":   ELSE,
 	"return": RETURN,
 	"while":  WHILE,
+	"macro":  MACRO,
+	"match":  MATCH,
+	"struct": STRUCT,
+	"const":  CONST,
 }
 
 // Type represents the type of a token
 type Type string
 
-// Token holds a single token type and its literal value
+// Token holds a single token type and its literal value as well as the
+// line and column in the source input where the token starts
 type Token struct {
 	Type    Type
 	Literal string
+	Line    int
+	Column  int
 }
 
 // LookupIdent looks up the identifier in ident and returns the appropriate
@@ -13,7 +13,7 @@ syntax case match
 
 syntax keyword xType true false null
 
-syntax keyword xKeyword fn if else return while
+syntax keyword xKeyword fn if else return while match struct
 
 syntax keyword xFunction len input print first last rest push pop exit assert
 
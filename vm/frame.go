@@ -21,8 +21,11 @@ func NewFrame(cl *object.Closure, basePointer int) *Frame {
 	return f
 }
 
-// NextOp ...
+// NextOp returns the opcode of the next instruction or 0 if there is none
 func (f *Frame) NextOp() code.Opcode {
+	if f.ip+1 >= len(f.Instructions()) {
+		return 0
+	}
 	return code.Opcode(f.Instructions()[f.ip+1])
 }
 
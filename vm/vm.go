@@ -5,12 +5,14 @@ package vm
 // the lexer/parser and compiler in previous steps
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/prologic/monkey-lang/code"
 	"github.com/prologic/monkey-lang/compiler"
+	"github.com/prologic/monkey-lang/cover"
 	"github.com/prologic/monkey-lang/object"
 )
 
@@ -20,12 +22,32 @@ const (
 	MaxGlobals = 65536
 )
 
+var (
+	// ErrLimitExceeded is returned by Run when Limit instructions have been
+	// executed without the program finishing
+	ErrLimitExceeded = errors.New("instruction limit exceeded")
+)
+
 var (
 	True  = &object.Boolean{Value: true}
 	False = &object.Boolean{Value: false}
 	Null  = &object.Null{}
 )
 
+// isInt64 reports whether obj is an Integer, and not a BigInteger
+func isInt64(obj object.Object) bool {
+	_, ok := obj.(*object.Integer)
+	return ok
+}
+
+// orNull returns Null for a global or local slot that was never assigned
+func orNull(obj object.Object) object.Object {
+	if obj == nil {
+		return Null
+	}
+	return obj
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -50,6 +72,14 @@ func isTruthy(obj object.Object) bool {
 type VM struct {
 	Debug bool
 
+	// Coverage, if non-nil, records the number of times the statements on
+	// each source line are executed
+	Coverage cover.Counts
+
+	// Limit, if non-zero, is the maximum number of instructions Run executes
+	// before returning ErrLimitExceeded
+	Limit int
+
 	constants []object.Object
 
 	frames      []*Frame
@@ -59,15 +89,26 @@ type VM struct {
 	sp    int // Always points to the next value. Top of stack is stack[sp-1]
 
 	globals []object.Object
+
+	// steps is the number of instructions Run has executed
+	steps int
+
+	// floor is the number of frames of a metamethod's caller which a tail
+	// call must not replace
+	floor int
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -76,7 +117,10 @@ func (vm *VM) popFrame() *Frame {
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -97,7 +141,10 @@ func New(bytecode *compiler.Bytecode) *VM {
 }
 
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -117,27 +164,45 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *
 	}
 }
 
-func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
-	}
-
+// push pushes o onto the stack. Run verifies that no function pushes more
+// values than the stack holds, so push does not check for overflow.
+func (vm *VM) push(o object.Object) {
 	vm.stack[vm.sp] = o
 	vm.sp++
-
-	return nil
 }
 
+// pop removes and returns the value at the top of the stack. Run verifies
+// that no instruction pops more values than its frame holds, so pop does
+// not check for underflow.
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
 	return o
 }
 
+// popN removes and returns the n values at the top of the stack, the top
+// one last. The values are only valid until the next push.
+func (vm *VM) popN(n int) []object.Object {
+	values := vm.stack[vm.sp-n : vm.sp]
+	vm.sp -= n
+	return values
+}
+
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	if op == code.Add {
+		if hook, ok := object.BinaryMetamethod(left, right, "__add"); ok {
+			result, err := vm.callFunction(hook, left, right)
+			if err != nil {
+				return err
+			}
+			vm.push(result)
+			return nil
+		}
+	}
+
 	leftType := left.Type()
 	rightType := right.Type()
 
@@ -145,16 +210,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 
 	// {"a": 1} + {"b": 2}
 	case op == code.Add && left.Type() == object.HASH && right.Type() == object.HASH:
-		leftVal := left.(*object.Hash).Pairs
-		rightVal := right.(*object.Hash).Pairs
-		pairs := make(map[object.HashKey]object.HashPair)
-		for k, v := range leftVal {
-			pairs[k] = v
-		}
-		for k, v := range rightVal {
-			pairs[k] = v
-		}
-		return vm.push(&object.Hash{Pairs: pairs})
+		vm.push(left.(*object.Hash).Merge(right.(*object.Hash)))
+		return nil
 
 	// [1] + [2]
 	case op == code.Add && left.Type() == object.ARRAY && right.Type() == object.ARRAY:
@@ -162,37 +219,42 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		rightVal := right.(*object.Array).Elements
 		elements := make([]object.Object, len(leftVal)+len(rightVal))
 		elements = append(leftVal, rightVal...)
-		return vm.push(&object.Array{Elements: elements})
+		vm.push(&object.Array{Elements: elements})
+		return nil
 
 	// [1] * 3
-	case op == code.Mul && left.Type() == object.ARRAY && right.Type() == object.INTEGER:
-		leftVal := left.(*object.Array).Elements
-		rightVal := int(right.(*object.Integer).Value)
-		elements := leftVal
-		for i := rightVal; i > 1; i-- {
-			elements = append(elements, leftVal...)
+	case op == code.Mul && left.Type() == object.ARRAY && isInt64(right):
+		result, err := left.(*object.Array).Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return err
 		}
-		return vm.push(&object.Array{Elements: elements})
+		vm.push(result)
+		return nil
 	// 3 * [1]
-	case op == code.Mul && left.Type() == object.INTEGER && right.Type() == object.ARRAY:
-		leftVal := int(left.(*object.Integer).Value)
-		rightVal := right.(*object.Array).Elements
-		elements := rightVal
-		for i := leftVal; i > 1; i-- {
-			elements = append(elements, rightVal...)
+	case op == code.Mul && isInt64(left) && right.Type() == object.ARRAY:
+		result, err := right.(*object.Array).Repeat(left.(*object.Integer).Value)
+		if err != nil {
+			return err
 		}
-		return vm.push(&object.Array{Elements: elements})
+		vm.push(result)
+		return nil
 
 	// " " * 4
-	case op == code.Mul && left.Type() == object.STRING && right.Type() == object.INTEGER:
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.Integer).Value
-		return vm.push(&object.String{Value: strings.Repeat(leftVal, int(rightVal))})
+	case op == code.Mul && left.Type() == object.STRING && isInt64(right):
+		result, err := left.(*object.String).Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return err
+		}
+		vm.push(result)
+		return nil
 	// 4 * " "
-	case op == code.Mul && left.Type() == object.INTEGER && right.Type() == object.STRING:
-		leftVal := left.(*object.Integer).Value
-		rightVal := right.(*object.String).Value
-		return vm.push(&object.String{Value: strings.Repeat(rightVal, int(leftVal))})
+	case op == code.Mul && isInt64(left) && right.Type() == object.STRING:
+		result, err := right.(*object.String).Repeat(left.(*object.Integer).Value)
+		if err != nil {
+			return err
+		}
+		vm.push(result)
+		return nil
 
 	case leftType == object.BOOLEAN && rightType == object.BOOLEAN:
 		return vm.executeBinaryBooleanOperation(op, left, right)
@@ -217,7 +279,8 @@ func (vm *VM) executeBinaryStringOperation(
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	vm.push(&object.String{Value: leftValue + rightValue})
+	return nil
 }
 
 func (vm *VM) executeBinaryBooleanOperation(
@@ -238,81 +301,128 @@ func (vm *VM) executeBinaryBooleanOperation(
 		return fmt.Errorf("unknown boolean operator: %d", op)
 	}
 
-	return vm.push(&object.Boolean{Value: result})
+	vm.push(&object.Boolean{Value: result})
+	return nil
 }
 
 func (vm *VM) executeBinaryIntegerOperation(
 	op code.Opcode,
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	var result int64
+	var operator string
 
 	switch op {
 	case code.Add:
-		result = leftValue + rightValue
+		operator = "+"
 	case code.Sub:
-		result = leftValue - rightValue
+		operator = "-"
 	case code.Mul:
-		result = leftValue * rightValue
+		operator = "*"
 	case code.Div:
-		result = leftValue / rightValue
+		operator = "/"
 	case code.Mod:
-		result = leftValue % rightValue
+		operator = "%"
 	case code.BitwiseOR:
-		result = leftValue | rightValue
+		operator = "|"
 	case code.BitwiseXOR:
-		result = leftValue ^ rightValue
+		operator = "^"
 	case code.BitwiseAND:
-		result = leftValue & rightValue
+		operator = "&"
+	case code.LeftShift:
+		operator = "<<"
+	case code.RightShift:
+		operator = ">>"
+	case code.Pow:
+		operator = "**"
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	result, err := object.IntegerOperation(operator, left, right)
+	if err != nil {
+		return err
+	}
+	vm.push(result)
+	return nil
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER || right.Type() == object.INTEGER {
+	if ok, err := vm.executeComparisonMetamethod(op, left, right); ok {
+		return err
+	}
+
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
-	if left.Type() == object.STRING || right.Type() == object.STRING {
+	if left.Type() == object.STRING && right.Type() == object.STRING {
 		return vm.executeStringComparison(op, left, right)
 	}
 
 	switch op {
 	case code.Equal:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		vm.push(nativeBoolToBooleanObject(right == left))
+		return nil
 	case code.NotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		vm.push(nativeBoolToBooleanObject(right != left))
+		return nil
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)",
 			op, left.Type(), right.Type())
 	}
 }
 
+// executeComparisonMetamethod compares left and right with the __eq or __lt
+// metamethod of either operand and reports whether one was called. As `<` is
+// compiled to `>` with swapped operands a > b calls __lt(b, a) and a >= b is
+// the negation of __lt(a, b).
+func (vm *VM) executeComparisonMetamethod(
+	op code.Opcode,
+	left, right object.Object,
+) (bool, error) {
+	name, negate := "__eq", op == code.NotEqual
+	switch op {
+	case code.GreaterThan:
+		name, left, right = "__lt", right, left
+	case code.GreaterThanEqual:
+		name, negate = "__lt", true
+	}
+
+	hook, ok := object.BinaryMetamethod(left, right, name)
+	if !ok {
+		return false, nil
+	}
+
+	result, err := vm.callFunction(hook, left, right)
+	if err != nil {
+		return true, err
+	}
+	vm.push(nativeBoolToBooleanObject(isTruthy(result) != negate))
+	return true, nil
+}
+
 func (vm *VM) executeIntegerComparison(
 	op code.Opcode,
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	cmp := object.CompareIntegers(left, right)
 
 	switch op {
 	case code.Equal:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		vm.push(nativeBoolToBooleanObject(cmp == 0))
+		return nil
 	case code.NotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		vm.push(nativeBoolToBooleanObject(cmp != 0))
+		return nil
 	case code.GreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		vm.push(nativeBoolToBooleanObject(cmp > 0))
+		return nil
 	case code.GreaterThanEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+		vm.push(nativeBoolToBooleanObject(cmp >= 0))
+		return nil
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -327,13 +437,17 @@ func (vm *VM) executeStringComparison(
 
 	switch op {
 	case code.Equal:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return nil
 	case code.NotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return nil
 	case code.GreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		return nil
 	case code.GreaterThanEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+		vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+		return nil
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -341,8 +455,9 @@ func (vm *VM) executeStringComparison(
 
 func (vm *VM) executeBitwiseNotOperator() error {
 	operand := vm.pop()
-	if i, ok := operand.(*object.Integer); ok {
-		return vm.push(&object.Integer{Value: ^i.Value})
+	if object.IsInteger(operand) {
+		vm.push(object.InvertInteger(operand))
+		return nil
 	}
 	return fmt.Errorf("expected int got=%T", operand)
 }
@@ -352,30 +467,37 @@ func (vm *VM) executeNotOperator() error {
 
 	switch operand {
 	case True:
-		return vm.push(False)
+		vm.push(False)
+		return nil
 	case False:
-		return vm.push(True)
+		vm.push(True)
+		return nil
 	case Null:
-		return vm.push(True)
+		vm.push(True)
+		return nil
 	default:
-		return vm.push(False)
+		vm.push(False)
+		return nil
 	}
 }
 
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
-	if i, ok := operand.(*object.Integer); ok {
-		return vm.push(&object.Integer{Value: -i.Value})
+	if object.IsInteger(operand) {
+		vm.push(object.NegateInteger(operand))
+		return nil
 	}
 	return fmt.Errorf("expected int got=%T", operand)
 }
 
 func (vm *VM) executeSetItem(left, index, value object.Object) error {
 	switch {
-	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+	case left.Type() == object.ARRAY && object.IsInteger(index):
 		return vm.executeArraySetItem(left, index, value)
 	case left.Type() == object.HASH:
 		return vm.executeHashSetItem(left, index, value)
+	case isInstance(left):
+		return vm.executeInstanceSetItem(left, index, value)
 	default:
 		return fmt.Errorf(
 			"set item operation not supported: left=%s index=%s",
@@ -394,6 +516,8 @@ func (vm *VM) executeGetItem(left, index object.Object) error {
 		return vm.executeArrayGetItem(left, index)
 	case left.Type() == object.HASH:
 		return vm.executeHashGetItem(left, index)
+	case isInstance(left):
+		return vm.executeInstanceGetItem(left, index)
 	default:
 		return fmt.Errorf(
 			"index operator not supported: left=%s index=%s",
@@ -402,72 +526,112 @@ func (vm *VM) executeGetItem(left, index object.Object) error {
 	}
 }
 
+func (vm *VM) executeGetSlice(left, start, end object.Object) error {
+	switch left := left.(type) {
+	case *object.String:
+		from, to, err := object.SliceBounds(left.Len(), start, end)
+		if err != nil {
+			return err
+		}
+		vm.push(left.Slice(from, to))
+		return nil
+	case *object.Array:
+		from, to, err := object.SliceBounds(len(left.Elements), start, end)
+		if err != nil {
+			return err
+		}
+		vm.push(left.Slice(from, to))
+		return nil
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
 func (vm *VM) executeStringGetItem(str, index object.Object) error {
 	stringObject := str.(*object.String)
-	i := index.(*object.Integer).Value
-	max := int64(len(stringObject.Value) - 1)
-
-	if i < 0 || i > max {
-		return vm.push(&object.String{Value: ""})
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return object.IndexOutOfBounds(index)
 	}
 
-	return vm.push(&object.String{Value: string(stringObject.Value[i])})
+	char, _ := stringObject.CharAt(i.Value)
+	vm.push(&object.String{Value: char})
+	return nil
 }
 
 func (vm *VM) executeStringIndex(str, index object.Object) error {
 	stringObject := str.(*object.String)
 	substr := index.(*object.String).Value
 
-	return vm.push(
+	vm.push(
 		&object.Integer{
-			Value: int64(strings.Index(stringObject.Value, substr)),
+			Value: int64(stringObject.IndexOf(substr)),
 		},
 	)
+	return nil
 }
 
 func (vm *VM) executeArrayGetItem(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return object.IndexOutOfBounds(index)
+	}
+	i := idx.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if i < 0 || i > max {
-		return vm.push(Null)
+		vm.push(Null)
+		return nil
 	}
 
-	return vm.push(arrayObject.Elements[i])
+	vm.push(arrayObject.Elements[i])
+	return nil
 }
 
 func (vm *VM) executeArraySetItem(array, index, value object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
+	if arrayObject.Frozen {
+		return fmt.Errorf("cannot modify frozen array")
+	}
+
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return object.IndexOutOfBounds(index)
+	}
+	i := idx.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if i < 0 || i > max {
-		return fmt.Errorf("index out of bounds: %d", i)
+		return object.IndexOutOfBounds(index)
 	}
 
 	arrayObject.Elements[i] = value
-	return vm.push(Null)
+	vm.push(Null)
+	return nil
 }
 
 func (vm *VM) executeHashGetItem(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	value, ok, err := hashObject.Index(index, vm.callFunction)
+	if err != nil {
+		return err
 	}
-
-	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		return vm.push(Null)
+		vm.push(Null)
+		return nil
 	}
 
-	return vm.push(pair.Value)
+	vm.push(value)
+	return nil
 }
 
 func (vm *VM) executeHashSetItem(hash, index, value object.Object) error {
 	hashObject := hash.(*object.Hash)
+	if hashObject.Frozen {
+		return fmt.Errorf("cannot modify frozen hash")
+	}
 
 	key, ok := index.(object.Hashable)
 	if !ok {
@@ -475,9 +639,35 @@ func (vm *VM) executeHashSetItem(hash, index, value object.Object) error {
 	}
 
 	hashed := key.HashKey()
-	hashObject.Pairs[hashed] = object.HashPair{Key: index, Value: value}
+	hashObject.Set(hashed, object.HashPair{Key: index, Value: value})
 
-	return vm.push(Null)
+	vm.push(Null)
+	return nil
+}
+
+func isInstance(obj object.Object) bool {
+	_, ok := obj.(*object.Instance)
+	return ok
+}
+
+func (vm *VM) executeInstanceGetItem(instance, index object.Object) error {
+	value, err := instance.(*object.Instance).Get(index)
+	if err != nil {
+		return err
+	}
+
+	vm.push(value)
+	return nil
+}
+
+func (vm *VM) executeInstanceSetItem(instance, index, value object.Object) error {
+	err := instance.(*object.Instance).Set(index, value)
+	if err != nil {
+		return err
+	}
+
+	vm.push(Null)
+	return nil
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
@@ -490,8 +680,30 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	return &object.Array{Elements: elements}
 }
 
+func (vm *VM) buildString(startIndex, endIndex int) (object.Object, error) {
+	var b strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		str, err := object.ToString(vm.stack[i], vm.callFunction)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(str)
+	}
+
+	return &object.String{Value: b.String()}, nil
+}
+
+// pushUnpacked pushes the values of a destructured array or hash in reverse
+// order so the first value is on top of the stack and is bound first
+func (vm *VM) pushUnpacked(values []object.Object) {
+	for i := len(values) - 1; i >= 0; i-- {
+		vm.push(values[i])
+	}
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
@@ -504,10 +716,10 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey.HashKey(), pair)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) executeCall(numArgs int) error {
@@ -517,7 +729,14 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
+	case *object.Struct:
+		return vm.callStruct(callee, numArgs)
+	case *object.BoundMethod:
+		return vm.callBoundMethod(callee, numArgs)
 	default:
+		if hook, ok := object.Metamethod(callee, "__call"); ok {
+			return vm.callWithSelf(hook, callee, numArgs)
+		}
 		return fmt.Errorf(
 			"calling non-closure and non-builtin: %T %v",
 			callee, callee,
@@ -526,26 +745,64 @@ func (vm *VM) executeCall(numArgs int) error {
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			cl.Fn.NumParameters, numArgs)
+	fn := cl.Fn
+	err := object.CheckArity(fn.NumParameters, fn.NumDefaults, fn.Variadic, numArgs)
+	if err != nil {
+		return err
+	}
+
+	// The arguments are padded and the rest parameter pushed below the
+	// frame's locals so check they fit before pushing anything
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	// Collect any extra arguments into the rest parameter and pad missing
+	// arguments with nulls until their defaults are evaluated
+	var rest *object.Array
+	if fn.Variadic {
+		extra := 0
+		if numArgs > fn.NumParameters {
+			extra = numArgs - fn.NumParameters
+		}
+		rest = &object.Array{Elements: make([]object.Object, extra)}
+		copy(rest.Elements, vm.stack[vm.sp-extra:vm.sp])
+		vm.sp -= extra
+		numArgs -= extra
+	}
+
+	entry := 0
+	if missing := fn.NumParameters - numArgs; missing > 0 {
+		entry = fn.Entries[fn.NumDefaults-missing]
+		for ; numArgs < fn.NumParameters; numArgs++ {
+			vm.push(Null)
+		}
+	}
+
+	if rest != nil {
+		vm.push(rest)
+		numArgs++
 	}
 
 	// Optimize tail calls and avoid creating a new frame
-	if cl.Fn == vm.currentFrame().cl.Fn {
+	if cl.Fn == vm.currentFrame().cl.Fn && vm.framesIndex > vm.floor {
 		nextOp := vm.currentFrame().NextOp()
 		if nextOp == code.Return {
 			for p := 0; p < numArgs; p++ {
 				vm.stack[vm.currentFrame().basePointer+p] = vm.stack[vm.sp-numArgs+p]
 			}
-			vm.sp -= numArgs + 1
-			vm.currentFrame().ip = -1 // reset IP to beginning of the frame
+			vm.sp = vm.currentFrame().basePointer + fn.NumLocals
+			vm.currentFrame().ip = entry - 1 // reset IP to the entry of the frame
 			return nil
 		}
 	}
 
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	frame := NewFrame(cl, basePointer)
+	frame.ip = entry - 1
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
 
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
@@ -555,7 +812,10 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := builtin.Fn(args...)
+	result, err := object.CallBuiltin(builtin, vm.callFunction, args...)
+	if err != nil {
+		return err
+	}
 	vm.sp = vm.sp - numArgs - 1
 
 	if result != nil {
@@ -567,6 +827,64 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+func (vm *VM) callStruct(st *object.Struct, numArgs int) error {
+	instance, err := st.New(vm.stack[vm.sp-numArgs : vm.sp])
+	if err != nil {
+		return err
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	vm.push(instance)
+	return nil
+}
+
+// callBoundMethod calls the bound method's method with the instance it is
+// bound to inserted before the arguments as self
+func (vm *VM) callBoundMethod(bm *object.BoundMethod, numArgs int) error {
+	return vm.callWithSelf(bm.Method, bm.Self, numArgs)
+}
+
+// callWithSelf calls fn in place of the callee with self inserted before
+// the arguments
+func (vm *VM) callWithSelf(fn, self object.Object, numArgs int) error {
+	if vm.sp >= len(vm.stack) {
+		return fmt.Errorf("stack overflow")
+	}
+
+	copy(vm.stack[vm.sp-numArgs+1:vm.sp+1], vm.stack[vm.sp-numArgs:vm.sp])
+	vm.stack[vm.sp-numArgs-1] = fn
+	vm.stack[vm.sp-numArgs] = self
+	vm.sp++
+
+	return vm.executeCall(numArgs + 1)
+}
+
+// callFunction calls fn with args and runs it to completion returning its
+// result. It is used to call metamethods while executing an instruction.
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	if vm.sp+1+len(args) > len(vm.stack) {
+		return nil, fmt.Errorf("stack overflow")
+	}
+
+	depth, floor := vm.framesIndex, vm.floor
+	defer func() { vm.floor = floor }()
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	vm.floor = depth
+	if err := vm.executeCall(len(args)); err != nil {
+		return nil, err
+	}
+	if err := vm.run(depth); err != nil {
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
@@ -574,34 +892,280 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
 
+	values := vm.popN(numFree)
 	free := make([]object.Object, numFree)
-	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
-	}
-	vm.sp = vm.sp - numFree
+	copy(free, values)
 
 	closure := &object.Closure{Fn: function, Free: free}
-	return vm.push(closure)
+	vm.push(closure)
+	return nil
+}
+
+// Line returns the source line of the statement currently being executed
+// or 0 if unknown
+func (vm *VM) Line() int {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.SourceMap.Line(frame.ip)
 }
 
 func (vm *VM) LastPopped() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
 	return vm.stack[vm.sp]
 }
 
+// Run executes the bytecode until it finishes, an error occurs or Limit
+// instructions have been executed. The bytecode is verified before it is
+// run so malformed bytecode results in an error rather than a panic.
 func (vm *VM) Run() error {
+	if err := vm.verify(); err != nil {
+		return err
+	}
+
+	vm.steps = 0
+	return vm.run(0)
+}
+
+// verify checks the instructions of the main function and of the compiled
+// functions among the constants before they are run so that operands which
+// index constants, builtins, locals or jump within the instructions need not
+// be checked while running. It also checks that no instruction pops more
+// values than its frame holds and grows the stack so that a frame starting
+// below StackSize has room for the most values any function pushes, so the
+// stack need not be checked on every push and pop either.
+func (vm *VM) verify() error {
+	height, err := vm.verifyFunction(vm.frames[0].cl.Fn)
+	if err != nil {
+		return fmt.Errorf("invalid bytecode: %s", err)
+	}
+
+	for i, constant := range vm.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			h, err := vm.verifyFunction(fn)
+			if err != nil {
+				return fmt.Errorf("invalid bytecode in constant %d: %s", i, err)
+			}
+			height = maxInt(height, h)
+		}
+	}
+
+	if size := StackSize + height; len(vm.stack) < size {
+		stack := make([]object.Object, size)
+		copy(stack, vm.stack)
+		vm.stack = stack
+	}
+
+	return nil
+}
+
+// verifyFunction verifies the instructions of fn and returns the maximum
+// number of values they push onto the stack above its locals
+func (vm *VM) verifyFunction(fn *object.CompiledFunction) (int, error) {
+	ins := fn.Instructions
+	if err := ins.Verify(); err != nil {
+		return 0, err
+	}
+
+	for _, entry := range fn.Entries {
+		if entry < 0 || entry > len(ins) {
+			return 0, fmt.Errorf("invalid entry %04d", entry)
+		}
+	}
+
+	parameters := fn.NumParameters
+	if fn.Variadic {
+		parameters++
+	}
+	if fn.NumLocals < parameters {
+		return 0, fmt.Errorf("%d locals for %d parameters", fn.NumLocals, parameters)
+	}
+
+	for ip := 0; ip < len(ins); {
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+
+		switch op {
+		case code.LoadConstant, code.MakeClosure, code.MakeStruct:
+			index := int(code.ReadUint16(ins[ip+1:]))
+			if index >= len(vm.constants) {
+				return 0, fmt.Errorf("constant %d out of range at %04d", index, ip)
+			}
+			constant := vm.constants[index]
+			if _, ok := constant.(*object.CompiledFunction); ok != (op == code.MakeClosure) {
+				return 0, fmt.Errorf("invalid constant %d for %s at %04d", index, def.Name, ip)
+			}
+			if _, ok := constant.(*object.Struct); ok != (op == code.MakeStruct) {
+				return 0, fmt.Errorf("invalid constant %d for %s at %04d", index, def.Name, ip)
+			}
+
+		case code.LoadBuiltin:
+			if index := int(code.ReadUint8(ins[ip+1:])); index >= len(object.BuiltinsIndex) {
+				return 0, fmt.Errorf("builtin %d out of range at %04d", index, ip)
+			}
+
+		case code.LoadLocal, code.BindLocal, code.AssignLocal:
+			if index := int(code.ReadUint8(ins[ip+1:])); index >= fn.NumLocals {
+				return 0, fmt.Errorf("local %d out of range at %04d", index, ip)
+			}
+
+		case code.MakeHash:
+			if n := code.ReadUint16(ins[ip+1:]); n%2 != 0 {
+				return 0, fmt.Errorf("odd number of hash elements %d at %04d", n, ip)
+			}
+		}
+
+		ip += 1 + def.Width()
+	}
+
+	return verifyStack(fn)
+}
+
+// verifyStack follows every path through the instructions of fn tracking
+// the least and the most values on the stack before each instruction. It
+// returns an error if an instruction may pop more values than are on the
+// stack and otherwise the most values on the stack.
+func verifyStack(fn *object.CompiledFunction) (int, error) {
+	type bounds struct {
+		min, max int
+		seen     bool
+	}
+
+	ins := fn.Instructions
+	heights := make([]bounds, len(ins)+1)
+	var pending []int
+
+	visit := func(ip, min, max int) {
+		h := &heights[ip]
+		switch {
+		case !h.seen:
+			*h = bounds{min: min, max: max, seen: true}
+		case min < h.min || max > h.max:
+			h.min, h.max = minInt(h.min, min), maxInt(h.max, max)
+		default:
+			return
+		}
+		pending = append(pending, ip)
+	}
+
+	visit(0, 0, 0)
+	for _, entry := range fn.Entries {
+		visit(entry, 0, 0)
+	}
+
+	height := 0
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if ip == len(ins) {
+			continue
+		}
+
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		pops, pushes := stackEffect(op, operands)
+		h := heights[ip]
+		if h.min < pops {
+			return 0, fmt.Errorf("stack underflow at %04d", ip)
+		}
+		min, max := h.min-pops+pushes, h.max-pops+pushes
+		if max > StackSize {
+			return 0, fmt.Errorf("stack overflow at %04d", ip)
+		}
+		height = maxInt(height, max)
+
+		switch op {
+		case code.Jump:
+			visit(operands[0], min, max)
+		case code.JumpIfFalse:
+			visit(operands[0], min, max)
+			visit(ip+1+read, min, max)
+		case code.Return:
+		default:
+			visit(ip+1+read, min, max)
+		}
+	}
+
+	return height, nil
+}
+
+// stackEffect returns the number of values the instruction op with operands
+// pops off the stack and the number it then pushes. A call pops the callee
+// and its arguments and pushes the result when the callee returns.
+func stackEffect(op code.Opcode, operands []int) (int, int) {
+	switch op {
+	case code.LoadConstant, code.LoadBuiltin, code.LoadGlobal, code.LoadLocal,
+		code.LoadFree, code.LoadTrue, code.LoadFalse, code.LoadNull,
+		code.MakeStruct:
+		return 0, 1
+	case code.AssignGlobal, code.AssignLocal, code.BindGlobal, code.BindLocal,
+		code.Not, code.BitwiseNOT, code.Minus, code.MatchArray:
+		return 1, 1
+	case code.MakeArray, code.MakeHash, code.BuildString, code.MakeClosure:
+		n := operands[0]
+		if op == code.MakeClosure {
+			n = operands[1]
+		}
+		return n, 1
+	case code.UnpackArray:
+		if operands[1] == 1 {
+			return 1, operands[0] + 1
+		}
+		return 1, operands[0]
+	case code.UnpackHash:
+		return operands[0] + 1, operands[0]
+	case code.MatchHash, code.DefineMethods:
+		return operands[0] + 1, 1
+	case code.SetItem, code.GetSlice:
+		return 3, 1
+	case code.Call:
+		return operands[0] + 1, 1
+	case code.Return, code.JumpIfFalse, code.Pop:
+		return 1, 0
+	case code.DupTwo:
+		return 2, 4
+	case code.SetSelf, code.Jump, code.Noop:
+		return 0, 0
+	default:
+		// Binary operators, comparisons, GetItem, ExtendArray, CallSpread
+		// and MatchValue
+		return 2, 1
+	}
+}
+
+// run executes instructions until the frames above depth have returned
+func (vm *VM) run(depth int) error {
 	var (
 		ip  int
 		ins code.Instructions
 		op  code.Opcode
 	)
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	// Instructions are only counted if there is a limit
+	limited := vm.Limit > 0
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if limited {
+			if vm.steps >= vm.Limit {
+				return ErrLimitExceeded
+			}
+			vm.steps++
+		}
+
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
 
+		if vm.Coverage != nil {
+			if line, ok := vm.currentFrame().cl.Fn.SourceMap[ip]; ok {
+				vm.Coverage[line]++
+			}
+		}
+
 		if vm.Debug {
 			log.Printf(
 				"%-25s %-20s\n",
@@ -624,41 +1188,32 @@ func (vm *VM) Run() error {
 
 			builtin := object.BuiltinsIndex[builtinIndex]
 
-			err := vm.push(builtin)
-			if err != nil {
-				return err
-			}
+			vm.push(builtin)
 
 		case code.LoadConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.constants[constIndex])
-			if err != nil {
-				return err
-			}
+			vm.push(vm.constants[constIndex])
 
 		case code.AssignGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			vm.globals[globalIndex] = vm.pop()
 
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			value := vm.pop()
+			vm.globals[globalIndex] = value
+
+			vm.push(Null)
 
 		case code.AssignLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
+			value := vm.pop()
 			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			vm.stack[frame.basePointer+int(localIndex)] = value
 
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			vm.push(Null)
 
 		case code.BindGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
@@ -671,19 +1226,13 @@ func (vm *VM) Run() error {
 				vm.globals[globalIndex] = ref
 			}
 
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			vm.push(Null)
 
 		case code.LoadGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
-			if err != nil {
-				return err
-			}
+			vm.push(orNull(vm.globals[globalIndex]))
 
 		case code.BindLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
@@ -698,10 +1247,7 @@ func (vm *VM) Run() error {
 				vm.stack[frame.basePointer+int(localIndex)] = ref
 			}
 
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			vm.push(Null)
 
 		case code.LoadLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
@@ -709,45 +1255,36 @@ func (vm *VM) Run() error {
 
 			frame := vm.currentFrame()
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
-			if err != nil {
-				return err
-			}
+			vm.push(orNull(vm.stack[frame.basePointer+int(localIndex)]))
 
 		case code.LoadFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
-			if err != nil {
-				return err
+			if int(freeIndex) >= len(currentClosure.Free) {
+				return fmt.Errorf("free variable %d out of range", freeIndex)
 			}
+			vm.push(currentClosure.Free[freeIndex])
 
 		case code.SetSelf:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
 			currentClosure := vm.currentFrame().cl
+			if int(freeIndex) >= len(currentClosure.Free) {
+				return fmt.Errorf("free variable %d out of range", freeIndex)
+			}
 			currentClosure.Free[freeIndex] = currentClosure
 
 		case code.LoadTrue:
-			err := vm.push(True)
-			if err != nil {
-				return err
-			}
+			vm.push(True)
 
 		case code.LoadFalse:
-			err := vm.push(False)
-			if err != nil {
-				return err
-			}
+			vm.push(False)
 
 		case code.LoadNull:
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			vm.push(Null)
 
 		case code.MakeHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
@@ -759,10 +1296,7 @@ func (vm *VM) Run() error {
 			}
 			vm.sp = vm.sp - numElements
 
-			err = vm.push(hash)
-			if err != nil {
-				return err
-			}
+			vm.push(hash)
 
 		case code.MakeArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
@@ -771,10 +1305,118 @@ func (vm *VM) Run() error {
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			vm.push(array)
+
+		case code.BuildString:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str, err := vm.buildString(vm.sp-numParts, vm.sp)
 			if err != nil {
 				return err
 			}
+			vm.sp = vm.sp - numParts
+
+			vm.push(str)
+
+		case code.UnpackArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			value := vm.pop()
+			values, err := object.UnpackArray(value, numElements, rest)
+			if err != nil {
+				return err
+			}
+
+			vm.pushUnpacked(values)
+
+		case code.ExtendArray:
+			spread := vm.pop()
+			array, ok := vm.pop().(*object.Array)
+			if !ok {
+				return fmt.Errorf("invalid spread arguments")
+			}
+
+			elements, ok := spread.(*object.Array)
+			if !ok {
+				return fmt.Errorf("cannot spread %s", spread.Type())
+			}
+
+			array.Elements = append(array.Elements, elements.Elements...)
+			vm.push(array)
+
+		case code.UnpackHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			operands := vm.popN(numKeys + 1)
+			keys := make([]object.Object, numKeys)
+			copy(keys, operands[1:])
+
+			values, err := object.UnpackHash(operands[0], keys)
+			if err != nil {
+				return err
+			}
+
+			vm.pushUnpacked(values)
+
+		case code.MatchValue:
+			literal := vm.pop()
+			value := vm.pop()
+
+			vm.push(nativeBoolToBooleanObject(object.MatchLiteral(value, literal)))
+
+		case code.MatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			value := vm.pop()
+			matched := object.MatchArray(value, numElements, rest)
+			vm.push(nativeBoolToBooleanObject(matched))
+
+		case code.MatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			operands := vm.popN(numKeys + 1)
+			keys := make([]object.Object, numKeys)
+			copy(keys, operands[1:])
+
+			matched := object.MatchHash(operands[0], keys)
+			vm.push(nativeBoolToBooleanObject(matched))
+
+		case code.MakeStruct:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			template, ok := vm.constants[constIndex].(*object.Struct)
+			if !ok {
+				return fmt.Errorf("not a struct: %+v", vm.constants[constIndex])
+			}
+
+			vm.push(template.Copy())
+
+		case code.DefineMethods:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			operands := vm.popN(numElements + 1)
+			st, ok := operands[0].(*object.Struct)
+			if !ok {
+				return fmt.Errorf("not a struct: %+v", operands[0])
+			}
+			for i := 1; i+1 < len(operands); i += 2 {
+				name, ok := operands[i].(*object.String)
+				if !ok {
+					return fmt.Errorf("not a method name: %+v", operands[i])
+				}
+				st.Methods[name.Value] = operands[i+1]
+			}
+
+			vm.push(Null)
 
 		case code.MakeClosure:
 			constIndex := code.ReadUint16(ins[ip+1:])
@@ -788,7 +1430,8 @@ func (vm *VM) Run() error {
 
 		case code.Add, code.Sub, code.Mul, code.Div, code.Mod,
 			code.Or, code.And,
-			code.BitwiseOR, code.BitwiseXOR, code.BitwiseAND:
+			code.BitwiseOR, code.BitwiseXOR, code.BitwiseAND,
+			code.LeftShift, code.RightShift, code.Pow:
 
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
@@ -832,6 +1475,16 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.GetSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeGetSlice(left, start, end)
+			if err != nil {
+				return err
+			}
+
 		case code.Minus:
 			err := vm.executeMinusOperator()
 			if err != nil {
@@ -847,16 +1500,34 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.CallSpread:
+			value := vm.pop()
+			args, ok := value.(*object.Array)
+			if !ok {
+				return fmt.Errorf("invalid spread arguments")
+			}
+			if vm.sp+len(args.Elements) > len(vm.stack) {
+				return fmt.Errorf("stack overflow")
+			}
+			for _, arg := range args.Elements {
+				vm.push(arg)
+			}
+
+			err := vm.executeCall(len(args.Elements))
+			if err != nil {
+				return err
+			}
+
 		case code.Return:
+			if vm.framesIndex == 1 {
+				return fmt.Errorf("return outside of function at %04d", ip)
+			}
 			returnValue := vm.pop()
 
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
-			err := vm.push(returnValue)
-			if err != nil {
-				return err
-			}
+			vm.push(returnValue)
 
 		case code.JumpIfFalse:
 			pos := int(code.ReadUint16(ins[ip+1:]))
@@ -872,8 +1543,20 @@ func (vm *VM) Run() error {
 			vm.currentFrame().ip = pos - 1
 
 		case code.Pop:
-			vm.pop()
+			obj := vm.pop()
+			if object.ErrorFunction != nil {
+				if err, ok := obj.(*object.Error); ok {
+					object.ErrorFunction(err.Message)
+				}
+			}
 
+		case code.DupTwo:
+			for i := 0; i < 2; i++ {
+				vm.push(vm.stack[vm.sp-2])
+			}
+
+		default:
+			return fmt.Errorf("unknown opcode %d at %04d", op, ip)
 		}
 
 		if vm.Debug {
@@ -887,3 +1570,19 @@ func (vm *VM) Run() error {
 
 	return nil
 }
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of a and b
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
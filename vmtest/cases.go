@@ -0,0 +1,1102 @@
+package vmtest
+
+import "github.com/prologic/monkey-lang/object"
+
+// The tables below are run against every virtual machine by RunAll. Each
+// case's input is evaluated and the value of its last expression statement
+// compared with the expected value.
+
+var IntegerArithmetic = []Case{
+	{"1", 1},
+	{"2", 2},
+	{"1 + 2", 3},
+	{"1 - 2", -1},
+	{"1 * 2", 2},
+	{"4 / 2", 2},
+	{"50 / 2 * 2 + 10 - 5", 55},
+	{"5 * (2 + 10)", 60},
+	{"5 + 5 + 5 + 5 - 10", 10},
+	{"2 * 2 * 2 * 2 * 2", 32},
+	{"5 * 2 + 10", 20},
+	{"5 + 2 * 10", 25},
+	{"5 * (2 + 10)", 60},
+	{"-5", -5},
+	{"-10", -10},
+	{"-50 + 100 + -50", 0},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	{"!1", false},
+	{"~1", -2},
+	{"5 % 2", 1},
+	{"1 | 2", 3},
+	{"2 ^ 4", 6},
+	{"3 & 6", 2},
+	{"1 << 4", 16},
+	{"-256 >> 4", -16},
+	{"-1 >> 100", -1},
+	{"1 + 1 << 2", 8},
+	{"2 ** 10", 1024},
+	{"2 ** 3 ** 2", 512},
+	{"-2 ** 2", -4},
+	{"(-2) ** 3", -8},
+	{"str(1 << 64)", "18446744073709551616"},
+	{"str(3 ** 50)", "717897987691852588770249"},
+	{"(1 << 100) >> 98", 4},
+}
+
+var BigIntegers = []Case{
+	{"str(9223372036854775807 + 1)", "9223372036854775808"},
+	{"str(-9223372036854775807 - 2)", "-9223372036854775809"},
+	{"x := 9223372036854775807 + 1; x - 1", 9223372036854775807},
+	{"x := 9223372036854775807 * 4; x / 4 == 9223372036854775807", true},
+	{"fact := fn(n) { if (n == 0) { return 1 }; n * fact(n - 1) }; str(fact(25))", "15511210043330985984000000"},
+	{"typeof(9223372036854775807 * 2)", "int"},
+	{"x := 9223372036854775807 * 2; str([x > 1, x < 1, -x < 1, x >= x, x == x + 0, x != 1])", "[true, false, true, true, true, true]"},
+	{"str([-(9223372036854775807 * 3), ~(9223372036854775807 * 2)])", "[-27670116110564327421, -18446744073709551615]"},
+	{"x := 9223372036854775807 * 2; x % 1000", 614},
+	{"x := 9223372036854775807 * 2; x & 255", 254},
+	{`h := {9223372036854775807 * 2: "a"}; h[9223372036854775807 + 9223372036854775807]`, "a"},
+	{"str(9223372036854775808)", "9223372036854775808"},
+	{"str([0x1_0000_0000_0000_0000, 0o2000000000000000000000])", "[18446744073709551616, 18446744073709551616]"},
+	{"-9223372036854775808 == -9223372036854775807 - 1", true},
+	{"match (18446744073709551616) { 18446744073709551616 => 1, _ => 2 }", 1},
+	{`str(int("-100000000000000000000") / 10)`, "-10000000000000000000"},
+}
+
+var BooleanExpressions = []Case{
+	{"true", true},
+	{"false", false},
+	{"null", nil},
+	{"!true", false},
+	{"!false", true},
+	{"true && true", true},
+	{"false && true", false},
+	{"true && false", false},
+	{"false && false", false},
+	{"true || true", true},
+	{"false || true", true},
+	{"true || false", true},
+	{"false || false", false},
+	{"1 < 2", true},
+	{"1 > 2", false},
+	{"1 < 1", false},
+	{"1 > 1", false},
+	{"1 == 1", true},
+	{"1 != 1", false},
+	{"1 == 2", false},
+	{"1 != 2", true},
+	{"true == true", true},
+	{"false == false", true},
+	{"true == false", false},
+	{"true != false", true},
+	{"false != true", true},
+	{"(1 < 2) == true", true},
+	{"(1 < 2) == false", false},
+	{"(1 > 2) == true", false},
+	{"(1 > 2) == false", true},
+	{"(1 <= 2) == true", true},
+	{"(1 <= 2) == false", false},
+	{"(1 >= 2) == true", false},
+	{"(1 >= 2) == false", true},
+	{"!true", false},
+	{"!false", true},
+	{"!5", false},
+	{"!!true", true},
+	{"!!false", false},
+	{"!!5", true},
+	{"!(if (false) { 5; })", true},
+	{`"a" == "a"`, true},
+	{`"a" < "b"`, true},
+	{`"abc" == "abc"`, true},
+}
+
+var Conditionals = []Case{
+	{"if (true) { 10 }", 10},
+	{"if (true) { 10 } else { 20 }", 10},
+	{"if (false) { 10 } else { 20 } ", 20},
+	{"if (1) { 10 }", 10},
+	{"if (1 < 2) { 10 }", 10},
+	{"if (1 < 2) { 10 } else { 20 }", 10},
+	{"if (1 > 2) { 10 } else { 20 }", 20},
+	{"if (1 > 2) { 10 }", Null},
+	{"if (false) { 10 }", Null},
+	{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	{"if (true) { a := 5; }", Null},
+	{"if (true) { 10; a := 5; }", Null},
+	{"if (false) { 10 } else { b := 5; }", Null},
+	{"if (false) { 10 } else { 10; b := 5; }", Null},
+	{"if (true) { a := 5; } else { 10 }", Null},
+	{"x := 0; if (true) { x = 1; }; if (false) { x = 2; }; x", 1},
+	{"if (1 < 2) { 10 } else if (1 == 2) { 20 }", 10},
+	{"if (1 > 2) { 10 } else if (1 == 2) { 20 } else { 30 }", 30},
+	{"if (1 > 2) { 10 } else if (1 < 2) { 20 } else { 30 }", 20},
+	{"if (1 > 2) { 10 } else if (1 == 2) { 20 }", Null},
+	{"f := fn(n) { if (n < 0) { -1 } else if (n == 0) { 0 } else if (n < 10) { 1 } else { 2 } }; f(-5) + f(0) + f(5) + f(50)", 2},
+	{"x := 0; if (false) { x = 1 } else if (true) { x = 2 } else { x = 3 }; x", 2},
+}
+
+var Iterations = []Case{
+	{"while (false) { }", nil},
+	{"n := 0; while (n < 10) { n := n + 1 }; n", 10},
+	{"n := 10; while (n > 0) { n := n - 1 }; n", 0},
+	{"n := 0; while (n < 10) { n := n + 1 }", nil},
+	{"n := 10; while (n > 0) { n := n - 1 }", nil},
+	{"n := 0; while (n < 10) { n = n + 1 }; n", 10},
+	{"n := 10; while (n > 0) { n = n - 1 }; n", 0},
+	{"n := 0; while (n < 10) { n = n + 1 }", nil},
+	{"n := 10; while (n > 0) { n = n - 1 }", nil},
+}
+
+var IndexAssignmentStatements = []Case{
+	{"xs := [1, 2, 3]; xs[1] = 4; xs[1];", 4},
+}
+
+var AssignmentExpressions = []Case{
+	{"a := 0; a = 5;", nil},
+	{"a := 0; a = 5; a;", 5},
+	{"a := 0; a = 5 * 5;", nil},
+	{"a := 0; a = 5 * 5; a;", 25},
+	{"a := 0; a = 5; b := 0; b = a;", nil},
+	{"a := 0; a = 5; b := 0; b = a; b;", 5},
+	{"a := 0; a = 5; b := 0; b = a; c := 0; c = a + b + 5;", nil},
+	{"a := 0; a = 5; b := 0; b = a; c := 0; c = a + b + 5; c;", 15},
+	{"a := 5; b := a; a = 0;", nil},
+	{"a := 5; b := a; a = 0; b;", 5},
+	{"one := 0; one = 1", nil},
+	{"one := 0; one = 1; one", 1},
+	{"one := 0; one = 1; two := 0; two = 2; one + two", 3},
+	{"one := 0; one = 1; two := 0; two = one + one; one + two", 3},
+}
+
+var Constants = []Case{
+	{"const x = 1; x", 1},
+	{"const x = 2; const y = x * 3; y", 6},
+	{"const f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(10)", 55},
+	{"const xs = [1]; xs[0] = 2; xs[0]", 2},
+	{"x := 1; const x = 2; x", 2},
+	{"const x = 1; f := fn(x) { x += 1; x }; f(5)", 6},
+	{"f := fn() { const n = 3; g := fn() { n * 2 }; g() }; f()", 6},
+	{"const x = 1; f := fn() { x := 2; x }; [f(), x]", []int{2, 1}},
+	{"const x = 1; f := fn() { const x = 2; x }; [f(), x]", []int{2, 1}},
+	{"const x = 1; f := fn() { [x, y] := [2, 3]; x + y }; [f(), x]", []int{5, 1}},
+	{"f := fn() { const n = 1; fn() { n := 2; n } }; f()()", 2},
+	{"len := fn(x) { 0 }; len = fn(x) { 1 }; len([])", 1},
+}
+
+var Frozen = []Case{
+	{"xs := freeze([1, [2]]); str([isFrozen(xs), isFrozen(xs[1])])", "[true, true]"},
+	{`h := freeze({"a": {"b": [1]}}); isFrozen(h.a.b)`, true},
+	{"xs := [1]; ys := freeze(xs); isFrozen(xs)", true},
+	{"isFrozen([1])", false},
+	{"str([isFrozen(1), isFrozen(\"a\"), isFrozen(null), isFrozen(freeze(1))])", "[true, true, true, true]"},
+	{"xs := freeze([1]); ys := xs + [2]; ys[1] = 3; ys[1]", 3},
+	{"xs := freeze([1, 2]); xs[1:][0] = 5; xs[1]", 2},
+	{`h := {}; h.self = h; freeze(h); isFrozen(h.self)`, true},
+	{"struct P { x }; p := freeze(P([1])); str([isFrozen(p), isFrozen(p.x), isFrozen(P(1))])", "[true, true, false]"},
+	{"struct P { x }; xs := freeze([P(1)]); isFrozen(xs[0])", true},
+	{"xs := freeze([1]); push(xs, 2)", &object.Error{Message: "cannot modify frozen array"}},
+	{"xs := freeze([1]); pop(xs)", &object.Error{Message: "cannot modify frozen array"}},
+	{"h := freeze({}); setmeta(h, {})", &object.Error{Message: "cannot modify frozen hash"}},
+}
+
+var CompoundAssignment = []Case{
+	{"x := 1; x += 2", nil},
+	{"x := 1; x += 2; x", 3},
+	{"x := 10; x -= 3; x *= 2; x /= 7; x", 2},
+	{"x := 7; x %= 4; x", 3},
+	{"x := 12; x &= 10; x |= 1; x ^= 3; x", 10},
+	{`s := "foo"; s += "bar"; s`, "foobar"},
+	{"f := fn() { n := 1; n += 4; n }; f()", 5},
+	{"n := 1; f := fn() { n += 4 }; f(); n", 5},
+	{"xs := [1, 2]; xs[1] *= 5; xs[1]", 10},
+	{`h := {"count": 0}; h.count += 1; h.count += 1; h.count`, 2},
+	{`h := {"a": 1}; h["a"] -= 1; h["a"]`, 0},
+	{"struct P { x }; p := P(1); p.x += 2; p.x", 3},
+	{"n := 0; xs := [0]; f := fn() { n += 1; xs }; f()[0] += 5; n", 1},
+	{"n := 0; xs := [0, 0]; i := fn() { n += 1; 1 }; xs[i()] += 5; str([n, xs])", "[1, [0, 5]]"},
+}
+
+var GlobalBindExpressions = []Case{
+	{"one := 1; one", 1},
+	{"one := 1; two := 2; one + two", 3},
+	{"one := 1; two := one + one; one + two", 3},
+}
+
+var StringExpressions = []Case{
+	{`"monkey"`, "monkey"},
+	{`"mon" + "key"`, "monkey"},
+	{`"mon" + "key" + "banana"`, "monkeybanana"},
+	{`" " * 4`, "    "},
+	{`4 * " "`, "    "},
+	{`"ab" * -9223372036854775807`, ""},
+}
+
+var StringInterpolation = []Case{
+	{`"${1}"`, "1"},
+	{`x := 1; y := 2; "x=${x}, sum=${x + y}"`, "x=1, sum=3"},
+	{`"${"a"}${true}${null}${[1, "b"]}"`, "atruenull[1, \"b\"]"},
+	{`"\${x}"`, "${x}"},
+	{`"a\t${"}"}\n"`, "a\t}\n"},
+	{`"${ {"a": 1}["a"] }"`, "1"},
+	{`f := fn(n) { "n=${n}" }; f(42)`, "n=42"},
+	{`"${"${1 + 1}"}"`, "2"},
+}
+
+var ArrayLiterals = []Case{
+	{"[]", []int{}},
+	{"[1, 2, 3]", []int{1, 2, 3}},
+	{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+}
+
+var ArrayDuplication = []Case{
+	{"[1] * 3", []int{1, 1, 1}},
+	{"3 * [1]", []int{1, 1, 1}},
+	{"[1, 2] * 2", []int{1, 2, 1, 2}},
+	{"2 * [1, 2]", []int{1, 2, 1, 2}},
+}
+
+var ArrayMerging = []Case{
+	{"[] + [1]", []int{1}},
+	{"[1] + [2]", []int{1, 2}},
+	{"[1, 2] + [3, 4]", []int{1, 2, 3, 4}},
+}
+
+var HashLiterals = []Case{
+	{
+		"{}", map[object.HashKey]int64{},
+	},
+	{
+		"{1: 2, 2: 3}",
+		map[object.HashKey]int64{
+			(&object.Integer{Value: 1}).HashKey(): 2,
+			(&object.Integer{Value: 2}).HashKey(): 3,
+		},
+	},
+	{
+		"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+		map[object.HashKey]int64{
+			(&object.Integer{Value: 2}).HashKey(): 4,
+			(&object.Integer{Value: 6}).HashKey(): 16,
+		},
+	},
+}
+
+var HashMerging = []Case{
+	{
+		`{} + {"a": 1}`,
+		map[object.HashKey]int64{
+			(&object.String{Value: "a"}).HashKey(): 1,
+		},
+	},
+	{
+		`{"a": 1} + {"b": 2}`,
+		map[object.HashKey]int64{
+			(&object.String{Value: "a"}).HashKey(): 1,
+			(&object.String{Value: "b"}).HashKey(): 2,
+		},
+	},
+}
+
+var HashOrder = []Case{
+	{`str({"c": 1, "a": 2, "b": 3})`, `{"c": 1, "a": 2, "b": 3}`},
+	{`h := {"b": 1}; h["a"] = 2; h.c = 3; h.b = 4; str(h)`, `{"b": 4, "a": 2, "c": 3}`},
+	{`str({"b": 1, "a": 2} + {"c": 3, "b": 4})`, `{"b": 4, "a": 2, "c": 3}`},
+	{`str(keys({"b": 1, "a": 2}))`, `["b", "a"]`},
+	{`str(values({"b": 1, "a": 2}))`, "[1, 2]"},
+	{`str(items({"b": 1, 2: true}))`, `[["b", 1], [2, true]]`},
+	{`h := {"a": 1, "b": 2}; str([delete(h, "a"), delete(h, "a"), h])`, `[true, false, {"b": 2}]`},
+	{`h := {"a": 1, "b": 2}; delete(h, "a"); h.a = 3; str(keys(h))`, `["b", "a"]`},
+	{`h := {"a": null}; str([has(h, "a"), has(h, "b"), has(h, 1)])`, "[true, false, false]"},
+	{`keys([])`, &object.Error{Message: "argument to `keys` must be hash, got array"}},
+	{`has({}, [])`, &object.Error{Message: "unusable as hash key: array"}},
+	{`delete(freeze({"a": 1}), "a")`, &object.Error{Message: "cannot modify frozen hash"}},
+}
+
+var SelectorExpressions = []Case{
+	{`{"foo": 5}.foo`, 5},
+	{`{"foo": 5}.bar`, nil},
+	{`{}.foo`, nil},
+}
+
+var IndexExpressions = []Case{
+	{"[1, 2, 3][1]", 2},
+	{"[1, 2, 3][0 + 2]", 3},
+	{"[[1, 1, 1]][0][0]", 1},
+	{"[][0]", Null},
+	{"[1, 2, 3][99]", Null},
+	{"[1][-1]", Null},
+	{"{1: 1, 2: 2}[1]", 1},
+	{"{1: 1, 2: 2}[2]", 2},
+	{"{1: 1}[0]", Null},
+	{"{}[0]", Null},
+	{`"abc"[0]`, "a"},
+	{`"abc"[1]`, "b"},
+	{`"abc"[2]`, "c"},
+	{`"abc"[3]`, ""},
+	{`"abc"[-1]`, ""},
+	{`"héllo, 世界"[1]`, "é"},
+	{`"héllo, 世界"[8]`, "界"},
+	{`"héllo, 世界"[9]`, ""},
+	{`"héllo, 世界"["世"]`, 7},
+}
+
+var Destructuring = []Case{
+	{"[a, b] := [1, 2]; a + b", 3},
+	{"[a, ...rest] := [1, 2, 3]; rest", []int{2, 3}},
+	{"[a, ...rest] := [1]; rest", []int{}},
+	{"[[a, b], c] := [[1, 2], 3]; [a, b, c]", []int{1, 2, 3}},
+	{`{name, age} := {"name": "Bob", "age": 42}; name`, "Bob"},
+	{`{name, age} := {"name": "Bob", "age": 42}; age`, 42},
+	{`[{x}, [y]] := [{"x": 1}, [2]]; x + y`, 3},
+	{"a := 1; b := 2; [a, b] = [b, a]; [a, b]", []int{2, 1}},
+	{"[a, b] := [1, 2]", Null},
+	{"f := fn() { [a, b] := [1, 2]; a * b }; f()", 2},
+	{"f := fn(xs) { [a, ...b] := xs; b }; f([1, 2, 3])", []int{2, 3}},
+	{`f := fn([a, b], {c}) { a + b + c }; f([1, 2], {"c": 3})`, 6},
+	{"f := fn(x) { g := fn([a, b]) { a + b + x }; g([1, 2]) }; f(3)", 6},
+	{"x := 1; f := fn([x]) { x }; [f([5]), x]", []int{5, 1}},
+	{`x := 1; f := fn({x}) { x = 5 }; f({"x": 2}); x`, 1},
+}
+
+var MatchExpressions = []Case{
+	{`match (1) { 1 => "one", _ => "other" }`, "one"},
+	{`match (2) { 1 => "one", _ => "other" }`, "other"},
+	{`match (2) { 1 => "one" }`, Null},
+	{`match ("b") { "a" | "b" => 1, _ => 2 }`, 1},
+	{`match (-1) { -1 => true }`, true},
+	{`match (null) { false => 1, null => 2 }`, 2},
+	{`match ("1") { 1 => "int", "1" => "str" }`, "str"},
+	{`match ([1, 2]) { [] => 0, [x] => x, [x, y] => x + y }`, 3},
+	{`match ([1, 2, 3]) { [x, ...rest] => rest }`, []int{2, 3}},
+	{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, 6},
+	{`match ([2, 1]) { [x, y] if x < y => "asc", [x, y] => "desc" }`, "desc"},
+	{`match ({"kind": "circle", "r": 2}) { {kind: "square"} => 0, {kind: "circle", r} => r * r }`, 4},
+	{`match ({"a": 1}) { {b} => 1, {} => 2 }`, 2},
+	{`match ([1]) { {} => "hash", [_] => "array" }`, "array"},
+	{`match (3) { n => { m := n * 2; m } }`, 6},
+	{`match (3) { n => {} }`, Null},
+	{"x := 1; match (2) { x => x }; x", 2},
+	{"x := [1, 2]; match (x) { [y, x] => [x, y] }", []int{2, 1}},
+	{`f := fn(n) { match (n) { 0 => 0, n => n + f(n - 1) } }; f(10)`, 55},
+	{`f := fn(v) { match (v) { [a, b] => fn() { a * b } } }; f([3, 4])()`, 12},
+	{`one := fn(v) { match (v) { 1 => true, _ => false } }; match (1) { x if !one(x) => 0, x if one(x) => x }`, 1},
+	{`match (match (1) { 1 => 2 }) { 2 => 3 }`, 3},
+}
+
+var Structs = []Case{
+	{"struct Point { x, y }", Null},
+	{"struct Point { x, y }; p := Point(1, 2); p.x + p.y", 3},
+	{`struct Point { x, y }; p := Point(1, 2); p["y"]`, 2},
+	{"struct Point { x, y }; typeof(Point(1, 2))", "Point"},
+	{"struct Point { x, y }; typeof(Point)", "struct"},
+	{"struct Point { x, y }; str(Point(1, [2]))", "Point{x: 1, y: [2]}"},
+	{"struct Point { x, y }; str(Point)", "<struct Point>"},
+	{"struct Point { x, y }; p := Point(1, 2); p.x = 3; p.x", 3},
+	{"struct Point { x, y }; p := Point(1, 2); q := p; q.x = 3; p.x", 3},
+	{"struct Point { x, y, fn norm() { self.x * self.x + self.y * self.y } }; Point(3, 4).norm()", 25},
+	{"struct Point { x, y, fn add(o) { Point(self.x + o.x, self.y + o.y) } }; Point(1, 2).add(Point(3, 4)).y", 6},
+	{"struct C { n, fn inc(by = 1) { self.n = self.n + by; self } }; C(0).inc().inc(2).n", 3},
+	{"struct C { n, fn all(...xs) { xs } }; C(0).all(...[1, 2])", []int{1, 2}},
+	{"struct C { n, fn get() { self.n } }; f := C(7).get; f()", 7},
+	{"struct C { n, fn get() { self.n } }; str(C(7).get)", "<bound method C.get>"},
+	{"struct S { xs, fn len() { len(self.xs) } }; S([1, 2]).len()", 2},
+	{"struct C { n, fn down() { if (self.n == 0) { return 0 }; self.n = self.n - 1; self.down() } }; C(1000).down()", 0},
+	{"make := fn(v) { struct Box { v, fn get() { v } }; Box(v) }; make(5).get()", 5},
+	{"make := fn() { struct Box { v, fn copy() { Box(self.v) } }; Box(1) }; make().copy().v", 1},
+	{"struct Box { v }; b := Box(1); match (b) { Box => typeof(b) }", "Box"},
+	{"struct A { }; A() == A()", false},
+	{"struct A { }; a := A(); a == a", true},
+}
+
+const vecMetatable = `V := {}; vec := fn(x, y) { setmeta({"x": x, "y": y}, V) }
+V["__add"] = fn(a, b) { vec(a.x + b.x, a.y + b.y) }
+V["__eq"] = fn(a, b) { a.x == b.x && a.y == b.y }
+V["__lt"] = fn(a, b) { a.x < b.x }
+V["__str"] = fn(v) { "(${v.x}, ${v.y})" }
+`
+
+var Metatables = []Case{
+	{`h := {}; setmeta(h, {}) == h`, true},
+	{`getmeta({})`, Null},
+	{`m := {}; h := setmeta({}, m); getmeta(h) == m`, true},
+	{`h := setmeta({}, {}); setmeta(h, null); getmeta(h)`, Null},
+	{vecMetatable + `v := vec(1, 2) + vec(3, 4); v.y`, 6},
+	{vecMetatable + `setmeta({"x": 1}, {"__add": fn(a, b) { a.x + b }}) + 2`, 3},
+	{vecMetatable + `1 + setmeta({}, {"__add": fn(a, b) { a }})`, 1},
+	{vecMetatable + `str([vec(1, 2) == vec(1, 2), vec(1, 2) != vec(1, 2), vec(1, 2) == vec(2, 2)])`, "[true, false, false]"},
+	{vecMetatable + `str([vec(1, 0) < vec(2, 0), vec(1, 0) > vec(2, 0), vec(1, 0) <= vec(1, 0), vec(1, 0) >= vec(2, 0)])`, "[true, false, true, false]"},
+	{vecMetatable + `str(vec(1, 2))`, "(1, 2)"},
+	{vecMetatable + `"v=${vec(1, 2)}"`, "v=(1, 2)"},
+	{`len(setmeta({}, {"__len": fn(h) { 42 }}))`, 42},
+	{`h := setmeta({"x": 1}, {"__index": {"y": 2}}); str([h.x, h.y, h.z])`, "[1, 2, null]"},
+	{`m := {}; m["__index"] = m; m["y"] = 2; setmeta({}, m).y`, 2},
+	{`h := setmeta({}, {"__index": fn(h, k) { k + "!" }}); h.hi`, "hi!"},
+	{`h := setmeta({"n": 2}, {"__call": fn(self, x) { self.n * x }}); h(21)`, 42},
+	{`h := setmeta({}, {"__call": fn(self, ...xs) { len(xs) }}); h(...[1, 2, 3])`, 3},
+	{`add := fn(a, b) { if (a.n == 0) { return b }; setmeta({"n": a.n - 1}, getmeta(a)) + b }; setmeta({"n": 100}, {"__add": add}) + 1`, 1},
+}
+
+var SliceExpressions = []Case{
+	{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+	{"[1, 2, 3, 4][:2]", []int{1, 2}},
+	{"[1, 2, 3, 4][2:]", []int{3, 4}},
+	{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+	{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+	{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+	{"[1, 2, 3, 4][3:1]", []int{}},
+	{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+	{"xs := [1, 2, 3]; ys := xs[:]; ys[0] = 4; xs", []int{1, 2, 3}},
+	{"i := 1; j := 3; [1, 2, 3, 4][i:j]", []int{2, 3}},
+	{"f := fn(xs, n) { xs[n:] }; f([1, 2, 3], 1)", []int{2, 3}},
+	{`"monkey"[1:3]`, "on"},
+	{`"monkey"[:-3]`, "mon"},
+	{`"monkey"[3:]`, "key"},
+	{`"héllo, 世界"[1:2]`, "é"},
+	{`"héllo, 世界"[-2:]`, "世界"},
+	{`"monkey"[10:]`, ""},
+}
+
+var CallingFunctionsWithoutArguments = []Case{
+	{
+		Input: `
+		fivePlusTen := fn() { return 5 + 10; };
+		fivePlusTen();
+		`,
+		Expected: 15,
+	},
+	{
+		Input: `
+		one := fn() { return 1; };
+		two := fn() { return 2; };
+		one() + two()
+		`,
+		Expected: 3,
+	},
+	{
+		Input: `
+		a := fn() { return 1 };
+		b := fn() { return a() + 1 };
+		c := fn() { return b() + 1 };
+		c();
+		`,
+		Expected: 3,
+	},
+}
+
+var FunctionsWithReturnStatement = []Case{
+	{
+		Input: `
+		earlyExit := fn() { return 99; 100; };
+		earlyExit();
+		`,
+		Expected: 99,
+	},
+	{
+		Input: `
+		earlyExit := fn() { return 99; return 100; };
+		earlyExit();
+		`,
+		Expected: 99,
+	},
+}
+
+var FunctionsWithImplicitReturnValue = []Case{
+	{
+		Input: `
+		add := fn(a, b) { a + b };
+		add(1, 2);
+		`,
+		Expected: 3,
+	},
+	{
+		Input: `
+		max := fn(a, b) { if (a > b) { a } else { b } };
+		max(1, 2) + max(4, 3);
+		`,
+		Expected: 6,
+	},
+}
+
+var FunctionsWithoutReturnValue = []Case{
+	{
+		Input: `
+		noReturn := fn() { };
+		noReturn();
+		`,
+		Expected: Null,
+	},
+	{
+		Input: `
+		noReturn := fn() { };
+		noReturnTwo := fn() { noReturn(); };
+		noReturn();
+		noReturnTwo();
+		`,
+		Expected: Null,
+	},
+}
+
+var FirstClassFunctions = []Case{
+	{
+		Input: `
+		returnsOne := fn() { return 1; };
+		returnsOneReturner := fn() { return returnsOne; };
+		returnsOneReturner()();
+		`,
+		Expected: 1,
+	},
+	{
+		Input: `
+		returnsOneReturner := fn() {
+			returnsOne := fn() { return 1; };
+			return returnsOne;
+		};
+		returnsOneReturner()();
+		`,
+		Expected: 1,
+	},
+}
+
+var CallingFunctionsWithBindings = []Case{
+	{
+		Input: `
+		one := fn() { one := 1; return one };
+		one();
+		`,
+		Expected: 1,
+	},
+	{
+		Input: `
+		oneAndTwo := fn() { one := 1; two := 2; return one + two; };
+		oneAndTwo();
+		`,
+		Expected: 3,
+	},
+	{
+		Input: `
+		oneAndTwo := fn() { one := 1; two := 2; return one + two; };
+		threeAndFour := fn() { three := 3; four := 4; return three + four; };
+		oneAndTwo() + threeAndFour();
+		`,
+		Expected: 10,
+	},
+	{
+		Input: `
+		firstFoobar := fn() { foobar := 50; return foobar; };
+		secondFoobar := fn() { foobar := 100; return foobar; };
+		firstFoobar() + secondFoobar();
+		`,
+		Expected: 150,
+	},
+	{
+		Input: `
+		globalSeed := 50;
+		minusOne := fn() {
+			num := 1;
+			return globalSeed - num;
+		}
+		minusTwo := fn() {
+			num := 2;
+			return globalSeed - num;
+		}
+		minusOne() + minusTwo();
+		`,
+		Expected: 97,
+	},
+}
+
+var CallingFunctionsWithArgumentsAndBindings = []Case{
+	{
+		Input: `
+		identity := fn(a) { return a; };
+		identity(4);
+		`,
+		Expected: 4,
+	},
+	{
+		Input: `
+		sum := fn(a, b) { return a + b; };
+		sum(1, 2);
+		`,
+		Expected: 3,
+	},
+	{
+		Input: `
+		sum := fn(a, b) {
+			c := a + b;
+			return c;
+		};
+		sum(1, 2);
+		`,
+		Expected: 3,
+	},
+	{
+		Input: `
+		sum := fn(a, b) {
+			c := a + b;
+			return c;
+		};
+		sum(1, 2) + sum(3, 4);`,
+		Expected: 10,
+	},
+	{
+		Input: `
+		sum := fn(a, b) {
+			c := a + b;
+			return c;
+		};
+		outer := fn() {
+			return sum(1, 2) + sum(3, 4);
+		};
+		outer();
+		`,
+		Expected: 10,
+	},
+	{
+		Input: `
+		globalNum := 10;
+
+		sum := fn(a, b) {
+			c := a + b;
+			return c + globalNum;
+		};
+
+		outer := fn() {
+			return sum(1, 2) + sum(3, 4) + globalNum;
+		};
+		outer() + globalNum;
+		`,
+		Expected: 50,
+	},
+}
+
+var DefaultAndRestParameters = []Case{
+	{"f := fn(a, b = 10) { a + b }; f(1)", 11},
+	{"f := fn(a, b = 10) { a + b }; f(1, 2)", 3},
+	{"f := fn(a = 1, b = a + 1) { [a, b] }; f()", []int{1, 2}},
+	{"f := fn(a = 1, b = a + 1) { [a, b] }; f(5)", []int{5, 6}},
+	{"x := 1; f := fn(a = x) { a }; x = 2; f()", 2},
+	{"f := fn(...rest) { rest }; f()", []int{}},
+	{"f := fn(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+	{"f := fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1)", []int{1, 2, 0}},
+	{"f := fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 3, 5, 7)", []int{1, 3, 2}},
+	{"f := fn([a, b] = [1, 2]) { a + b }; f()", 3},
+	{"f := fn(x) { g := fn(a = x) { a * 2 }; g() }; f(4)", 8},
+	{
+		`f := fn(n, acc = 0) { if (n == 0) { return acc } return f(n - 1, acc + n) }; f(10000)`,
+		50005000,
+	},
+}
+
+var SpreadArguments = []Case{
+	{"f := fn(a, b, c) { a + b + c }; f(...[1, 2, 3])", 6},
+	{"f := fn(a, b, c) { [a, b, c] }; f(1, ...[2], 3)", []int{1, 2, 3}},
+	{"f := fn(...xs) { xs }; xs := [1, 2]; f(0, ...xs, ...xs)", []int{0, 1, 2, 1, 2}},
+	{"f := fn(a, b = 2) { a + b }; f(...[1])", 3},
+	{"f := fn() { 1 }; f(...[])", 1},
+	{`len(...["abc"])`, 3},
+	{"f := fn(xs) { g := fn(a, b) { a - b }; g(...xs) }; f([5, 3])", 2},
+}
+
+var BuiltinFunctions = []Case{
+	{`len("")`, 0},
+	{`len("four")`, 4},
+	{`len("hello world")`, 11},
+	{
+		`len(1)`,
+		&object.Error{
+			Message: "argument to `len` not supported, got int",
+		},
+	},
+	{`len("one", "two")`,
+		&object.Error{
+			Message: "wrong number of arguments. got=2, want=1",
+		},
+	},
+	{`len("héllo, 世界")`, 9},
+	{`ord("世")`, 19990},
+	{`ord("ab")`,
+		&object.Error{
+			Message: "argument to `ord` must be a single character, got 2",
+		},
+	},
+	{`chr(19990)`, "世"},
+	{`chr(-1)`,
+		&object.Error{
+			Message: "argument to `chr` is not a valid code point: -1",
+		},
+	},
+	{`chr(1 << 70)`,
+		&object.Error{
+			Message: "argument to `chr` is not a valid code point: 1180591620717411303424",
+		},
+	},
+	{`exit(1 << 70)`,
+		&object.Error{
+			Message: "argument to `exit` is out of range: 1180591620717411303424",
+		},
+	},
+	{`bool(1 << 70)`, true},
+	{`bytes("é")`, []int{195, 169}},
+	{`find("世界", "界")`, 1},
+	{`len([1, 2, 3])`, 3},
+	{`len([])`, 0},
+	{`print("hello", "world!")`, Null},
+	{`first([1, 2, 3])`, 1},
+	{`first([])`, Null},
+	{`first(1)`,
+		&object.Error{
+			Message: "argument to `first` must be array, got int",
+		},
+	},
+	{`last([1, 2, 3])`, 3},
+	{`last([])`, Null},
+	{`last(1)`,
+		&object.Error{
+			Message: "argument to `last` must be array, got int",
+		},
+	},
+	{`rest([1, 2, 3])`, []int{2, 3}},
+	{`rest([])`, Null},
+	{`push([], 1)`, []int{1}},
+	{`push(1, 1)`,
+		&object.Error{
+			Message: "argument to `push` must be array, got int",
+		},
+	},
+	{`input()`, ""},
+	{`pop([])`, &object.Error{
+		Message: "cannot pop from an empty array",
+	},
+	},
+	{`pop([1])`, 1},
+	{`bool(1)`, true},
+	{`bool(0)`, false},
+	{`bool(true)`, true},
+	{`bool(false)`, false},
+	{`bool(null)`, false},
+	{`bool("")`, false},
+	{`bool("foo")`, true},
+	{`bool([])`, false},
+	{`bool([1, 2, 3])`, true},
+	{`bool({})`, false},
+	{`bool({"a": 1})`, true},
+	{`int(true)`, 1},
+	{`int(false)`, 0},
+	{`int(1)`, 1},
+	{`int("10")`, 10},
+	{`str(null)`, "null"},
+	{`str(true)`, "true"},
+	{`str(false)`, "false"},
+	{`str(10)`, "10"},
+	{`str("foo")`, "foo"},
+	{`str([1, 2, 3])`, "[1, 2, 3]"},
+	{`str({"a": 1})`, "{\"a\": 1}"},
+}
+
+var Closures = []Case{
+	{
+		Input: `
+		newClosure := fn(a) {
+			return fn() { return a; };
+		};
+		closure := newClosure(99);
+		closure();
+		`,
+		Expected: 99,
+	},
+	{
+		Input: `
+		newAdder := fn(a, b) {
+			return fn(c) { return a + b + c };
+		};
+		adder := newAdder(1, 2);
+		adder(8);
+		`,
+		Expected: 11,
+	},
+	{
+		Input: `
+		newAdder := fn(a, b) {
+			c := a + b;
+			return fn(d) { return c + d };
+		};
+		adder := newAdder(1, 2);
+		adder(8);
+		`,
+		Expected: 11,
+	},
+	{
+		Input: `
+		newAdderOuter := fn(a, b) {
+			c := a + b;
+			return fn(d) {
+				e := d + c;
+				return fn(f) { return e + f; };
+			};
+		};
+		newAdderInner := newAdderOuter(1, 2)
+		adder := newAdderInner(3);
+		adder(8);
+		`,
+		Expected: 14,
+	},
+	{
+		Input: `
+		a := 1;
+		newAdderOuter := fn(b) {
+			return fn(c) {
+				return fn(d) { return a + b + c + d };
+			};
+		};
+		newAdderInner := newAdderOuter(2)
+		adder := newAdderInner(3);
+		adder(8);
+		`,
+		Expected: 14,
+	},
+	{
+		Input: `
+		newClosure := fn(a, b) {
+			one := fn() { return a; };
+			two := fn() { return b; };
+			return fn() { return one() + two(); };
+		};
+		closure := newClosure(9, 90);
+		closure();
+		`,
+		Expected: 99,
+	},
+}
+
+var RecursiveFibonacci = []Case{
+	{
+		Input: `
+		fibonacci := fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				if (x == 1) {
+					return 1;
+				} else {
+					return fibonacci(x - 1) + fibonacci(x - 2);
+				}
+			}
+		};
+		fibonacci(15);
+		`,
+		Expected: 610,
+	},
+}
+
+var TailCalls = []Case{
+	{
+		Input: `
+		fact := fn(n, a) {
+		  if (n == 0) {
+			return a
+		  }
+		  return fact(n - 1, a * n)
+		}
+
+		fact(5, 1)
+        	`,
+		Expected: 120,
+	},
+
+	// without tail recursion optimization this will cause a stack overflow
+	{
+		Input: `
+		iter := fn(n, max) {
+			if (n == max) {
+				return n
+			}
+			return iter(n + 1, max)
+		}
+		iter(0, 9999)
+		`,
+		Expected: 9999,
+	},
+}
+
+var CallingFunctionsInFunctions = []Case{
+	{
+		Input: `
+		double := fn(x) { return x * 2 };
+		double(5);
+		`,
+		Expected: 10,
+	},
+	{
+		Input: `
+		double := fn(x) { return x * 2 };
+		double_double := fn(x) { return 2 * double(x); };
+		double_double(5);
+		`,
+		Expected: 20,
+	},
+	{
+		Input: `
+		double := fn(x) { return x * 2 };
+		wrappedDouble := fn(x) { return double(x); };
+		wrappedDouble(5);
+		`,
+		Expected: 10,
+	},
+	{
+		Input: `
+		wrappedDouble := fn() {
+			double := fn(x) { return x * 2 };
+			return double(5);
+		};
+		wrappedDouble();
+		`,
+		Expected: 10,
+	},
+}
+
+var CallingRecursiveFunctionsInFunctions = []Case{
+	{
+		// This works
+		Input: `
+		inner := fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				return inner(x - 1);
+			}
+		};
+		inner(1);
+		`,
+		Expected: 0,
+	},
+	{
+		// This also works
+		Input: `
+		inner := fn(x) {
+			if (x == 0) {
+				return 1;
+			} else {
+				return inner(x - 1);
+			}
+		};
+		wrapper := fn() {
+			return inner(1);
+		};
+		wrapper();
+		`,
+		Expected: 1,
+	},
+	{
+		// This does _NOT_ work
+		Input: `
+		wrapper := fn() {
+			inner := fn(x) {
+				if (x == 0) {
+					return 2;
+				} else {
+					return inner(x - 1);
+				}
+			};
+			return inner(1);
+		};
+		wrapper();
+		`,
+		Expected: 2,
+	},
+}
+
+var GeneralTailCalls = []Case{
+	{
+		`
+		countdown := fn(f, n) { if (n == 0) { return true } return f(f, n - 1) }
+		countdown(countdown, 10000)
+		`,
+		true,
+	},
+}
+
+// The tables below hold the inputs which fail at runtime with the expected
+// error in every virtual machine
+
+var CallingFunctionsWithWrongArguments = []ErrorCase{
+	{
+		Input:    `fn() { return 1; }(1);`,
+		Expected: `wrong number of arguments: want=0, got=1`,
+	},
+	{
+		Input:    `fn(a) { return a; }();`,
+		Expected: `wrong number of arguments: want=1, got=0`,
+	},
+	{
+		Input:    `fn(a, b) { return a + b; }(1);`,
+		Expected: `wrong number of arguments: want=2, got=1`,
+	},
+	{
+		Input:    `fn(a, b = 1) { return a + b; }();`,
+		Expected: `wrong number of arguments: want at least 1, got=0`,
+	},
+	{
+		Input:    `fn(a, b = 1) { return a + b; }(1, 2, 3);`,
+		Expected: `wrong number of arguments: want at most 2, got=3`,
+	},
+	{
+		Input:    `fn(a, ...rest) { return rest; }();`,
+		Expected: `wrong number of arguments: want at least 1, got=0`,
+	},
+}
+
+var RuntimeErrors = []ErrorCase{
+	{`1 / 0`, "division by zero"},
+	{`1 % 0`, "division by zero"},
+	{`(9223372036854775807 * 2) / 0`, "division by zero"},
+	{`1 << -1`, "negative shift count"},
+	{`(1 << 64) >> -1`, "negative shift count"},
+	{`1 << (1 << 64)`, "shift count too large"},
+	{`2 ** -1`, "negative exponent"},
+	{`"ab" * 9223372036854775807`, "string repeat count too large: 9223372036854775807"},
+	{`9223372036854775807 * "ab"`, "string repeat count too large: 9223372036854775807"},
+	{`len([0] * 100000000)`, "array repeat count too large: 100000000"},
+	{`9223372036854775807 * [1, 2]`, "array repeat count too large: 9223372036854775807"},
+	{`1 << 100000000000`, "shift count too large"},
+	{`(1 << 64) << 16777210`, "shift count too large"},
+	{`2 ** 100000000000`, "exponent too large"},
+	{`(1 << 64) ** (1 << 64)`, "exponent too large"},
+	{`1 % (9223372036854775807 * 2 - 9223372036854775807 * 2)`, "division by zero"},
+	{`f := fn(x) { f(x) + 1 }; f(1)`, "stack overflow"},
+	{`[1, 2, 3]["a":]`, "slice index must be int, got str"},
+	{`{"a": 1}[1:2]`, "slice operator not supported: hash"},
+	{`[a, b] := 1`, "cannot destructure int as array"},
+	{`[a, b] := [1]`, "cannot destructure array of length 1 into 2 elements"},
+	{`[a, ...b] := []`, "cannot destructure array of length 0 into at least 1 elements"},
+	{`{a} := [1]`, "cannot destructure array as hash"},
+	{`{a} := {"b": 1}`, `missing key "a" in hash`},
+	{`f := fn(a) { a }; f(...1)`, "cannot spread int"},
+	{`len(...{})`, "cannot spread hash"},
+	{`match (1) { x if x / 0 => x }`, "division by zero"},
+	{"struct P { x }; P(1).y", "unknown field y of P"},
+	{"struct P { x }; p := P(1); p.y = 2", "unknown field y of P"},
+	{"struct P { x }; P(1)[0]", "unusable as field name: int"},
+	{"struct P { x }; p := P(1); p[[1]] = 2", "unusable as field name: array"},
+	{"h := {}; h[[1]] = 1", "unusable as hash key: array"},
+	{`xs := [1]; xs["a"] = 2`, "set item operation not supported: left=array index=str"},
+	{"struct P { x, y }; P(1)", "wrong number of arguments: want=2, got=1"},
+	{"struct P { x, fn m(a) { a } }; P(1).m()", "wrong number of arguments: want=2, got=1"},
+	{`m := {}; m["__index"] = setmeta({}, m); setmeta({}, m).x`, `__index chain too long looking up "x"`},
+	{`str(setmeta({}, {"__str": fn(h) { 1 }}))`, "__str must return str, got int"},
+	{`setmeta({}, {"__add": fn(a, b) { a / 0 }}) + 1`, "unsupported types for binary operation: hash int"},
+	{`setmeta({}, {"__lt": fn(a) { a }}) < 1`, "wrong number of arguments: want=1, got=2"},
+	{`setmeta({}, {"__call": 1})()`, "calling non-closure and non-builtin: *object.Integer 1"},
+	{"xs := freeze([1]); xs[0] = 2", "cannot modify frozen array"},
+	{`h := freeze({"a": [1]}); h.a[0] += 1`, "cannot modify frozen array"},
+	{`h := freeze({}); h["a"] = 1`, "cannot modify frozen hash"},
+	{"h := freeze({}); h.a = 1", "cannot modify frozen hash"},
+	{"struct P { x }; p := freeze(P(1)); p.x = 2", "cannot modify frozen P"},
+	{"struct P { x }; xs := freeze([P(1)]); xs[0].x += 1", "cannot modify frozen P"},
+	{`1()`, "calling non-closure and non-builtin: *object.Integer 1"},
+	{`[1][2] = 3`, "index out of bounds: 2"},
+	{"[1][9223372036854775807 * 2]", "index out of bounds: 18446744073709551614"},
+	{`"a"[9223372036854775807 * 2]`, "index out of bounds: 18446744073709551614"},
+	{"[1][(1 << 64):]", "index out of bounds: 18446744073709551616"},
+	{`"a"[:-(1 << 64)]`, "index out of bounds: -18446744073709551616"},
+	{"xs := [1]; xs[1 << 64] = 2", "index out of bounds: 18446744073709551616"},
+}
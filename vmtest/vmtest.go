@@ -0,0 +1,324 @@
+// Package vmtest provides the test cases shared by the stack based (vm) and
+// register based (rvm) virtual machines so that both are held to the same
+// behaviour.
+package vmtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prologic/monkey-lang/ast"
+	"github.com/prologic/monkey-lang/lexer"
+	"github.com/prologic/monkey-lang/object"
+	"github.com/prologic/monkey-lang/parser"
+)
+
+// FuzzLimit bounds the number of instructions executed by fuzz targets
+const FuzzLimit = 10000
+
+// FuzzSeeds are the inputs the fuzz targets of every engine start from
+var FuzzSeeds = []string{
+	`x := 5; f := fn(a, b) { a + b }; f(x, 2)`,
+	`xs := [1, 2, 3]; h := {"a": xs}; h.a[1] = "x" * 3; len(h.a)`,
+	`i := 0; while (i < 10) { i = i + 1 }; i / 0`,
+	`f := fn(n) { if (n < 2) { return n } return f(n-1) + f(n-2) }; f(10)`,
+}
+
+// Null is the expected value of cases which evaluate to null in any engine
+var Null = &object.Null{}
+
+// Case is an input and the expected value of its last expression statement
+type Case struct {
+	Input    string
+	Expected interface{}
+}
+
+// ErrorCase is an input and the error it is expected to fail with
+type ErrorCase struct {
+	Input    string
+	Expected string
+}
+
+// Engine compiles and runs program returning the value of its last
+// expression statement
+type Engine func(program *ast.Program) (object.Object, error)
+
+// Parse parses input into a program
+func Parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// RunAll runs every shared table against engine, each as a subtest
+func RunAll(t *testing.T, engine Engine) {
+	tables := []struct {
+		name  string
+		tests []Case
+	}{
+		{"IntegerArithmetic", IntegerArithmetic},
+		{"BigIntegers", BigIntegers},
+		{"BooleanExpressions", BooleanExpressions},
+		{"Conditionals", Conditionals},
+		{"Iterations", Iterations},
+		{"IndexAssignmentStatements", IndexAssignmentStatements},
+		{"AssignmentExpressions", AssignmentExpressions},
+		{"Constants", Constants},
+		{"Frozen", Frozen},
+		{"CompoundAssignment", CompoundAssignment},
+		{"GlobalBindExpressions", GlobalBindExpressions},
+		{"StringExpressions", StringExpressions},
+		{"StringInterpolation", StringInterpolation},
+		{"ArrayLiterals", ArrayLiterals},
+		{"ArrayDuplication", ArrayDuplication},
+		{"ArrayMerging", ArrayMerging},
+		{"HashLiterals", HashLiterals},
+		{"HashMerging", HashMerging},
+		{"HashOrder", HashOrder},
+		{"SelectorExpressions", SelectorExpressions},
+		{"IndexExpressions", IndexExpressions},
+		{"Destructuring", Destructuring},
+		{"MatchExpressions", MatchExpressions},
+		{"Structs", Structs},
+		{"Metatables", Metatables},
+		{"SliceExpressions", SliceExpressions},
+		{"CallingFunctionsWithoutArguments", CallingFunctionsWithoutArguments},
+		{"FunctionsWithReturnStatement", FunctionsWithReturnStatement},
+		{"FunctionsWithImplicitReturnValue", FunctionsWithImplicitReturnValue},
+		{"FunctionsWithoutReturnValue", FunctionsWithoutReturnValue},
+		{"FirstClassFunctions", FirstClassFunctions},
+		{"CallingFunctionsWithBindings", CallingFunctionsWithBindings},
+		{"CallingFunctionsWithArgumentsAndBindings", CallingFunctionsWithArgumentsAndBindings},
+		{"DefaultAndRestParameters", DefaultAndRestParameters},
+		{"SpreadArguments", SpreadArguments},
+		{"BuiltinFunctions", BuiltinFunctions},
+		{"Closures", Closures},
+		{"RecursiveFibonacci", RecursiveFibonacci},
+		{"TailCalls", TailCalls},
+		{"GeneralTailCalls", GeneralTailCalls},
+		{"CallingFunctionsInFunctions", CallingFunctionsInFunctions},
+		{"CallingRecursiveFunctionsInFunctions", CallingRecursiveFunctionsInFunctions},
+	}
+
+	for _, table := range tables {
+		tests := table.tests
+		t.Run(table.name, func(t *testing.T) { Run(t, engine, tests) })
+	}
+
+	t.Run("CallingFunctionsWithWrongArguments", func(t *testing.T) {
+		RunErrors(t, engine, CallingFunctionsWithWrongArguments)
+	})
+	t.Run("RuntimeErrors", func(t *testing.T) {
+		RunErrors(t, engine, RuntimeErrors)
+	})
+}
+
+// Run runs each test with engine and checks the value it results in
+func Run(t *testing.T, engine Engine, tests []Case) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result, err := engine(Parse(tt.Input))
+		if err != nil {
+			t.Log(tt.Input)
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.Expected, result)
+	}
+}
+
+// RunErrors runs each test with engine and checks the error it fails with
+func RunErrors(t *testing.T, engine Engine, tests []ErrorCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		_, err := engine(Parse(tt.Input))
+		if err == nil || err.Error() != tt.Expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.Input, tt.Expected, err)
+		}
+	}
+}
+
+// RunFiles runs each program matching pattern with engine as a subtest
+func RunFiles(t *testing.T, engine Engine, pattern string) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, match := range matches {
+		match := match
+		basename := path.Base(match)
+		name := strings.TrimSuffix(basename, filepath.Ext(basename))
+
+		t.Run(name, func(t *testing.T) {
+			b, err := ioutil.ReadFile(match)
+			if err != nil {
+				t.Error(err)
+			}
+
+			input := string(b)
+			if _, err := engine(Parse(input)); err != nil {
+				t.Log(input)
+				t.Fatalf("vm error: %s", err)
+			}
+		})
+	}
+}
+
+// Quiet silences the builtins that perform I/O or exit for the duration of
+// a fuzz target
+func Quiet(f *testing.F) {
+	stdin, stdout := object.StandardInput, object.StandardOutput
+	exit, assert := object.ExitFunction, object.AssertFunction
+
+	object.StandardInput = strings.NewReader("")
+	object.StandardOutput = ioutil.Discard
+	object.ExitFunction = func(int) {}
+	object.AssertFunction = func(string) {}
+
+	f.Cleanup(func() {
+		object.StandardInput, object.StandardOutput = stdin, stdout
+		object.ExitFunction, object.AssertFunction = exit, assert
+	})
+}
+
+func testExpectedObject(
+	t *testing.T,
+	expected interface{},
+	actual object.Object,
+) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
+				len(expected), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+
+	case bool:
+		err := testBooleanObject(bool(expected), actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				expected.Message, errObj.Message)
+		}
+
+	case *object.Null:
+		if actual == nil || actual.Type() != object.NULL {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v) want=%d",
+			actual, actual, expected)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}